@@ -0,0 +1,136 @@
+// Package audit records who did what, for answering questions like who
+// deleted or reran a URL. Events are only ever appended.
+package audit
+
+import (
+	"encoding/json"
+	"log"
+
+	"webcrawler/database"
+	"webcrawler/tokens"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Actions
+const (
+	Login          = "auth.login"
+	LoginChallenge = "auth.login_challenge"
+	LoginFailed    = "auth.login_failed"
+	Logout         = "auth.logout"
+	LogoutAll      = "auth.logout_all"
+	Register       = "auth.register"
+	PasswordChange = "auth.password_change"
+	PasswordReset  = "auth.password_reset"
+	TwoFactorOn    = "auth.2fa_enable"
+	TwoFactorOff   = "auth.2fa_disable"
+	RecoveryCodes  = "auth.recovery_codes"
+	APIKeyCreate   = "api_key.create"
+	APIKeyRevoke   = "api_key.revoke"
+	AccountDelete  = "account.delete"
+
+	URLCreate     = "url.create"
+	URLDelete     = "url.delete"
+	URLBulkDelete = "url.bulk_delete"
+	URLBulkRerun  = "url.bulk_rerun"
+	CrawlStart    = "crawl.start"
+	CrawlStop     = "crawl.stop"
+
+	OrgDelete       = "org.delete"
+	WorkspaceCreate = "workspace.create"
+	WorkspaceDelete = "workspace.delete"
+	MemberUpdate    = "member.update"
+	MemberRemove    = "member.remove"
+	MemberLeave     = "member.leave"
+	InviteCreate    = "invite.create"
+	InviteRevoke    = "invite.revoke"
+	InviteAccept    = "invite.accept"
+
+	UserDisable  = "admin.user_disable"
+	UserEnable   = "admin.user_enable"
+	UserUnlock   = "admin.user_unlock"
+	UserPlan     = "admin.user_plan"
+	CrawlCancel  = "admin.crawl_cancel"
+	LimitsUpdate = "admin.limits_update"
+)
+
+// Target types
+const (
+	TargetUser      = "user"
+	TargetURL       = "url"
+	TargetAPIKey    = "api_key"
+	TargetOrg       = "organization"
+	TargetWorkspace = "workspace"
+	TargetInvite    = "invite"
+)
+
+// Event is one action taken by a user.
+type Event struct {
+	Action     string
+	TargetType string
+	TargetIDs  []int
+	// WorkspaceID is set for actions on a workspace's URLs, which lets the
+	// workspace's organization admins see the event.
+	WorkspaceID int
+	// OrganizationID is set for actions on an organization, its members and
+	// invitations, which lets the organization's admins see the event.
+	OrganizationID int
+	Details        map[string]interface{}
+
+	// ActorID and Actor default to the user making the request. Login
+	// events set them, since no one is logged in yet.
+	ActorID int
+	Actor   string
+}
+
+// Record appends an event along with the request's IP address, user agent
+// and request ID. Failures are logged; they never fail the request.
+func Record(c *gin.Context, e Event) {
+	if e.ActorID == 0 && e.Actor == "" {
+		e.ActorID = c.GetInt("user_id")
+		e.Actor = c.GetString("username")
+	}
+
+	var apiKeyID interface{}
+	if identity, ok := c.Get("api_key"); ok {
+		apiKeyID = identity.(*tokens.APIKeyIdentity).KeyID
+	}
+
+	var actorID, workspaceID, organizationID, targetIDs, details interface{}
+	if e.ActorID != 0 {
+		actorID = e.ActorID
+	}
+	if e.WorkspaceID != 0 {
+		workspaceID = e.WorkspaceID
+	}
+	if e.OrganizationID != 0 {
+		organizationID = e.OrganizationID
+	}
+	if len(e.TargetIDs) > 0 {
+		encoded, _ := json.Marshal(e.TargetIDs)
+		targetIDs = string(encoded)
+	}
+	if len(e.Details) > 0 {
+		encoded, err := json.Marshal(e.Details)
+		if err == nil {
+			details = string(encoded)
+		}
+	}
+
+	userAgent := c.Request.UserAgent()
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+
+	_, err := database.DB.Exec(`
+		INSERT INTO audit_events (
+			actor_id, actor, api_key_id, action, target_type, target_ids,
+			workspace_id, organization_id, details, ip, user_agent, request_id
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		actorID, e.Actor, apiKeyID, e.Action, e.TargetType, targetIDs,
+		workspaceID, organizationID, details, c.ClientIP(), userAgent, c.GetString("request_id"),
+	)
+	if err != nil {
+		log.Printf("Failed to record audit event %s: %v", e.Action, err)
+	}
+}
@@ -0,0 +1,137 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"webcrawler/database"
+	"webcrawler/tokens"
+
+	"github.com/gin-gonic/gin"
+)
+
+// eventStore records the rows inserted into audit_events by column.
+type eventStore struct {
+	rows []map[string]driver.Value
+}
+
+var columns = []string{
+	"actor_id", "actor", "api_key_id", "action", "target_type", "target_ids",
+	"workspace_id", "organization_id", "details", "ip", "user_agent", "request_id",
+}
+
+func (s *eventStore) Connect(context.Context) (driver.Conn, error) { return s, nil }
+func (s *eventStore) Driver() driver.Driver                        { return nil }
+
+func (s *eventStore) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements not supported")
+}
+func (s *eventStore) Close() error              { return nil }
+func (s *eventStore) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+func (s *eventStore) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if !strings.Contains(query, "INSERT INTO audit_events") || len(args) != len(columns) {
+		return nil, errors.New("unexpected statement: " + query)
+	}
+	row := map[string]driver.Value{}
+	for i, column := range columns {
+		row[column] = args[i].Value
+	}
+	s.rows = append(s.rows, row)
+	return driver.RowsAffected(1), nil
+}
+
+func useEventStore(t *testing.T) *eventStore {
+	t.Helper()
+	store := &eventStore{}
+	saved := database.DB
+	database.DB = sql.OpenDB(store)
+	t.Cleanup(func() {
+		database.DB.Close()
+		database.DB = saved
+	})
+	return store
+}
+
+func newContext(userAgent string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodDelete, "/api/urls/7", nil)
+	c.Request.RemoteAddr = "203.0.113.9:51234"
+	c.Request.Header.Set("User-Agent", userAgent)
+	return c
+}
+
+func TestRecord(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := useEventStore(t)
+
+	c := newContext("Mozilla/5.0 (X11; Linux x86_64)")
+	c.Set("user_id", 3)
+	c.Set("username", "alice")
+	c.Set("request_id", "req-123")
+	c.Set("api_key", &tokens.APIKeyIdentity{KeyID: 9, UserID: 3})
+
+	Record(c, Event{
+		Action:      URLDelete,
+		TargetType:  TargetURL,
+		TargetIDs:   []int{7, 8},
+		WorkspaceID: 5,
+		Details:     map[string]interface{}{"urls": []string{"https://example.com/"}},
+	})
+
+	if len(store.rows) != 1 {
+		t.Fatalf("%d events recorded", len(store.rows))
+	}
+	want := map[string]driver.Value{
+		"actor_id":        int64(3),
+		"actor":           "alice",
+		"api_key_id":      int64(9),
+		"action":          "url.delete",
+		"target_type":     "url",
+		"target_ids":      "[7,8]",
+		"workspace_id":    int64(5),
+		"organization_id": nil,
+		"details":         `{"urls":["https://example.com/"]}`,
+		"ip":              "203.0.113.9",
+		"user_agent":      "Mozilla/5.0 (X11; Linux x86_64)",
+		"request_id":      "req-123",
+	}
+	if !reflect.DeepEqual(store.rows[0], want) {
+		t.Errorf("got %v\nwant %v", store.rows[0], want)
+	}
+}
+
+func TestRecordExplicitActor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := useEventStore(t)
+
+	// A login has no user in the context yet, and user agents are capped at
+	// the column width
+	c := newContext(strings.Repeat("x", 300))
+	Record(c, Event{Action: LoginFailed, Actor: "mallory"})
+	Record(c, Event{Action: MemberLeave, ActorID: 4, Actor: "bob", TargetType: TargetUser, TargetIDs: []int{4}, OrganizationID: 2})
+
+	if len(store.rows) != 2 {
+		t.Fatalf("%d events recorded", len(store.rows))
+	}
+	failed, left := store.rows[0], store.rows[1]
+	if failed["actor_id"] != nil || failed["actor"] != "mallory" || failed["api_key_id"] != nil {
+		t.Errorf("failed login recorded as %v", failed)
+	}
+	if failed["target_ids"] != nil || failed["details"] != nil || failed["workspace_id"] != nil {
+		t.Errorf("empty fields recorded as %v", failed)
+	}
+	if len(failed["user_agent"].(string)) != 255 {
+		t.Errorf("user agent of %d bytes recorded", len(failed["user_agent"].(string)))
+	}
+	if left["actor_id"] != int64(4) || left["organization_id"] != int64(2) || left["target_ids"] != "[4]" {
+		t.Errorf("member event recorded as %v", left)
+	}
+}
@@ -0,0 +1,104 @@
+// Package authz decides what members of an organization may do with its
+// workspaces. Every member has one role per organization; permissions are
+// granted to roles, never to individual users.
+package authz
+
+import "strings"
+
+// Role is a member's role in an organization.
+type Role string
+
+const (
+	// RoleViewer can read URLs and crawl results.
+	RoleViewer Role = "viewer"
+	// RoleEditor can also add URLs and start, stop, rerun and delete crawls.
+	RoleEditor Role = "editor"
+	// RoleAdmin can also manage members, invitations and workspaces, and
+	// read the audit log of its workspaces.
+	RoleAdmin Role = "admin"
+)
+
+// Roles lists every role from least to most privileged.
+var Roles = []Role{RoleViewer, RoleEditor, RoleAdmin}
+
+// Permission is an action on an organization or its workspaces.
+type Permission string
+
+const (
+	ViewURLs     Permission = "urls:view"
+	ManageCrawls Permission = "crawls:manage"
+	ViewOrg      Permission = "org:view"
+	ManageOrg    Permission = "org:manage"
+	ViewAudit    Permission = "audit:view"
+)
+
+var grants = map[Permission][]Role{
+	ViewURLs:     {RoleViewer, RoleEditor, RoleAdmin},
+	ManageCrawls: {RoleEditor, RoleAdmin},
+	ViewOrg:      {RoleViewer, RoleEditor, RoleAdmin},
+	ManageOrg:    {RoleAdmin},
+	ViewAudit:    {RoleAdmin},
+}
+
+// DeniedMessage is the error shown when a role lacks a permission.
+const DeniedMessage = "Your role does not allow this"
+
+// Can reports whether the role has the permission. The empty role, used
+// for non-members, has none.
+func (r Role) Can(p Permission) bool {
+	for _, granted := range grants[p] {
+		if granted == r {
+			return true
+		}
+	}
+	return false
+}
+
+// Valid reports whether r is one of Roles.
+func (r Role) Valid() bool {
+	for _, role := range Roles {
+		if role == r {
+			return true
+		}
+	}
+	return false
+}
+
+// rank orders roles for picking the strongest of several memberships.
+func (r Role) rank() int {
+	for i, role := range Roles {
+		if role == r {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// WorkspacesWith selects the IDs of the workspaces in which a user has the
+// permission. It takes the user ID as its only parameter.
+func WorkspacesWith(p Permission) string {
+	return `
+	SELECT w.id FROM workspaces w
+	JOIN organization_members m ON m.organization_id = w.organization_id
+	WHERE m.user_id = ? AND m.role IN (` + grantedRoles(p) + `)`
+}
+
+// OrganizationsWith selects the IDs of the organizations in which a user has
+// the permission. It takes the user ID as its only parameter.
+func OrganizationsWith(p Permission) string {
+	return `
+	SELECT m.organization_id FROM organization_members m
+	WHERE m.user_id = ? AND m.role IN (` + grantedRoles(p) + `)`
+}
+
+// grantedRoles lists the roles with the permission as SQL literals.
+func grantedRoles(p Permission) string {
+	roles := make([]string, 0, len(grants[p]))
+	for _, role := range grants[p] {
+		roles = append(roles, "'"+string(role)+"'")
+	}
+	if len(roles) == 0 {
+		roles = append(roles, "NULL")
+	}
+	return strings.Join(roles, ", ")
+}
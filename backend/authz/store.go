@@ -0,0 +1,93 @@
+package authz
+
+import (
+	"database/sql"
+
+	"webcrawler/database"
+)
+
+// Store looks up roles. Each lookup returns the empty role when the user is
+// not a member or the resource does not exist.
+type Store interface {
+	OrgRole(userID, orgID int) (Role, error)
+	WorkspaceRole(userID, workspaceID int) (Role, error)
+	URLRole(userID, urlID int) (Role, error)
+	// HighestRole is the strongest role the user has in any organization.
+	HighestRole(userID int) (Role, error)
+	// IsSystemAdmin reports whether the user administers the whole system,
+	// which is separate from any organization role.
+	IsSystemAdmin(userID int) (bool, error)
+}
+
+var store Store = dbStore{}
+
+// Use replaces the role store, e.g. with a fake in tests.
+func Use(s Store) {
+	store = s
+}
+
+// Lookup returns the store in use.
+func Lookup() Store {
+	return store
+}
+
+type dbStore struct{}
+
+func (dbStore) OrgRole(userID, orgID int) (Role, error) {
+	return queryRole("SELECT role FROM organization_members WHERE user_id = ? AND organization_id = ?", userID, orgID)
+}
+
+func (dbStore) WorkspaceRole(userID, workspaceID int) (Role, error) {
+	return queryRole(`
+		SELECT m.role FROM workspaces w
+		JOIN organization_members m ON m.organization_id = w.organization_id
+		WHERE m.user_id = ? AND w.id = ?
+	`, userID, workspaceID)
+}
+
+func (dbStore) URLRole(userID, urlID int) (Role, error) {
+	return queryRole(`
+		SELECT m.role FROM urls u
+		JOIN workspaces w ON w.id = u.workspace_id
+		JOIN organization_members m ON m.organization_id = w.organization_id
+		WHERE m.user_id = ? AND u.id = ?
+	`, userID, urlID)
+}
+
+func (dbStore) HighestRole(userID int) (Role, error) {
+	rows, err := database.DB.Query("SELECT DISTINCT role FROM organization_members WHERE user_id = ?", userID)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	var highest Role
+	for rows.Next() {
+		var role Role
+		if err := rows.Scan(&role); err != nil {
+			return "", err
+		}
+		if role.rank() > highest.rank() {
+			highest = role
+		}
+	}
+	return highest, rows.Err()
+}
+
+func (dbStore) IsSystemAdmin(userID int) (bool, error) {
+	var isAdmin bool
+	err := database.DB.QueryRow("SELECT is_admin FROM users WHERE id = ?", userID).Scan(&isAdmin)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return isAdmin, err
+}
+
+func queryRole(query string, args ...interface{}) (Role, error) {
+	var role Role
+	err := database.DB.QueryRow(query, args...).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return role, err
+}
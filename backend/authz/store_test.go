@@ -0,0 +1,175 @@
+package authz
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"webcrawler/database"
+)
+
+type membership struct {
+	userID, orgID int
+}
+
+// roleStore stands in for the organization_members, workspaces, urls and
+// users rows that dbStore reads.
+type roleStore struct {
+	members map[membership]Role
+	// workspaces maps workspace IDs to organization IDs
+	workspaces map[int]int
+	// urls maps URL IDs to workspace IDs
+	urls   map[int]int
+	admins map[int]bool
+}
+
+func (s *roleStore) Connect(context.Context) (driver.Conn, error) { return s, nil }
+func (s *roleStore) Driver() driver.Driver                        { return nil }
+
+func (s *roleStore) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements not supported")
+}
+func (s *roleStore) Close() error              { return nil }
+func (s *roleStore) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+func (s *roleStore) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	query = strings.Join(strings.Fields(query), " ")
+	arg := func(i int) int { return int(args[i].Value.(int64)) }
+
+	rows := &fakeRows{column: "role"}
+	role := func(userID, orgID int, ok bool) {
+		if r, member := s.members[membership{userID, orgID}]; ok && member {
+			rows.values = append(rows.values, string(r))
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(query, "SELECT role FROM organization_members"):
+		role(arg(0), arg(1), true)
+	case strings.HasPrefix(query, "SELECT m.role FROM workspaces w"):
+		orgID, ok := s.workspaces[arg(1)]
+		role(arg(0), orgID, ok)
+	case strings.HasPrefix(query, "SELECT m.role FROM urls u"):
+		workspaceID, ok := s.urls[arg(1)]
+		orgID, inOrg := s.workspaces[workspaceID]
+		role(arg(0), orgID, ok && inOrg)
+	case strings.HasPrefix(query, "SELECT DISTINCT role FROM organization_members"):
+		seen := map[Role]bool{}
+		for m, r := range s.members {
+			if m.userID == arg(0) && !seen[r] {
+				seen[r] = true
+				rows.values = append(rows.values, string(r))
+			}
+		}
+	case strings.HasPrefix(query, "SELECT is_admin FROM users"):
+		rows.column = "is_admin"
+		if isAdmin, ok := s.admins[arg(0)]; ok {
+			rows.values = append(rows.values, isAdmin)
+		}
+	default:
+		return nil, errors.New("unexpected query: " + query)
+	}
+	return rows, nil
+}
+
+type fakeRows struct {
+	column string
+	values []driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return []string{r.column} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	dest[0] = r.values[0]
+	r.values = r.values[1:]
+	return nil
+}
+
+func useRoleStore(t *testing.T) {
+	t.Helper()
+	s := &roleStore{
+		members: map[membership]Role{
+			{1, 10}: RoleAdmin,
+			{2, 10}: RoleViewer,
+			{2, 20}: RoleEditor,
+		},
+		workspaces: map[int]int{100: 10, 200: 20},
+		urls:       map[int]int{1000: 100, 2000: 200},
+		admins:     map[int]bool{1: false, 2: false, 3: true},
+	}
+
+	saved := database.DB
+	database.DB = sql.OpenDB(s)
+	t.Cleanup(func() {
+		database.DB.Close()
+		database.DB = saved
+	})
+}
+
+func TestDBStore(t *testing.T) {
+	useRoleStore(t)
+	s := dbStore{}
+
+	tests := []struct {
+		name   string
+		lookup func() (Role, error)
+		want   Role
+	}{
+		{"org admin", func() (Role, error) { return s.OrgRole(1, 10) }, RoleAdmin},
+		{"org viewer", func() (Role, error) { return s.OrgRole(2, 10) }, RoleViewer},
+		{"not an org member", func() (Role, error) { return s.OrgRole(1, 20) }, ""},
+		{"workspace", func() (Role, error) { return s.WorkspaceRole(2, 200) }, RoleEditor},
+		{"other org's workspace", func() (Role, error) { return s.WorkspaceRole(1, 200) }, ""},
+		{"missing workspace", func() (Role, error) { return s.WorkspaceRole(1, 999) }, ""},
+		{"url", func() (Role, error) { return s.URLRole(2, 1000) }, RoleViewer},
+		{"other org's url", func() (Role, error) { return s.URLRole(1, 2000) }, ""},
+		{"missing url", func() (Role, error) { return s.URLRole(1, 9999) }, ""},
+		{"highest of several", func() (Role, error) { return s.HighestRole(2) }, RoleEditor},
+		{"highest without memberships", func() (Role, error) { return s.HighestRole(3) }, ""},
+	}
+	for _, tt := range tests {
+		got, err := tt.lookup()
+		if err != nil || got != tt.want {
+			t.Errorf("%s: got (%q, %v), want %q", tt.name, got, err, tt.want)
+		}
+	}
+
+	// System administration is separate from organization roles
+	for userID, want := range map[int]bool{1: false, 3: true, 4: false} {
+		if got, err := s.IsSystemAdmin(userID); err != nil || got != want {
+			t.Errorf("IsSystemAdmin(%d) = (%v, %v), want %v", userID, got, err, want)
+		}
+	}
+}
+
+func TestCan(t *testing.T) {
+	tests := []struct {
+		role Role
+		can  []Permission
+	}{
+		{RoleViewer, []Permission{ViewURLs, ViewOrg}},
+		{RoleEditor, []Permission{ViewURLs, ViewOrg, ManageCrawls}},
+		{RoleAdmin, []Permission{ViewURLs, ViewOrg, ManageCrawls, ManageOrg, ViewAudit}},
+		{"", nil},
+		{"owner", nil},
+	}
+	for _, tt := range tests {
+		for p := range grants {
+			want := false
+			for _, granted := range tt.can {
+				want = want || granted == p
+			}
+			if got := tt.role.Can(p); got != want {
+				t.Errorf("%q.Can(%s) = %v, want %v", tt.role, p, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package authz
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrInvalidID is returned by a Target when the request names its resource
+// with a malformed ID.
+var ErrInvalidID = errors.New("invalid ID")
+
+// Target finds the resource a request acts on and the user's role for it.
+type Target struct {
+	// Noun names the resource in error messages, e.g. "URL".
+	Noun string
+	role func(c *gin.Context, userID int) (Role, error)
+}
+
+// Role returns the user's role for the request's resource.
+func (t Target) Role(c *gin.Context, userID int) (Role, error) {
+	return t.role(c, userID)
+}
+
+// URLParam targets the URL whose ID is in the named path parameter.
+func URLParam(name string) Target {
+	return Target{Noun: "URL", role: func(c *gin.Context, userID int) (Role, error) {
+		id, err := strconv.Atoi(c.Param(name))
+		if err != nil {
+			return "", ErrInvalidID
+		}
+		return store.URLRole(userID, id)
+	}}
+}
+
+// OrgParam targets the organization whose ID is in the named path parameter.
+func OrgParam(name string) Target {
+	return Target{Noun: "Organization", role: func(c *gin.Context, userID int) (Role, error) {
+		id, err := strconv.Atoi(c.Param(name))
+		if err != nil {
+			return "", ErrInvalidID
+		}
+		return store.OrgRole(userID, id)
+	}}
+}
+
+// WorkspaceQuery targets the workspace named by a query parameter. Without
+// the parameter the request spans all of the user's workspaces, like
+// AnyWorkspace.
+func WorkspaceQuery(name string) Target {
+	return Target{Noun: "Workspace", role: func(c *gin.Context, userID int) (Role, error) {
+		value := c.Query(name)
+		if value == "" {
+			return store.HighestRole(userID)
+		}
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return "", ErrInvalidID
+		}
+		return store.WorkspaceRole(userID, id)
+	}}
+}
+
+// AnyWorkspace is for requests that name their workspaces in the body, such
+// as bulk actions. It passes when the user has the permission somewhere;
+// the handler then limits itself to WorkspacesWith the permission.
+var AnyWorkspace = Target{Noun: "Workspace", role: func(c *gin.Context, userID int) (Role, error) {
+	return store.HighestRole(userID)
+}}
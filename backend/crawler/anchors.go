@@ -0,0 +1,125 @@
+package crawler
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"webcrawler/models"
+
+	"golang.org/x/net/html"
+)
+
+// maxAnchorDocuments caps how many other pages are fetched per crawl to
+// check fragment anchors.
+const maxAnchorDocuments = 50
+
+// anchorRef is an internal link with a fragment, e.g. /docs#install.
+type anchorRef struct {
+	URL      string // the link as written, resolved against the page
+	Document string // canonical URL of the linked document
+	Fragment string
+}
+
+// collectAnchorTargets records the element IDs and named anchors a fragment
+// can point at.
+func collectAnchorTargets(n *html.Node, anchors map[string]bool) {
+	if id := getAttr(n, "id"); id != "" {
+		anchors[id] = true
+	}
+	if n.Data == "a" {
+		if name := getAttr(n, "name"); name != "" {
+			anchors[name] = true
+		}
+	}
+}
+
+// addAnchorRef remembers a link's fragment for checkAnchors. Fragments used
+// for client-side routing or text highlighting are not element references
+// and are skipped.
+func addAnchorRef(data *CrawlData, resolved, document, fragment string) {
+	if i := strings.Index(fragment, ":~:"); i >= 0 {
+		fragment = fragment[:i]
+	}
+	if fragment == "" || strings.HasPrefix(fragment, "!") || strings.HasPrefix(fragment, "/") || strings.Contains(fragment, "=") {
+		return
+	}
+
+	key := document + "#" + fragment
+	if data.seenAnchorRefs[key] {
+		return
+	}
+	data.seenAnchorRefs[key] = true
+	data.anchorRefs = append(data.anchorRefs, anchorRef{URL: resolved, Document: document, Fragment: fragment})
+}
+
+// checkAnchors reports fragment links whose target document has no element
+// with a matching id or name. Links to the crawled page use its own anchors;
+// other internal pages are fetched once each.
+func checkAnchors(data *CrawlData, s *session, pageURL string) {
+	if len(data.anchorRefs) == 0 {
+		return
+	}
+
+	documents := map[string]map[string]bool{canonicalKey(pageURL): data.anchors}
+
+	// Links that are already broken are not checked again
+	broken := make(map[string]bool)
+	for _, link := range data.BrokenLinks {
+		broken[canonicalKey(link.URL)] = true
+	}
+
+	for _, ref := range data.anchorRefs {
+		if broken[ref.Document] {
+			continue
+		}
+
+		anchors, fetched := documents[ref.Document]
+		if !fetched {
+			if len(documents) > maxAnchorDocuments {
+				continue
+			}
+			anchors = s.documentAnchors(ref.URL)
+			documents[ref.Document] = anchors
+		}
+
+		// A missing "top" fragment scrolls to the top of the page
+		if anchors == nil || anchors[ref.Fragment] || strings.EqualFold(ref.Fragment, "top") {
+			continue
+		}
+
+		data.BrokenLinks = append(data.BrokenLinks, models.BrokenLink{
+			URL:          ref.URL,
+			StatusCode:   200,
+			ErrorMessage: fmt.Sprintf("Anchor %q not found", "#"+ref.Fragment),
+			Kind:         LinkMissingAnchor,
+			Attempts:     1,
+			ErrorClass:   ErrorClassMissingAnchor,
+		})
+	}
+}
+
+// documentAnchors fetches an internal page and returns its anchors, or nil if
+// the page cannot be loaded as HTML.
+func (s *session) documentAnchors(target string) map[string]bool {
+	doc, _, err := s.fetchDocument(http.MethodGet, target, nil)
+	if err != nil {
+		log.Printf("Skipping anchor check for %s: %v", target, err)
+		return nil
+	}
+
+	anchors := make(map[string]bool)
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			collectAnchorTargets(n, anchors)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	return anchors
+}
@@ -0,0 +1,278 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"webcrawler/models"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// proxyFunc picks the proxy for a request URL; nil means connect directly.
+type proxyFunc func(*url.URL) (*url.URL, error)
+
+type proxyContextKey struct{}
+
+type chosenProxyKey struct{}
+
+// transport is shared by every crawler request so all connections pass the
+// network guard.
+var transport = newTransport()
+
+// globalProxy applies to requests whose crawl profile has no proxy settings.
+var globalProxy proxyFunc
+
+// crawlTransport sends direct and proxied requests over separate pools, so
+// that only connections to a proxy are dialed as the proxy hop. A crawl
+// target that happens to share a proxy's address gets no exemption.
+type crawlTransport struct {
+	direct  *http.Transport
+	proxied *http.Transport
+}
+
+// newTransport builds the crawler-wide transport: pooled keep-alive
+// connections with a per-host cap, HTTP/2 and transparent gzip.
+func newTransport() *crawlTransport {
+	direct := newPool(guard.DialContext)
+	proxied := newPool(guard.DialProxy)
+	proxied.Proxy = func(req *http.Request) (*url.URL, error) {
+		return req.Context().Value(chosenProxyKey{}).(*url.URL), nil
+	}
+	return &crawlTransport{direct: direct, proxied: proxied}
+}
+
+func newPool(dial func(context.Context, string, string) (net.Conn, error)) *http.Transport {
+	return &http.Transport{
+		DialContext:           dial,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   config.MaxConnsPerHost,
+		MaxConnsPerHost:       config.MaxConnsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+func (t *crawlTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	proxyURL, err := proxyForRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	if proxyURL == nil {
+		return t.direct.RoundTrip(req)
+	}
+	return t.proxied.RoundTrip(req.WithContext(context.WithValue(req.Context(), chosenProxyKey{}, proxyURL)))
+}
+
+func (t *crawlTransport) CloseIdleConnections() {
+	t.direct.CloseIdleConnections()
+	t.proxied.CloseIdleConnections()
+}
+
+// newClient builds an HTTP client on the shared transport.
+func newClient(timeout time.Duration, maxRedirects int) *http.Client {
+	return &http.Client{
+		Transport:     transport,
+		Timeout:       timeout,
+		CheckRedirect: limitRedirects(maxRedirects),
+	}
+}
+
+var errTooManyRedirects = errors.New("too many redirects")
+
+func limitRedirects(max int) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) >= max {
+			return fmt.Errorf("%w: stopped after %d redirects", errTooManyRedirects, max)
+		}
+		return nil
+	}
+}
+
+// withProxy attaches a crawl's proxy choice to a request.
+func withProxy(req *http.Request, proxy proxyFunc) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), proxyContextKey{}, proxy))
+}
+
+func proxyForRequest(req *http.Request) (*url.URL, error) {
+	choose := globalProxy
+	if proxy, ok := req.Context().Value(proxyContextKey{}).(proxyFunc); ok {
+		choose = proxy
+	}
+	if choose == nil {
+		return nil, nil
+	}
+
+	proxyURL, err := choose(req.URL)
+	if err != nil || proxyURL == nil {
+		return nil, err
+	}
+
+	// The proxy resolves the target itself, so check it before handing it over
+	if err := guard.checkHost(req.Context(), req.URL.Hostname()); err != nil {
+		return nil, err
+	}
+
+	return proxyURL, nil
+}
+
+// proxyPool rotates requests round-robin across a list of proxies, skipping
+// hosts on the no-proxy list.
+type proxyPool struct {
+	proxies []*url.URL
+	bypass  func(*url.URL) (*url.URL, error)
+	next    atomic.Uint64
+}
+
+func newProxyPool(proxyURLs []string, username, password string, noProxy []string) (*proxyPool, error) {
+	pool := &proxyPool{}
+
+	for _, raw := range proxyURLs {
+		proxyURL, err := parseProxyURL(raw)
+		if err != nil {
+			return nil, err
+		}
+		if username != "" {
+			proxyURL.User = url.UserPassword(username, password)
+		}
+		pool.proxies = append(pool.proxies, proxyURL)
+	}
+
+	// httpproxy implements NO_PROXY matching; any non-nil result from this
+	// config means the host is not excluded
+	const placeholder = "http://proxy.invalid"
+	pool.bypass = (&httpproxy.Config{
+		HTTPProxy:  placeholder,
+		HTTPSProxy: placeholder,
+		NoProxy:    strings.Join(noProxy, ","),
+	}).ProxyFunc()
+
+	return pool, nil
+}
+
+func (p *proxyPool) proxyFor(target *url.URL) (*url.URL, error) {
+	if len(p.proxies) == 0 {
+		return nil, nil
+	}
+
+	if use, err := p.bypass(target); err != nil || use == nil {
+		return nil, err
+	}
+
+	i := p.next.Add(1) - 1
+	return p.proxies[i%uint64(len(p.proxies))], nil
+}
+
+func parseProxyURL(raw string) (*url.URL, error) {
+	proxyURL, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL %q: %v", raw, err)
+	}
+
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", proxyURL.Scheme)
+	}
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q: missing host", raw)
+	}
+
+	return proxyURL, nil
+}
+
+// newGlobalProxy builds the default proxy selection from CRAWLER_PROXY /
+// CRAWLER_PROXY_POOL, falling back to the standard HTTP_PROXY variables. It
+// also returns the proxies' host:port addresses.
+func newGlobalProxy(cfg Config) (proxyFunc, []string, error) {
+	proxyURLs := cfg.ProxyPool
+	if cfg.Proxy != "" {
+		proxyURLs = append([]string{cfg.Proxy}, proxyURLs...)
+	}
+
+	if len(proxyURLs) == 0 {
+		env := httpproxy.FromEnvironment()
+		if env.HTTPProxy == "" && env.HTTPSProxy == "" {
+			return nil, nil, nil
+		}
+
+		var addrs []string
+		for _, raw := range []string{env.HTTPProxy, env.HTTPSProxy} {
+			// Like httpproxy, take addresses without a scheme as HTTP proxies
+			if !strings.Contains(raw, "://") {
+				raw = "http://" + raw
+			}
+			if proxyURL, err := url.Parse(raw); err == nil && proxyURL.Hostname() != "" {
+				addrs = append(addrs, proxyAddr(proxyURL))
+			}
+		}
+		return env.ProxyFunc(), addrs, nil
+	}
+
+	pool, err := newProxyPool(proxyURLs, "", "", cfg.NoProxy)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var addrs []string
+	for _, proxyURL := range pool.proxies {
+		addrs = append(addrs, proxyAddr(proxyURL))
+	}
+	return pool.proxyFor, addrs, nil
+}
+
+var proxyDefaultPorts = map[string]string{
+	"http":    "80",
+	"https":   "443",
+	"socks5":  "1080",
+	"socks5h": "1080",
+}
+
+// proxyAddr returns the address the transport dials for a proxy.
+func proxyAddr(proxyURL *url.URL) string {
+	port := proxyURL.Port()
+	if port == "" {
+		port = proxyDefaultPorts[proxyURL.Scheme]
+	}
+	return strings.ToLower(net.JoinHostPort(proxyURL.Hostname(), port))
+}
+
+// profileProxy returns the proxy selection for a crawl profile, or nil to use
+// the global proxy settings.
+func profileProxy(settings *models.ProxySettings) (proxyFunc, error) {
+	if settings == nil {
+		return nil, nil
+	}
+
+	if settings.Direct {
+		return func(*url.URL) (*url.URL, error) { return nil, nil }, nil
+	}
+	if len(settings.URLs) == 0 {
+		return nil, nil
+	}
+
+	pool, err := newProxyPool(settings.URLs, settings.Username, settings.Password, settings.NoProxy)
+	if err != nil {
+		return nil, err
+	}
+	return pool.proxyFor, nil
+}
+
+// ValidateProfile checks the parts of a crawl profile that can only be
+// verified by the crawler, such as proxy URLs.
+func ValidateProfile(profile *models.CrawlProfile) error {
+	if profile == nil || profile.Proxy == nil {
+		return nil
+	}
+	_, err := profileProxy(profile.Proxy)
+	return err
+}
@@ -0,0 +1,336 @@
+package crawler
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"webcrawler/models"
+)
+
+// testProxy is a forward proxy that answers plain HTTP requests itself and
+// tunnels CONNECT requests to upstream.
+type testProxy struct {
+	*httptest.Server
+	name     string
+	auth     string
+	upstream string
+	hits     atomic.Int32
+}
+
+func newTestProxy(t *testing.T, name, username, password string) *testProxy {
+	t.Helper()
+	p := &testProxy{name: name}
+	if username != "" {
+		p.auth = "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+	}
+
+	p.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p.auth != "" && r.Header.Get("Proxy-Authorization") != p.auth {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		p.hits.Add(1)
+
+		if r.Method != http.MethodConnect {
+			io.WriteString(w, p.name+" "+r.URL.Host)
+			return
+		}
+
+		upstream, err := net.Dial("tcp", p.upstream)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			upstream.Close()
+			return
+		}
+		io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+		go func() {
+			io.Copy(upstream, conn)
+			upstream.Close()
+		}()
+		io.Copy(conn, upstream)
+		conn.Close()
+	}))
+	t.Cleanup(p.Close)
+	return p
+}
+
+// useProxyTestNetwork lets the crawler reach the local proxies while the
+// crawled hosts resolve to public addresses.
+func useProxyTestNetwork(t *testing.T, records map[string]string) {
+	t.Helper()
+	savedGuard, savedTransport, savedProxy := guard, transport, globalProxy
+	guard = testGuard([]string{"127.0.0.0/8"}, records)
+	transport = newTransport()
+	t.Cleanup(func() {
+		transport.CloseIdleConnections()
+		guard, transport, globalProxy = savedGuard, savedTransport, savedProxy
+	})
+}
+
+// fetch requests target through a session of profile and returns the body.
+func fetch(t *testing.T, profile models.CrawlProfile, target string) (string, error) {
+	t.Helper()
+	s := newTestSession(t, target, profile)
+	req, err := s.newRequest(http.MethodGet, target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := s.pageClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.New(resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	return string(body), err
+}
+
+func TestProfileProxyOverridesGlobal(t *testing.T) {
+	direct := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "direct")
+	}))
+	defer direct.Close()
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(direct.URL, "http://"))
+
+	useProxyTestNetwork(t, map[string]string{
+		"site.test":   "93.184.216.34",
+		"direct.test": "127.0.0.1",
+	})
+	global := newTestProxy(t, "global", "", "")
+	own := newTestProxy(t, "own", "", "")
+	globalProxy, _ = profileProxy(&models.ProxySettings{URLs: []string{global.URL}})
+
+	tests := []struct {
+		name    string
+		profile models.CrawlProfile
+		target  string
+		want    string
+	}{
+		{"no profile proxy", models.CrawlProfile{}, "http://site.test/", "global site.test"},
+		{"profile proxy", models.CrawlProfile{Proxy: &models.ProxySettings{URLs: []string{own.URL}}}, "http://site.test/", "own site.test"},
+		{"direct", models.CrawlProfile{Proxy: &models.ProxySettings{Direct: true}}, "http://direct.test:" + port + "/", "direct"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := fetch(t, tt.profile, tt.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProxyAuth(t *testing.T) {
+	useProxyTestNetwork(t, map[string]string{"site.test": "93.184.216.34"})
+	proxy := newTestProxy(t, "proxy", "alice", "s3cret")
+
+	profile := models.CrawlProfile{Proxy: &models.ProxySettings{
+		URLs:     []string{proxy.URL},
+		Username: "alice",
+		Password: "s3cret",
+	}}
+	if got, err := fetch(t, profile, "http://site.test/"); err != nil || got != "proxy site.test" {
+		t.Errorf("got (%q, %v)", got, err)
+	}
+
+	profile.Proxy.Password = "wrong"
+	if _, err := fetch(t, profile, "http://site.test/"); err == nil {
+		t.Error("request with the wrong proxy password succeeded")
+	}
+}
+
+func TestProxyConnectTunnel(t *testing.T) {
+	// httptest certificates are issued for example.com
+	site := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "tunneled "+r.Host)
+	}))
+	defer site.Close()
+
+	useProxyTestNetwork(t, map[string]string{"example.com": "93.184.216.34"})
+	roots := x509.NewCertPool()
+	roots.AddCert(site.Certificate())
+	transport.proxied.TLSClientConfig = &tls.Config{RootCAs: roots}
+
+	proxy := newTestProxy(t, "proxy", "alice", "s3cret")
+	proxy.upstream = site.Listener.Addr().String()
+
+	profile := models.CrawlProfile{Proxy: &models.ProxySettings{
+		URLs:     []string{proxy.URL},
+		Username: "alice",
+		Password: "s3cret",
+	}}
+	got, err := fetch(t, profile, "https://example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "tunneled example.com" {
+		t.Errorf("got %q", got)
+	}
+	if proxy.hits.Load() != 1 {
+		t.Errorf("proxy saw %d CONNECT requests, want 1", proxy.hits.Load())
+	}
+}
+
+func TestProxyRotation(t *testing.T) {
+	useProxyTestNetwork(t, map[string]string{"site.test": "93.184.216.34"})
+	first := newTestProxy(t, "first", "", "")
+	second := newTestProxy(t, "second", "", "")
+
+	s := newTestSession(t, "http://site.test/", models.CrawlProfile{Proxy: &models.ProxySettings{
+		URLs: []string{first.URL, second.URL},
+	}})
+
+	var got []string
+	for range 4 {
+		req, _ := s.newRequest(http.MethodGet, "http://site.test/", nil)
+		resp, err := s.pageClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		got = append(got, strings.Fields(string(body))[0])
+	}
+
+	if want := "first second first second"; strings.Join(got, " ") != want {
+		t.Errorf("proxies used: %v, want %s", got, want)
+	}
+}
+
+func TestNoProxy(t *testing.T) {
+	direct := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "direct")
+	}))
+	defer direct.Close()
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(direct.URL, "http://"))
+
+	useProxyTestNetwork(t, map[string]string{
+		"site.test":          "93.184.216.34",
+		"intranet.corp.test": "127.0.0.1",
+		"corp.test":          "127.0.0.1",
+		"other.test":         "93.184.216.34",
+	})
+	proxy := newTestProxy(t, "proxy", "", "")
+	profile := models.CrawlProfile{Proxy: &models.ProxySettings{
+		URLs:    []string{proxy.URL},
+		NoProxy: []string{".corp.test", "other.test:8443"},
+	}}
+
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"http://site.test/", "proxy site.test"},
+		{"http://intranet.corp.test:" + port + "/", "direct"},
+		// A leading dot only matches subdomains
+		{"http://corp.test/", "proxy corp.test"},
+		// Port-qualified entries only bypass that port
+		{"http://other.test/", "proxy other.test"},
+	}
+
+	for _, tt := range tests {
+		got, err := fetch(t, profile, tt.target)
+		if err != nil {
+			t.Errorf("%s: %v", tt.target, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestProxiedTargetIsChecked(t *testing.T) {
+	useProxyTestNetwork(t, map[string]string{"internal.test": "10.0.0.1"})
+	proxy := newTestProxy(t, "proxy", "", "")
+
+	profile := models.CrawlProfile{Proxy: &models.ProxySettings{URLs: []string{proxy.URL}}}
+	_, err := fetch(t, profile, "http://internal.test/")
+	var blocked *BlockedAddressError
+	if !errors.As(err, &blocked) {
+		t.Errorf("got %v, want a blocked address error", err)
+	}
+	if proxy.hits.Load() != 0 {
+		t.Error("request for an internal host was sent to the proxy")
+	}
+}
+
+func TestOnlyProxyHopIsTrusted(t *testing.T) {
+	records := map[string]string{
+		"site.test":     "93.184.216.34",
+		"internal.test": "127.0.0.1",
+	}
+	useProxyTestNetwork(t, records)
+	configured := newTestProxy(t, "configured", "", "")
+	untrusted := newTestProxy(t, "untrusted", "", "")
+
+	// Only the configured proxy is trusted; loopback is not allowed otherwise
+	guard = testGuard(nil, records)
+	configuredURL, _ := url.Parse(configured.URL)
+	guard.trustProxies([]string{proxyAddr(configuredURL)})
+	transport = newTransport()
+	globalProxy, _ = profileProxy(&models.ProxySettings{URLs: []string{configured.URL}})
+
+	if got, err := fetch(t, models.CrawlProfile{}, "http://site.test/"); err != nil || got != "configured site.test" {
+		t.Fatalf("through the configured proxy: got (%q, %v)", got, err)
+	}
+
+	tests := []struct {
+		name    string
+		profile models.CrawlProfile
+		target  string
+	}{
+		{"internal target through the proxy", models.CrawlProfile{}, "http://internal.test/"},
+		{"proxy address as a target", models.CrawlProfile{Proxy: &models.ProxySettings{Direct: true}}, configured.URL + "/"},
+		{"untrusted profile proxy", models.CrawlProfile{Proxy: &models.ProxySettings{URLs: []string{untrusted.URL}}}, "http://site.test/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := fetch(t, tt.profile, tt.target)
+			var blocked *BlockedAddressError
+			if !errors.As(err, &blocked) {
+				t.Errorf("got %v, want a blocked address error", err)
+			}
+		})
+	}
+	if configured.hits.Load() != 1 || untrusted.hits.Load() != 0 {
+		t.Errorf("proxy hits: configured %d, untrusted %d", configured.hits.Load(), untrusted.hits.Load())
+	}
+}
+
+func TestProxyAddr(t *testing.T) {
+	tests := map[string]string{
+		"http://Proxy.Example:3128": "proxy.example:3128",
+		"http://proxy.example":      "proxy.example:80",
+		"https://proxy.example":     "proxy.example:443",
+		"socks5://user:pw@10.0.0.1": "10.0.0.1:1080",
+		"http://[fd00::1]:8080":     "[fd00::1]:8080",
+	}
+	for raw, want := range tests {
+		proxyURL, _ := url.Parse(raw)
+		if got := proxyAddr(proxyURL); got != want {
+			t.Errorf("proxyAddr(%s) = %s, want %s", raw, got, want)
+		}
+	}
+}
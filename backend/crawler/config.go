@@ -0,0 +1,142 @@
+package crawler
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"webcrawler/models"
+)
+
+// Config holds crawler settings loaded from the environment.
+type Config struct {
+	// AllowedHosts are hostnames (exact, or "*.suffix") and CIDR ranges that
+	// bypass the private network guard, e.g. internal staging hosts.
+	AllowedHosts []string
+
+	// MaxBodyBytes caps how much of a response body is read.
+	MaxBodyBytes int64
+
+	// UserAgent is sent when a crawl profile does not set its own.
+	UserAgent string
+
+	// Proxy and ProxyPool route crawler traffic through HTTP(S) or SOCKS5
+	// proxies, rotating across all of them. Hosts in NoProxy connect directly.
+	Proxy     string
+	ProxyPool []string
+	NoProxy   []string
+
+	// MaxConnsPerHost caps concurrent connections to a single host.
+	MaxConnsPerHost int
+
+	// MaxConcurrentCrawls caps how many crawls run at once; the rest wait
+	// in line.
+	MaxConcurrentCrawls int
+
+	// DNSCacheTTL is how long resolved addresses are reused.
+	DNSCacheTTL time.Duration
+
+	// RetryAttempts is how many times a GET or HEAD request is tried before a
+	// transient failure is reported. Delays between attempts grow from
+	// RetryBaseDelay up to RetryMaxDelay, which also caps Retry-After.
+	RetryAttempts  int
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+
+	// Performance budgets; pages exceeding any of them are flagged. Zero
+	// disables a budget.
+	BudgetTTFBMs       int64
+	BudgetPageBytes    int64
+	BudgetTotalBytes   int64
+	BudgetSubresources int64
+}
+
+const defaultUserAgent = "WebCrawler/1.0"
+
+var config = Config{
+	MaxBodyBytes:        10 << 20,
+	UserAgent:           defaultUserAgent,
+	MaxConnsPerHost:     8,
+	MaxConcurrentCrawls: 10,
+	DNSCacheTTL:         time.Minute,
+	RetryAttempts:       3,
+	RetryBaseDelay:      500 * time.Millisecond,
+	RetryMaxDelay:       10 * time.Second,
+}
+
+// Init loads crawler configuration from the environment. It must be called
+// after environment variables are loaded and before any crawl starts.
+func Init() {
+	config = Config{
+		AllowedHosts: splitList(os.Getenv("CRAWLER_ALLOWED_HOSTS")),
+		MaxBodyBytes: getEnvInt64("CRAWLER_MAX_BODY_BYTES", 10<<20),
+		UserAgent:    getEnv("CRAWLER_USER_AGENT", defaultUserAgent),
+		Proxy:        os.Getenv("CRAWLER_PROXY"),
+		ProxyPool:    splitList(os.Getenv("CRAWLER_PROXY_POOL")),
+		NoProxy:      splitList(os.Getenv("CRAWLER_NO_PROXY")),
+
+		MaxConnsPerHost:     int(getEnvInt64("CRAWLER_MAX_CONNS_PER_HOST", 8)),
+		MaxConcurrentCrawls: int(getEnvInt64("CRAWLER_MAX_CONCURRENT_CRAWLS", 10)),
+		DNSCacheTTL:         time.Duration(getEnvInt64("CRAWLER_DNS_CACHE_TTL", 60)) * time.Second,
+
+		RetryAttempts:  int(getEnvInt64("CRAWLER_RETRY_ATTEMPTS", 3)),
+		RetryBaseDelay: time.Duration(getEnvInt64("CRAWLER_RETRY_BASE_DELAY_MS", 500)) * time.Millisecond,
+		RetryMaxDelay:  time.Duration(getEnvInt64("CRAWLER_RETRY_MAX_DELAY_MS", 10000)) * time.Millisecond,
+
+		BudgetTTFBMs:       getEnvInt64("CRAWLER_BUDGET_TTFB_MS", 0),
+		BudgetPageBytes:    getEnvInt64("CRAWLER_BUDGET_PAGE_BYTES", 0),
+		BudgetTotalBytes:   getEnvInt64("CRAWLER_BUDGET_TOTAL_BYTES", 0),
+		BudgetSubresources: getEnvInt64("CRAWLER_BUDGET_SUBRESOURCES", 0),
+	}
+
+	proxy, proxyAddrs, err := newGlobalProxy(config)
+	if err != nil {
+		log.Fatal("Invalid crawler proxy configuration:", err)
+	}
+	globalProxy = proxy
+
+	// Configured proxies may live on the internal network, but only the
+	// proxy hop itself may reach them
+	guard = newNetworkGuard(config.AllowedHosts, config.DNSCacheTTL)
+	guard.trustProxies(proxyAddrs)
+	transport = newTransport()
+
+	SetLimits(models.CrawlerLimits{
+		MaxConcurrentCrawls: config.MaxConcurrentCrawls,
+		MaxBodyBytes:        config.MaxBodyBytes,
+		RetryAttempts:       config.RetryAttempts,
+	})
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func getEnvInt64(key string, fallback int64) int64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n <= 0 {
+		log.Printf("Invalid value for %s: %q, using %d", key, value, fallback)
+		return fallback
+	}
+	return n
+}
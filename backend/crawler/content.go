@@ -0,0 +1,111 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+)
+
+// Crawl outcomes stored on crawl_results.outcome.
+const (
+	OutcomeHTML    = "html"
+	OutcomeNonHTML = "non_html"
+)
+
+// responseBody is a size-limited view of a response body.
+type responseBody struct {
+	MediaType   string
+	ContentType string
+	Size        int64
+	Truncated   bool
+	Data        []byte
+}
+
+// mediaTypeOf returns the response media type, sniffing the first bytes of
+// the body when the server did not send a Content-Type header.
+func mediaTypeOf(resp *http.Response, reader *bufio.Reader) string {
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		peek, _ := reader.Peek(512)
+		contentType = http.DetectContentType(peek)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	}
+	return mediaType
+}
+
+func isHTMLMediaType(mediaType string) bool {
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+// readBody reads at most maxBytes of the response. HTML bodies are kept for
+// parsing; anything else is only measured.
+func readBody(resp *http.Response, maxBytes int64) (*responseBody, error) {
+	reader := bufio.NewReader(resp.Body)
+	body := &responseBody{
+		MediaType:   mediaTypeOf(resp, reader),
+		ContentType: resp.Header.Get("Content-Type"),
+	}
+
+	limited := io.LimitReader(reader, maxBytes+1)
+
+	var n int64
+	var err error
+	if isHTMLMediaType(body.MediaType) {
+		body.Data, err = io.ReadAll(limited)
+		n = int64(len(body.Data))
+	} else {
+		n, err = io.Copy(io.Discard, limited)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if n > maxBytes {
+		body.Truncated = true
+		n = maxBytes
+		if body.Data != nil {
+			body.Data = body.Data[:maxBytes]
+		}
+	}
+
+	body.Size = n
+	if resp.ContentLength > n {
+		body.Size = resp.ContentLength
+	}
+
+	return body, nil
+}
+
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+// decodeHTML transcodes an HTML body to UTF-8. The encoding is taken from the
+// BOM, the Content-Type header or a <meta charset> declaration, in that order.
+// It returns the decoded body and the name of the detected encoding.
+func decodeHTML(data []byte, contentType string) ([]byte, string) {
+	enc, name, certain := charset.DetermineEncoding(data, contentType)
+
+	// Undeclared pages default to windows-1252, but only the first 1KB is
+	// checked for UTF-8, so fall back to UTF-8 when the whole body is valid.
+	if !certain && name != "utf-8" && utf8.Valid(data) {
+		enc, name = encoding.Nop, "utf-8"
+	}
+
+	if enc != encoding.Nop {
+		if decoded, err := enc.NewDecoder().Bytes(data); err == nil {
+			data = decoded
+		}
+	}
+
+	return bytes.TrimPrefix(data, utf8BOM), name
+}
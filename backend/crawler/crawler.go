@@ -1,15 +1,19 @@
 package crawler
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"net/url"
 	"strings"
-	"time"
 
 	"webcrawler/database"
 	"webcrawler/models"
+	"webcrawler/urlnorm"
 
 	"golang.org/x/net/html"
 )
@@ -23,70 +27,203 @@ type CrawlData struct {
 	InaccessibleLinks int
 	HasLoginForm      bool
 	BrokenLinks       []models.BrokenLink
+	Outcome           string
+	ContentType       string
+	ContentLength     int64
+	Truncated         bool
+	Encoding          string
+	Forms             []models.Form
+	Timings           []models.RequestTiming
+	TTFBMs            int
+	DownloadMs        int
+	HTMLBytes         int64
+	HTMLTransferBytes int64
+	Compression       string
+	SubresourceCount  int
+	SubresourceBytes  int64
+	BudgetViolations  []string
+
+	seenLinks        map[string]bool
+	seenSubresources map[string]bool
+	subresources     []string
+	anchors          map[string]bool
+	seenAnchorRefs   map[string]bool
+	anchorRefs       []anchorRef
 }
 
+// CrawlURL crawls a URL once a slot in the crawl queue is free. It blocks
+// until the crawl finishes or is cancelled.
 func CrawlURL(urlID int, targetURL string) {
+	t := enqueue(urlID, targetURL)
+	defer t.finish()
+
+	if !t.wait() {
+		log.Printf("Crawl for URL ID %d cancelled before it started", urlID)
+		return
+	}
+	crawl(t.ctx, urlID, targetURL)
+}
+
+func crawl(ctx context.Context, urlID int, targetURL string) {
 	log.Printf("Starting crawl for URL ID %d: %s", urlID, targetURL)
 
-	// Create HTTP client with timeout
-	client := &http.Client{
-		Timeout: 30 * time.Second,
+	// Extract base URL for relative link resolution
+	baseURL, err := url.Parse(targetURL)
+	if err != nil {
+		log.Printf("Failed to parse base URL %s: %v", targetURL, err)
+		updateURLStatus(ctx, urlID, "failed")
+		return
+	}
+
+	profile, err := loadProfile(urlID)
+	if err != nil {
+		log.Printf("Failed to load crawl profile for URL %s: %v", targetURL, err)
+		updateURLStatus(ctx, urlID, "failed")
+		return
+	}
+	s, err := newSession(ctx, profile, baseURL)
+	if err != nil {
+		log.Printf("Invalid crawl profile for URL %s: %v", targetURL, err)
+		updateURLStatus(ctx, urlID, "failed")
+		return
+	}
+
+	// Sign in first when the profile carries login credentials
+	if profile.Login != nil {
+		if err := s.login(profile.Login); err != nil {
+			log.Printf("Login failed for URL %s: %v", targetURL, err)
+			updateURLStatus(ctx, urlID, "failed")
+			return
+		}
+		log.Printf("Logged in to %s for URL ID %d", profile.Login.LoginURL, urlID)
 	}
 
 	// Make request
-	resp, err := client.Get(targetURL)
+	req, err := s.newRequest(http.MethodGet, targetURL, nil)
+	if err != nil {
+		log.Printf("Failed to build request for URL %s: %v", targetURL, err)
+		updateURLStatus(ctx, urlID, "failed")
+		return
+	}
+	// Decode compressed responses here so the transfer size can be measured
+	req.Header.Set("Accept-Encoding", pageAcceptEncoding)
+
+	resp, timer, err := s.doTimed(s.pageClient, req)
 	if err != nil {
 		log.Printf("Failed to fetch URL %s: %v", targetURL, err)
-		updateURLStatus(urlID, "failed")
+		updateURLStatus(ctx, urlID, "failed")
 		return
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		log.Printf("Non-200 status code for URL %s: %d", targetURL, resp.StatusCode)
-		updateURLStatus(urlID, "failed")
+		updateURLStatus(ctx, urlID, "failed")
 		return
 	}
 
-	// Parse HTML
-	doc, err := html.Parse(resp.Body)
+	wire, compression, err := decompressBody(resp)
+	undecoded := errors.Is(err, errUnsupportedEncoding)
+	if undecoded {
+		log.Printf("Cannot decode body for URL %s: %v", targetURL, err)
+	} else if err != nil {
+		log.Printf("Failed to decode body for URL %s: %v", targetURL, err)
+		updateURLStatus(ctx, urlID, "failed")
+		return
+	}
+
+	body, err := readBody(resp, s.limits.MaxBodyBytes)
+	resp.Body.Close()
 	if err != nil {
-		log.Printf("Failed to parse HTML for URL %s: %v", targetURL, err)
-		updateURLStatus(urlID, "failed")
+		log.Printf("Failed to read body for URL %s: %v", targetURL, err)
+		updateURLStatus(ctx, urlID, "failed")
 		return
 	}
+	ttfb, download := timer.phases()
 
 	// Initialize crawl data
 	data := CrawlData{
 		HeadingCounts: make(map[string]int),
 		BrokenLinks:   []models.BrokenLink{},
+		Outcome:       OutcomeHTML,
+		ContentType:   body.MediaType,
+		ContentLength: body.Size,
+		Truncated:     body.Truncated,
+		seenLinks:     make(map[string]bool),
+
+		TTFBMs:            ttfb,
+		DownloadMs:        download,
+		HTMLBytes:         body.Size,
+		HTMLTransferBytes: wire.n,
+		Compression:       compression,
+		seenSubresources:  make(map[string]bool),
+		anchors:           make(map[string]bool),
+		seenAnchorRefs:    make(map[string]bool),
 	}
 
-	// Extract base URL for relative link resolution
-	baseURL, err := url.Parse(targetURL)
+	// Non-HTML targets, and bodies in an encoding that cannot be decoded, are
+	// recorded with their type and size only
+	if !isHTMLMediaType(body.MediaType) || undecoded {
+		data.Outcome = OutcomeNonHTML
+		finishCrawl(urlID, targetURL, &data, s)
+		return
+	}
+
+	if body.Truncated {
+		log.Printf("Body of URL %s exceeds %d bytes, parsing truncated page", targetURL, s.limits.MaxBodyBytes)
+	}
+
+	// Transcode to UTF-8 before parsing
+	decoded, encodingName := decodeHTML(body.Data, body.ContentType)
+	data.Encoding = encodingName
+
+	// Parse HTML
+	doc, err := html.Parse(bytes.NewReader(decoded))
 	if err != nil {
-		log.Printf("Failed to parse base URL %s: %v", targetURL, err)
-		updateURLStatus(urlID, "failed")
+		log.Printf("Failed to parse HTML for URL %s: %v", targetURL, err)
+		updateURLStatus(ctx, urlID, "failed")
 		return
 	}
 
 	// Analyze HTML
-	analyzeHTML(doc, &data, baseURL)
+	analyzeHTML(doc, &data, s)
+	checkAnchors(&data, s, targetURL)
+	measureSubresources(&data, s)
+
+	finishCrawl(urlID, targetURL, &data, s)
+}
+
+func finishCrawl(urlID int, targetURL string, data *CrawlData, s *session) {
+	s.mu.Lock()
+	data.Timings = s.timings
+	s.mu.Unlock()
+
+	data.BudgetViolations = checkBudgets(data)
+	if len(data.BudgetViolations) > 0 {
+		log.Printf("URL %s exceeds performance budgets: %s", targetURL, strings.Join(data.BudgetViolations, ", "))
+	}
+
+	if s.ctx.Err() != nil {
+		log.Printf("Crawl for URL ID %d cancelled", urlID)
+		return
+	}
 
 	// Save results
-	if err := saveResults(urlID, &data); err != nil {
+	if err := saveResults(urlID, data); err != nil {
 		log.Printf("Failed to save results for URL %s: %v", targetURL, err)
-		updateURLStatus(urlID, "failed")
+		updateURLStatus(s.ctx, urlID, "failed")
 		return
 	}
 
 	// Update status to completed
-	updateURLStatus(urlID, "completed")
+	updateURLStatus(s.ctx, urlID, "completed")
 	log.Printf("Crawl completed for URL ID %d: %s", urlID, targetURL)
 }
 
-func analyzeHTML(n *html.Node, data *CrawlData, baseURL *url.URL) {
+func analyzeHTML(n *html.Node, data *CrawlData, s *session) {
 	if n.Type == html.ElementNode {
+		collectAnchorTargets(n, data.anchors)
+
 		switch n.Data {
 		case "html":
 			// Extract HTML version from DOCTYPE or html tag
@@ -101,18 +238,23 @@ func analyzeHTML(n *html.Node, data *CrawlData, baseURL *url.URL) {
 			data.HeadingCounts[n.Data]++
 		case "a":
 			// Analyze links
-			analyzeLink(n, data, baseURL)
+			analyzeLink(n, data, s)
 		case "form":
-			// Check for login form
-			if isLoginForm(n) {
+			// Inventory and classify the form
+			form := analyzeForm(n, s.baseURL)
+			data.Forms = append(data.Forms, form)
+			if form.Kind == FormKindLogin && form.Confidence >= loginConfidenceThreshold {
 				data.HasLoginForm = true
 			}
+		case "script", "link", "img", "iframe", "embed", "object", "audio", "video", "source", "track":
+			// Record resources the page loads
+			collectSubresource(n, data, s)
 		}
 	}
 
 	// Recursively analyze child nodes
 	for c := n.FirstChild; c != nil; c = c.NextSibling {
-		analyzeHTML(c, data, baseURL)
+		analyzeHTML(c, data, s)
 	}
 }
 
@@ -150,7 +292,7 @@ func extractTextContent(n *html.Node) string {
 	return strings.TrimSpace(text.String())
 }
 
-func analyzeLink(n *html.Node, data *CrawlData, baseURL *url.URL) {
+func analyzeLink(n *html.Node, data *CrawlData, s *session) {
 	var href string
 	for _, attr := range n.Attr {
 		if attr.Key == "href" {
@@ -170,118 +312,56 @@ func analyzeLink(n *html.Node, data *CrawlData, baseURL *url.URL) {
 	}
 
 	// Resolve relative URLs
-	resolvedURL := baseURL.ResolveReference(linkURL)
+	resolvedURL := s.baseURL.ResolveReference(linkURL)
 
-	// Check if it's internal or external
-	if resolvedURL.Host == baseURL.Host {
-		data.InternalLinks++
-	} else {
-		data.ExternalLinks++
-	}
+	// Collapse equivalent spellings so each link is counted and checked once
+	linkKey := canonicalKey(resolvedURL.String())
 
-	// Check if link is accessible and get detailed info
-	statusCode, errorMsg := checkLinkAccessibility(resolvedURL.String())
-	if statusCode >= 400 || statusCode == 0 {
-		data.InaccessibleLinks++
-		data.BrokenLinks = append(data.BrokenLinks, models.BrokenLink{
-			URL:          resolvedURL.String(),
-			StatusCode:   statusCode,
-			ErrorMessage: errorMsg,
-		})
+	// Fragments on internal links are checked once the page is analyzed
+	if resolvedURL.Fragment != "" && strings.EqualFold(resolvedURL.Hostname(), s.baseURL.Hostname()) {
+		addAnchorRef(data, resolvedURL.String(), linkKey, resolvedURL.Fragment)
 	}
-}
 
-func checkLinkAccessibility(linkURL string) (int, string) {
-	// Skip certain types of links
-	if strings.HasPrefix(linkURL, "mailto:") ||
-		strings.HasPrefix(linkURL, "tel:") ||
-		strings.HasPrefix(linkURL, "javascript:") ||
-		strings.HasPrefix(linkURL, "#") {
-		return 200, "OK" // Consider these as accessible
-	}
-
-	// Create a quick HEAD request to check accessibility
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			// Allow up to 5 redirects
-			if len(via) >= 5 {
-				return fmt.Errorf("stopped after 5 redirects")
-			}
-			return nil
-		},
+	if data.seenLinks[linkKey] {
+		return
 	}
+	data.seenLinks[linkKey] = true
 
-	resp, err := client.Head(linkURL)
-	if err != nil {
-		// Try GET request if HEAD fails
-		resp, err = client.Get(linkURL)
-		if err != nil {
-			return 0, fmt.Sprintf("Request failed: %v", err)
-		}
+	// Check if it's internal or external
+	if strings.EqualFold(resolvedURL.Hostname(), s.baseURL.Hostname()) {
+		data.InternalLinks++
+	} else {
+		data.ExternalLinks++
 	}
-	defer resp.Body.Close()
 
-	// Return the actual status code and status text
-	if resp.StatusCode >= 400 {
-		return resp.StatusCode, resp.Status
+	// Check the link as it appears on the page; the canonical key only
+	// decides which links are the same
+	check := s.checkLinkAccessibility(resolvedURL.String())
+	if check.Status == LinkOK {
+		return
 	}
-
-	return resp.StatusCode, "OK"
-}
-
-func isLoginForm(n *html.Node) bool {
-	// Look for common login form indicators
-	hasPasswordField := false
-	hasUsernameField := false
-
-	// Check form attributes
-	for _, attr := range n.Attr {
-		if attr.Key == "id" || attr.Key == "class" || attr.Key == "name" {
-			lowerVal := strings.ToLower(attr.Val)
-			if strings.Contains(lowerVal, "login") ||
-				strings.Contains(lowerVal, "signin") ||
-				strings.Contains(lowerVal, "auth") {
-				return true
-			}
-		}
+	// Blocked links may well work in a browser, so they are listed but not
+	// counted as inaccessible
+	if check.Status != LinkBlocked {
+		data.InaccessibleLinks++
 	}
-
-	// Check for password and username/email fields
-	checkInputs(n, &hasPasswordField, &hasUsernameField)
-
-	return hasPasswordField && hasUsernameField
+	data.BrokenLinks = append(data.BrokenLinks, models.BrokenLink{
+		URL:          resolvedURL.String(),
+		StatusCode:   check.StatusCode,
+		ErrorMessage: check.Message,
+		Kind:         check.Status,
+		Attempts:     check.Attempts,
+		ErrorClass:   check.ErrorClass,
+	})
 }
 
-func checkInputs(n *html.Node, hasPassword, hasUsername *bool) {
-	if n.Type == html.ElementNode && n.Data == "input" {
-		var inputType, inputName string
-		for _, attr := range n.Attr {
-			if attr.Key == "type" {
-				inputType = strings.ToLower(attr.Val)
-			}
-			if attr.Key == "name" || attr.Key == "id" {
-				inputName = strings.ToLower(attr.Val)
-			}
-		}
-
-		if inputType == "password" {
-			*hasPassword = true
-		}
-
-		if inputType == "text" || inputType == "email" {
-			if strings.Contains(inputName, "user") ||
-				strings.Contains(inputName, "email") ||
-				strings.Contains(inputName, "login") {
-				*hasUsername = true
-			}
-		}
-	}
-
-	// Recursively check child nodes
-	for c := n.FirstChild; c != nil; c = c.NextSibling {
-		checkInputs(c, hasPassword, hasUsername)
+// canonicalKey returns the key under which equivalent spellings of a URL
+// are collapsed: its canonical form, or the URL itself if it has none.
+func canonicalKey(rawURL string) string {
+	if canonical, err := urlnorm.Canonicalize(rawURL); err == nil {
+		return canonical
 	}
+	return rawURL
 }
 
 func saveResults(urlID int, data *CrawlData) error {
@@ -296,8 +376,11 @@ func saveResults(urlID int, data *CrawlData) error {
 		INSERT INTO crawl_results (
 			url_id, title, html_version, h1_count, h2_count, h3_count, 
 			h4_count, h5_count, h6_count, internal_links, external_links, 
-			inaccessible_links, has_login_form
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			inaccessible_links, has_login_form, outcome, content_type,
+			content_length, truncated, encoding, ttfb_ms, download_ms,
+			html_bytes, html_transfer_bytes, compression, subresource_count,
+			subresource_bytes, over_budget, budget_violations
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	result, err := database.DB.Exec(query,
@@ -314,6 +397,20 @@ func saveResults(urlID int, data *CrawlData) error {
 		data.ExternalLinks,
 		data.InaccessibleLinks,
 		data.HasLoginForm,
+		data.Outcome,
+		data.ContentType,
+		data.ContentLength,
+		data.Truncated,
+		data.Encoding,
+		data.TTFBMs,
+		data.DownloadMs,
+		data.HTMLBytes,
+		data.HTMLTransferBytes,
+		data.Compression,
+		data.SubresourceCount,
+		data.SubresourceBytes,
+		len(data.BudgetViolations) > 0,
+		strings.Join(data.BudgetViolations, ","),
 	)
 	if err != nil {
 		return fmt.Errorf("failed to insert results: %v", err)
@@ -327,21 +424,77 @@ func saveResults(urlID int, data *CrawlData) error {
 	// Insert broken links
 	for _, brokenLink := range data.BrokenLinks {
 		_, err := database.DB.Exec(
-			"INSERT INTO broken_links (result_id, url, status_code, error_message) VALUES (?, ?, ?, ?)",
+			`INSERT INTO broken_links (result_id, url, status_code, error_message, kind, attempts, error_class)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
 			resultID,
 			brokenLink.URL,
 			brokenLink.StatusCode,
 			brokenLink.ErrorMessage,
+			brokenLink.Kind,
+			brokenLink.Attempts,
+			brokenLink.ErrorClass,
 		)
 		if err != nil {
 			log.Printf("Failed to insert broken link: %v", err)
 		}
 	}
 
+	// Insert form inventory
+	for _, form := range data.Forms {
+		fields, err := json.Marshal(form.Fields)
+		if err != nil {
+			log.Printf("Failed to encode form fields: %v", err)
+			continue
+		}
+
+		_, err = database.DB.Exec(
+			`INSERT INTO page_forms (result_id, action, method, kind, confidence, fields, has_csrf_token, insecure_submit)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			resultID,
+			form.Action,
+			form.Method,
+			form.Kind,
+			form.Confidence,
+			string(fields),
+			form.HasCSRFToken,
+			form.InsecureSubmit,
+		)
+		if err != nil {
+			log.Printf("Failed to insert form: %v", err)
+		}
+	}
+
+	// Insert request timings
+	for _, timing := range data.Timings {
+		_, err := database.DB.Exec(
+			`INSERT INTO request_timings (result_id, url, method, status_code, dns_ms, connect_ms, tls_ms, ttfb_ms, total_ms, reused)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			resultID,
+			timing.URL,
+			timing.Method,
+			timing.StatusCode,
+			timing.DNSMs,
+			timing.ConnectMs,
+			timing.TLSMs,
+			timing.TTFBMs,
+			timing.TotalMs,
+			timing.Reused,
+		)
+		if err != nil {
+			log.Printf("Failed to insert request timing: %v", err)
+		}
+	}
+
 	return nil
 }
 
-func updateURLStatus(urlID int, status string) {
+// updateURLStatus records the outcome of a crawl. Cancelled crawls leave the
+// status to whoever cancelled them.
+func updateURLStatus(ctx context.Context, urlID int, status string) {
+	if ctx.Err() != nil {
+		return
+	}
+
 	_, err := database.DB.Exec("UPDATE urls SET status = ? WHERE id = ?", status, urlID)
 	if err != nil {
 		log.Printf("Failed to update URL status: %v", err)
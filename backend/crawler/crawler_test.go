@@ -0,0 +1,51 @@
+package crawler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"webcrawler/models"
+)
+
+func TestLinksCheckedAsWritten(t *testing.T) {
+	allowLocal(t)
+
+	var mu sync.Mutex
+	requested := map[string]bool{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested[r.URL.RequestURI()] = true
+		mu.Unlock()
+
+		switch r.URL.RequestURI() {
+		case "/docs/", "/search?b=2&a=1":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("ok"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	s := newTestSession(t, server.URL+"/", models.CrawlProfile{})
+	data := analyzePage(t, s, `<html><body>
+		<a href="/docs/">Docs</a>
+		<a href="/docs/#intro">Docs again</a>
+		<a href="/search?b=2&a=1">Search</a>
+		<a href="/gone/">Gone</a>
+	</body></html>`)
+
+	for _, uri := range []string{"/docs", "/search?a=1&b=2", "/gone"} {
+		if requested[uri] {
+			t.Errorf("checked %s, which is not on the page", uri)
+		}
+	}
+	if len(data.BrokenLinks) != 1 || data.BrokenLinks[0].URL != server.URL+"/gone/" {
+		t.Fatalf("broken links: %+v", data.BrokenLinks)
+	}
+	if data.InternalLinks != 3 {
+		t.Errorf("internal links: %d, want 3", data.InternalLinks)
+	}
+}
@@ -0,0 +1,313 @@
+package crawler
+
+import (
+	"math"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"webcrawler/models"
+
+	"golang.org/x/net/html"
+)
+
+// Form kinds assigned by analyzeForm.
+const (
+	FormKindLogin      = "login"
+	FormKindSignup     = "signup"
+	FormKindSearch     = "search"
+	FormKindNewsletter = "newsletter"
+	FormKindPayment    = "payment"
+	FormKindOther      = "other"
+)
+
+// loginConfidenceThreshold is the confidence above which a page is reported
+// as having a login form.
+const loginConfidenceThreshold = 0.5
+
+// minConfidence is the lowest score for which a form gets a specific kind.
+const minConfidence = 0.3
+
+var (
+	loginWords      = regexp.MustCompile(`(?i)log[\s_-]?in|sign[\s_-]?in|session`)
+	signupWords     = regexp.MustCompile(`(?i)regist|sign[\s_-]?up|create[\s_-]?(an[\s_-]?)?account|\bjoin\b`)
+	searchWords     = regexp.MustCompile(`(?i)search`)
+	newsletterWords = regexp.MustCompile(`(?i)subscri|newsletter|mailing[\s_-]?list`)
+	paymentWords    = regexp.MustCompile(`(?i)\bpay|checkout|billing`)
+	ssoWords        = regexp.MustCompile(`(?i)(sign|log)[\s_-]?in with|continue with|\bsso\b|single sign[\s-]?on`)
+	forgotWords     = regexp.MustCompile(`(?i)forgot|reset[\s_-]?password`)
+	rememberWords   = regexp.MustCompile(`(?i)remember`)
+	usernameWords   = regexp.MustCompile(`(?i)user|login|email|account`)
+	searchNames     = regexp.MustCompile(`(?i)^(q|s|query|search|keywords?|term)$`)
+	cardNames       = regexp.MustCompile(`(?i)card|cc[-_]?(num|number|exp|csc|cvv)|cvv|cvc|expir`)
+	nameFields      = regexp.MustCompile(`(?i)first[\s_-]?name|last[\s_-]?name|full[\s_-]?name|given-name|family-name`)
+	csrfNames       = regexp.MustCompile(`(?i)csrf|xsrf|authenticity_token|^_?token$|requestverificationtoken|nonce`)
+)
+
+// formFeatures collects everything the classifier looks at.
+type formFeatures struct {
+	fields           []models.FormField
+	passwords        int
+	currentPassword  bool
+	newPassword      bool
+	usernameField    bool
+	emailFields      int
+	searchInput      bool
+	searchName       bool
+	cardField        bool
+	nameField        bool
+	hasCSRFToken     bool
+	ssoButton        bool
+	forgotLink       bool
+	rememberMe       bool
+	visibleTextInput int
+	text             strings.Builder // attributes, button labels and link text
+}
+
+// analyzeForm inventories a form and classifies it.
+func analyzeForm(form *html.Node, baseURL *url.URL) models.Form {
+	features := &formFeatures{}
+	collectFormFeatures(form, features)
+
+	for _, attr := range form.Attr {
+		switch attr.Key {
+		case "id", "class", "name", "action", "aria-label":
+			features.text.WriteString(" " + attr.Val)
+		case "role":
+			if strings.EqualFold(attr.Val, "search") {
+				features.searchInput = true
+			}
+		}
+	}
+	if ancestorHasRole(form, "search") {
+		features.searchInput = true
+	}
+
+	method := strings.ToUpper(getAttrDefault(form, "method", "GET"))
+	if method != "POST" {
+		method = "GET"
+	}
+
+	action := baseURL
+	if attr := strings.TrimSpace(getAttr(form, "action")); attr != "" {
+		if actionURL, err := url.Parse(attr); err == nil {
+			action = baseURL.ResolveReference(actionURL)
+		}
+	}
+
+	kind, confidence := classifyForm(features, method)
+
+	fields := features.fields
+	if fields == nil {
+		fields = []models.FormField{}
+	}
+
+	return models.Form{
+		Action:         action.String(),
+		Method:         method,
+		Kind:           kind,
+		Confidence:     confidence,
+		Fields:         fields,
+		HasCSRFToken:   features.hasCSRFToken,
+		InsecureSubmit: action.Scheme == "http",
+	}
+}
+
+func collectFormFeatures(n *html.Node, f *formFeatures) {
+	if n.Type == html.ElementNode {
+		switch n.Data {
+		case "input", "select", "textarea":
+			collectField(n, f)
+		case "button":
+			f.text.WriteString(" " + extractTextContent(n))
+			if label := extractTextContent(n) + " " + getAttr(n, "aria-label"); ssoWords.MatchString(label) {
+				f.ssoButton = true
+			}
+		case "a":
+			label := extractTextContent(n)
+			if forgotWords.MatchString(label) || forgotWords.MatchString(getAttr(n, "href")) {
+				f.forgotLink = true
+			}
+			if ssoWords.MatchString(label) {
+				f.ssoButton = true
+			}
+		case "label":
+			if rememberWords.MatchString(extractTextContent(n)) {
+				f.rememberMe = true
+			}
+		}
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		collectFormFeatures(c, f)
+	}
+}
+
+func collectField(n *html.Node, f *formFeatures) {
+	fieldType := n.Data
+	if n.Data == "input" {
+		fieldType = strings.ToLower(getAttrDefault(n, "type", "text"))
+	}
+	name := getAttr(n, "name")
+	if name == "" {
+		name = getAttr(n, "id")
+	}
+	autocomplete := strings.ToLower(getAttr(n, "autocomplete"))
+	hint := name + " " + getAttr(n, "id") + " " + getAttr(n, "placeholder") + " " + autocomplete
+
+	f.fields = append(f.fields, models.FormField{
+		Name:         name,
+		Type:         fieldType,
+		Autocomplete: autocomplete,
+		Required:     hasAttr(n, "required"),
+	})
+
+	switch fieldType {
+	case "password":
+		f.passwords++
+		if strings.Contains(autocomplete, "current-password") {
+			f.currentPassword = true
+		}
+		if strings.Contains(autocomplete, "new-password") {
+			f.newPassword = true
+		}
+	case "email":
+		f.emailFields++
+		f.visibleTextInput++
+	case "search":
+		f.searchInput = true
+		f.visibleTextInput++
+	case "hidden":
+		if csrfNames.MatchString(name) {
+			f.hasCSRFToken = true
+		}
+	case "submit", "button", "image", "reset":
+		f.text.WriteString(" " + getAttr(n, "value") + " " + getAttr(n, "alt"))
+		if ssoWords.MatchString(getAttr(n, "value")) {
+			f.ssoButton = true
+		}
+	case "checkbox":
+		if rememberWords.MatchString(hint) {
+			f.rememberMe = true
+		}
+	case "text", "tel", "textarea":
+		f.visibleTextInput++
+		if strings.Contains(autocomplete, "username") || usernameWords.MatchString(name) {
+			f.usernameField = true
+		}
+		if strings.Contains(autocomplete, "email") || strings.Contains(strings.ToLower(name), "email") {
+			f.emailFields++
+		}
+		if searchNames.MatchString(name) {
+			f.searchName = true
+		}
+	}
+
+	if strings.HasPrefix(autocomplete, "cc-") || cardNames.MatchString(name) {
+		f.cardField = true
+	}
+	if nameFields.MatchString(hint) {
+		f.nameField = true
+	}
+}
+
+// classifyForm scores the form against each kind and returns the best match
+// with its confidence in [0, 1].
+func classifyForm(f *formFeatures, method string) (string, float64) {
+	text := f.text.String()
+	scores := map[string]float64{}
+
+	// Login: an existing password, possibly with SSO alternatives
+	if f.currentPassword {
+		scores[FormKindLogin] += 0.6
+	}
+	if f.passwords == 1 {
+		scores[FormKindLogin] += 0.4
+	}
+	if f.passwords > 0 && (f.usernameField || f.emailFields > 0) {
+		scores[FormKindLogin] += 0.2
+	}
+	if loginWords.MatchString(text) {
+		scores[FormKindLogin] += 0.3
+	}
+	if f.ssoButton {
+		scores[FormKindLogin] += 0.5
+	}
+	if f.forgotLink {
+		scores[FormKindLogin] += 0.2
+	}
+	if f.rememberMe {
+		scores[FormKindLogin] += 0.1
+	}
+	if f.newPassword {
+		scores[FormKindLogin] -= 0.4
+	}
+
+	// Signup: a new password, usually confirmed, plus profile fields
+	if f.newPassword {
+		scores[FormKindSignup] += 0.5
+	}
+	if f.passwords >= 2 {
+		scores[FormKindSignup] += 0.4
+	}
+	if signupWords.MatchString(text) {
+		scores[FormKindSignup] += 0.4
+	}
+	if f.nameField {
+		scores[FormKindSignup] += 0.2
+	}
+	if f.passwords > 0 && f.emailFields > 0 && f.usernameField {
+		scores[FormKindSignup] += 0.1
+	}
+
+	// Search: a query box, usually submitted with GET
+	if f.searchInput {
+		scores[FormKindSearch] += 0.6
+	}
+	if f.searchName {
+		scores[FormKindSearch] += 0.4
+	}
+	if searchWords.MatchString(text) {
+		scores[FormKindSearch] += 0.3
+	}
+	if f.passwords == 0 && f.visibleTextInput == 1 && method == "GET" {
+		scores[FormKindSearch] += 0.1
+	}
+
+	// Newsletter: a lone email field
+	if newsletterWords.MatchString(text) {
+		scores[FormKindNewsletter] += 0.5
+	}
+	if f.passwords == 0 && f.emailFields == 1 && f.visibleTextInput <= 2 {
+		scores[FormKindNewsletter] += 0.3
+	}
+
+	// Payment: card details
+	if f.cardField {
+		scores[FormKindPayment] += 0.6
+	}
+	if paymentWords.MatchString(text) {
+		scores[FormKindPayment] += 0.3
+	}
+
+	kind, best := FormKindOther, 0.0
+	for _, candidate := range []string{FormKindLogin, FormKindSignup, FormKindPayment, FormKindSearch, FormKindNewsletter} {
+		if scores[candidate] > best {
+			kind, best = candidate, scores[candidate]
+		}
+	}
+
+	if best < minConfidence {
+		return FormKindOther, 0
+	}
+	return kind, math.Round(math.Min(best, 1)*100) / 100
+}
+
+func ancestorHasRole(n *html.Node, role string) bool {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if p.Type == html.ElementNode && strings.EqualFold(getAttr(p, "role"), role) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,260 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Ranges that are never fetched unless explicitly allowed: private, loopback,
+// link-local, shared address space and cloud metadata endpoints.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("168.63.129.16/32"),
+	netip.MustParsePrefix("224.0.0.0/4"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("::/128"),
+	netip.MustParsePrefix("::1/128"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("2002::/16"),
+	netip.MustParsePrefix("fc00::/7"),
+	netip.MustParsePrefix("fe80::/10"),
+	netip.MustParsePrefix("ff00::/8"),
+}
+
+// BlockedAddressError is returned when a host resolves to a disallowed address.
+type BlockedAddressError struct {
+	Host string
+	IP   netip.Addr
+}
+
+func (e *BlockedAddressError) Error() string {
+	return fmt.Sprintf("address %s of host %s is not allowed", e.IP, e.Host)
+}
+
+// networkGuard resolves hostnames itself and only dials addresses it has
+// checked, so redirects and DNS rebinding cannot reach internal networks.
+type networkGuard struct {
+	allowedHosts    []string
+	allowedPrefixes []netip.Prefix
+	// proxies are the host:port addresses of the configured proxies, which
+	// may be dialed as the proxy hop even on an internal network
+	proxies map[string]bool
+	dialer  *net.Dialer
+	dns     *dnsCache
+}
+
+var guard = newNetworkGuard(nil, 0)
+
+func newNetworkGuard(allowed []string, dnsTTL time.Duration) *networkGuard {
+	g := &networkGuard{
+		dialer: &net.Dialer{
+			Timeout:   10 * time.Second,
+			KeepAlive: 30 * time.Second,
+		},
+		dns: newDNSCache(dnsTTL),
+	}
+
+	for _, entry := range allowed {
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			g.allowedPrefixes = append(g.allowedPrefixes, prefix.Masked())
+		} else if addr, err := netip.ParseAddr(entry); err == nil {
+			g.allowedPrefixes = append(g.allowedPrefixes, netip.PrefixFrom(addr, addr.BitLen()))
+		} else {
+			g.allowedHosts = append(g.allowedHosts, strings.ToLower(entry))
+		}
+	}
+
+	if len(allowed) > 0 {
+		log.Printf("Crawler network guard allowlist: %v", allowed)
+	}
+
+	return g
+}
+
+func (g *networkGuard) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if g.hostAllowed(host) {
+		return g.dialer.DialContext(ctx, network, addr)
+	}
+
+	// Dial the checked addresses directly so a second lookup cannot return
+	// another one
+	ips, err := g.resolve(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for _, ip := range ips {
+		conn, err := g.dialer.DialContext(ctx, network, net.JoinHostPort(ip.Unmap().String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no addresses found for host %s", host)
+	}
+	return nil, lastErr
+}
+
+// trustProxies lets DialProxy connect to the proxies at addrs, given as
+// host:port.
+func (g *networkGuard) trustProxies(addrs []string) {
+	g.proxies = make(map[string]bool)
+	for _, addr := range addrs {
+		g.proxies[strings.ToLower(addr)] = true
+	}
+	if len(addrs) > 0 {
+		log.Printf("Crawler proxies trusted as the proxy hop: %v", addrs)
+	}
+}
+
+// DialProxy connects to a proxy. The configured proxies are trusted as they
+// are; proxies from crawl profiles are checked like any other address.
+func (g *networkGuard) DialProxy(ctx context.Context, network, addr string) (net.Conn, error) {
+	if g.proxies[strings.ToLower(addr)] {
+		return g.dialer.DialContext(ctx, network, addr)
+	}
+	return g.DialContext(ctx, network, addr)
+}
+
+// checkHost verifies that host may be fetched. It is used for requests sent
+// through a proxy, which resolves the target itself: a name can resolve to a
+// public address here and to an internal one at the proxy, so proxies must
+// enforce their own egress rules as well.
+func (g *networkGuard) checkHost(ctx context.Context, host string) error {
+	if g.hostAllowed(host) {
+		return nil
+	}
+	_, err := g.resolve(ctx, host)
+	return err
+}
+
+// resolve looks up host and refuses it if any of its addresses is blocked.
+func (g *networkGuard) resolve(ctx context.Context, host string) ([]netip.Addr, error) {
+	ips, err := g.dns.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ip := range ips {
+		if !g.addrAllowed(ip) {
+			return nil, &BlockedAddressError{Host: host, IP: ip.Unmap()}
+		}
+	}
+
+	return ips, nil
+}
+
+func (g *networkGuard) hostAllowed(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, allowed := range g.allowedHosts {
+		if suffix, ok := strings.CutPrefix(allowed, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if host == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *networkGuard) addrAllowed(ip netip.Addr) bool {
+	ip = ip.Unmap()
+
+	for _, prefix := range g.allowedPrefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+
+	if !ip.IsValid() || !ip.IsGlobalUnicast() {
+		return false
+	}
+
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// dnsCache keeps resolved addresses for a short time so link checks against
+// the same hosts do not repeat lookups.
+type dnsCache struct {
+	ttl     time.Duration
+	resolve func(ctx context.Context, host string) ([]netip.Addr, error)
+	mu      sync.Mutex
+	entries map[string]dnsEntry
+}
+
+type dnsEntry struct {
+	addrs   []netip.Addr
+	expires time.Time
+}
+
+func newDNSCache(ttl time.Duration) *dnsCache {
+	return &dnsCache{ttl: ttl, resolve: lookupNetIP, entries: make(map[string]dnsEntry)}
+}
+
+func lookupNetIP(ctx context.Context, host string) ([]netip.Addr, error) {
+	return net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+}
+
+func (c *dnsCache) lookup(ctx context.Context, host string) ([]netip.Addr, error) {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return []netip.Addr{addr}, nil
+	}
+	if c.ttl <= 0 {
+		return c.resolve(ctx, host)
+	}
+
+	now := time.Now()
+	c.mu.Lock()
+	entry, ok := c.entries[host]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.addrs, nil
+	}
+
+	addrs, err := c.resolve(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Drop expired entries now and then to keep the map bounded
+	if len(c.entries) > 10000 {
+		for key, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, key)
+			}
+		}
+	}
+	c.entries[host] = dnsEntry{addrs: addrs, expires: now.Add(c.ttl)}
+
+	return addrs, nil
+}
@@ -0,0 +1,211 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stubResolver answers lookups from a fixed table.
+func stubResolver(records map[string]string) func(context.Context, string) ([]netip.Addr, error) {
+	return func(ctx context.Context, host string) ([]netip.Addr, error) {
+		var addrs []netip.Addr
+		for _, ip := range strings.Fields(records[host]) {
+			addrs = append(addrs, netip.MustParseAddr(ip))
+		}
+		if len(addrs) == 0 {
+			return nil, fmt.Errorf("no such host %s", host)
+		}
+		return addrs, nil
+	}
+}
+
+func testGuard(allowed []string, records map[string]string) *networkGuard {
+	g := newNetworkGuard(allowed, 0)
+	g.dns.resolve = stubResolver(records)
+	return g
+}
+
+func TestAddrAllowed(t *testing.T) {
+	g := testGuard(nil, nil)
+
+	tests := []struct {
+		ip      string
+		allowed bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+
+		{"127.0.0.1", false},
+		{"127.255.0.1", false},
+		{"::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"100.64.0.1", false},
+		{"fc00::1", false},
+		{"fd12:3456::1", false},
+
+		// Link-local and cloud metadata endpoints
+		{"169.254.169.254", false},
+		{"168.63.129.16", false},
+		{"fe80::1", false},
+		{"fd00:ec2::254", false},
+
+		// IPv4 addresses wrapped in IPv6
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:169.254.169.254", false},
+		{"::ffff:10.0.0.1", false},
+		{"::ffff:93.184.216.34", true},
+		{"64:ff9b::7f00:1", false},
+		{"2002:7f00:1::1", false},
+		{"2002:a9fe:a9fe::1", false},
+
+		{"224.0.0.1", false},
+		{"ff02::1", false},
+		{"255.255.255.255", false},
+	}
+
+	for _, tt := range tests {
+		if got := g.addrAllowed(netip.MustParseAddr(tt.ip)); got != tt.allowed {
+			t.Errorf("addrAllowed(%s) = %v, want %v", tt.ip, got, tt.allowed)
+		}
+	}
+}
+
+func TestResolveBlocksPrivateHosts(t *testing.T) {
+	g := testGuard(nil, map[string]string{
+		"public.test":   "93.184.216.34",
+		"loopback.test": "127.0.0.1",
+		"metadata.test": "169.254.169.254",
+		"mapped.test":   "::ffff:127.0.0.1",
+		// One bad address is enough to refuse the host
+		"mixed.test": "93.184.216.34 10.0.0.1",
+	})
+
+	tests := []struct {
+		host    string
+		allowed bool
+	}{
+		{"public.test", true},
+		{"loopback.test", false},
+		{"metadata.test", false},
+		{"mapped.test", false},
+		{"mixed.test", false},
+		{"127.0.0.1", false},
+		{"169.254.169.254", false},
+		{"::ffff:169.254.169.254", false},
+		{"93.184.216.34", true},
+	}
+
+	for _, tt := range tests {
+		_, err := g.resolve(context.Background(), tt.host)
+		var blocked *BlockedAddressError
+		if tt.allowed && err != nil {
+			t.Errorf("%s: %v", tt.host, err)
+		}
+		if !tt.allowed && !errors.As(err, &blocked) {
+			t.Errorf("%s: got %v, want a blocked address error", tt.host, err)
+		}
+	}
+}
+
+func TestAllowlist(t *testing.T) {
+	g := testGuard([]string{"staging.internal", "*.corp.test", "10.1.0.0/16", "192.168.0.10"}, map[string]string{
+		"app.corp.test":  "10.9.9.9",
+		"corp.test":      "10.9.9.9",
+		"other.internal": "10.9.9.9",
+		"wiki.test":      "10.1.2.3",
+		"router.test":    "192.168.0.10",
+		"printer.test":   "192.168.0.11",
+	})
+
+	tests := []struct {
+		host    string
+		allowed bool
+	}{
+		{"staging.internal", true},
+		{"STAGING.internal.", true},
+		{"app.corp.test", true},
+		{"corp.test", false},
+		{"other.internal", false},
+		{"wiki.test", true},
+		{"router.test", true},
+		{"printer.test", false},
+	}
+
+	for _, tt := range tests {
+		err := g.checkHost(context.Background(), tt.host)
+		if allowed := err == nil; allowed != tt.allowed {
+			t.Errorf("%s: allowed %v (%v), want %v", tt.host, allowed, err, tt.allowed)
+		}
+	}
+}
+
+func TestDialRefusesBlockedAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	_, port, _ := strings.Cut(strings.TrimPrefix(server.URL, "http://"), ":")
+
+	g := testGuard(nil, map[string]string{"internal.test": "127.0.0.1"})
+	for _, host := range []string{"internal.test", "127.0.0.1", "[::ffff:127.0.0.1]"} {
+		addr := host + ":" + port
+		conn, err := g.DialContext(context.Background(), "tcp", addr)
+		if err == nil {
+			conn.Close()
+			t.Errorf("dialed %s", addr)
+			continue
+		}
+		var blocked *BlockedAddressError
+		if !errors.As(err, &blocked) {
+			t.Errorf("%s: got %v, want a blocked address error", addr, err)
+		}
+	}
+}
+
+func TestRedirectIntoPrivateRange(t *testing.T) {
+	var internalHits int
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		internalHits++
+	}))
+	defer internal.Close()
+	internalURL, _ := url.Parse(internal.URL)
+
+	// The public site is on the allowlist; its redirect target is not
+	public := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://internal.test:"+internalURL.Port()+"/admin", http.StatusFound)
+	}))
+	defer public.Close()
+	publicURL := strings.Replace(public.URL, "127.0.0.1", "localhost", 1)
+
+	savedGuard, savedTransport := guard, transport
+	guard = testGuard([]string{"localhost"}, map[string]string{"internal.test": "127.0.0.1"})
+	transport = newTransport()
+	defer func() { guard, transport = savedGuard, savedTransport }()
+
+	client := newClient(5*time.Second, 5)
+	resp, err := client.Get(publicURL)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("redirect into the loopback range was followed")
+	}
+	var blocked *BlockedAddressError
+	if !errors.As(err, &blocked) {
+		t.Errorf("got %v, want a blocked address error", err)
+	}
+	if classifyError(err) != ErrorClassBlockedAddress {
+		t.Errorf("error class %q, want %q", classifyError(err), ErrorClassBlockedAddress)
+	}
+	if internalHits != 0 {
+		t.Error("internal server was reached")
+	}
+}
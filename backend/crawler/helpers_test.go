@@ -0,0 +1,59 @@
+package crawler
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+
+	"webcrawler/models"
+
+	"golang.org/x/net/html"
+)
+
+// allowLocal lets the crawler reach test servers on the loopback interface
+// for the rest of the test.
+func allowLocal(t *testing.T) {
+	t.Helper()
+	savedGuard, savedTransport := guard, transport
+	guard = newNetworkGuard([]string{"127.0.0.0/8", "::1", "localhost"}, 0)
+	transport = newTransport()
+	t.Cleanup(func() {
+		transport.CloseIdleConnections()
+		guard, transport = savedGuard, savedTransport
+	})
+}
+
+// newTestSession starts a crawl session of target with the given profile.
+func newTestSession(t *testing.T, target string, profile models.CrawlProfile) *session {
+	t.Helper()
+	baseURL, err := url.Parse(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := newSession(context.Background(), profile, baseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// analyzePage runs the link analysis of a crawl over page.
+func analyzePage(t *testing.T, s *session, page string) *CrawlData {
+	t.Helper()
+	doc, err := html.Parse(strings.NewReader(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := &CrawlData{
+		HeadingCounts:    make(map[string]int),
+		BrokenLinks:      []models.BrokenLink{},
+		seenLinks:        make(map[string]bool),
+		seenSubresources: make(map[string]bool),
+		anchors:          make(map[string]bool),
+		seenAnchorRefs:   make(map[string]bool),
+	}
+	analyzeHTML(doc, data, s)
+	checkAnchors(data, s, s.baseURL.String())
+	return data
+}
@@ -0,0 +1,267 @@
+package crawler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Link check outcomes. Anything other than LinkOK is stored in broken_links
+// with the outcome as its kind.
+const (
+	LinkOK      = "ok"
+	LinkBroken  = "broken"
+	LinkSoft404 = "soft_404"
+	LinkBlocked = "blocked"
+
+	LinkMissingAnchor = "missing_anchor"
+)
+
+// inspectBytes is how much of an HTML link target is fetched to look for
+// soft 404s.
+const inspectBytes = 16 << 10
+
+// maxSoft404TextLength is the longest page text that is searched for "not
+// found" wording; longer pages are assumed to be real content.
+const maxSoft404TextLength = 2000
+
+var notFoundWords = regexp.MustCompile(`(?i)\b404\b|not found|page (does not|doesn't|no longer) exist|no longer available|page (is )?unavailable|nothing (was )?found|cannot be found|could not be found|can't be found`)
+
+// linkCheck is the result of checking a single link.
+type linkCheck struct {
+	Status     string
+	StatusCode int
+	Message    string
+	Attempts   int
+	ErrorClass string
+}
+
+func (s *session) checkLinkAccessibility(linkURL string) linkCheck {
+	// Skip certain types of links
+	if strings.HasPrefix(linkURL, "mailto:") ||
+		strings.HasPrefix(linkURL, "tel:") ||
+		strings.HasPrefix(linkURL, "javascript:") ||
+		strings.HasPrefix(linkURL, "#") {
+		return linkCheck{Status: LinkOK, StatusCode: 200, Message: "OK"} // Consider these as accessible
+	}
+
+	// Create a quick HEAD request to check accessibility
+	resp, attempts, err := s.requestLink(http.MethodHead, linkURL)
+	if err != nil {
+		// Try GET request if HEAD fails, unless GET would fail the same way
+		switch classifyError(err) {
+		case ErrorClassBlockedAddress, ErrorClassDNS, ErrorClassTimeout:
+			return failedCheck(err, attempts)
+		}
+		resp, attempts, err = s.requestLink(http.MethodGet, linkURL)
+		if err != nil {
+			return failedCheck(err, attempts)
+		}
+	} else if headUnsupported(resp.StatusCode) || (resp.StatusCode < 300 && isHTMLResponse(resp)) {
+		// Servers that reject HEAD often serve GET fine, and HTML pages need
+		// their content inspected for soft 404s
+		resp.Body.Close()
+		resp, attempts, err = s.requestLink(http.MethodGet, linkURL)
+		if err != nil {
+			return failedCheck(err, attempts)
+		}
+	}
+	defer resp.Body.Close()
+
+	check := linkCheck{StatusCode: resp.StatusCode, Message: resp.Status, Attempts: attempts}
+
+	if isBlockedResponse(resp) {
+		check.Status, check.ErrorClass = LinkBlocked, classifyStatus(resp.StatusCode)
+		return check
+	}
+	if resp.StatusCode >= 400 && resp.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		check.Status, check.ErrorClass = LinkBroken, classifyStatus(resp.StatusCode)
+		return check
+	}
+
+	if reason := soft404Reason(linkURL, resp); reason != "" {
+		check.Status, check.ErrorClass, check.Message = LinkSoft404, ErrorClassSoft404, "Soft 404: "+reason
+		return check
+	}
+
+	// Drain a little of the body so the connection can be reused
+	io.CopyN(io.Discard, resp.Body, 4<<10)
+
+	check.Status, check.Message = LinkOK, "OK"
+	return check
+}
+
+// requestLink sends a link check request and returns the number of attempts
+// it took. GET requests ask for the start of the body only.
+func (s *session) requestLink(method, linkURL string) (*http.Response, int, error) {
+	req, err := s.newRequest(method, linkURL, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if method == http.MethodGet {
+		req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", inspectBytes-1))
+	}
+	resp, _, attempts, err := s.doRetry(s.linkClient, req)
+	return resp, attempts, err
+}
+
+func failedCheck(err error, attempts int) linkCheck {
+	check := linkCheck{
+		Status:     LinkBroken,
+		Message:    fmt.Sprintf("Request failed: %v", err),
+		Attempts:   attempts,
+		ErrorClass: classifyError(err),
+	}
+
+	var blocked *BlockedAddressError
+	if errors.As(err, &blocked) {
+		check.Status, check.Message = LinkBlocked, blocked.Error()
+	}
+	return check
+}
+
+// headUnsupported reports statuses servers commonly send for HEAD requests
+// they do not handle, even though the resource exists.
+func headUnsupported(statusCode int) bool {
+	return statusCode == http.StatusMethodNotAllowed ||
+		statusCode == http.StatusForbidden ||
+		statusCode == http.StatusNotImplemented
+}
+
+// isBlockedResponse reports responses that refuse the crawler rather than
+// say the resource is missing: authentication, rate limits and bot walls.
+func isBlockedResponse(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusProxyAuthRequired,
+		http.StatusTooManyRequests, http.StatusUnavailableForLegalReasons, 999:
+		return true
+	}
+	return resp.Header.Get("Cf-Mitigated") != ""
+}
+
+func isHTMLResponse(resp *http.Response) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(resp.Header.Get("Content-Type"), ";")[0]))
+	return isHTMLMediaType(mediaType)
+}
+
+// soft404Reason returns why a successful response looks like an error page,
+// or "" if it does not.
+func soft404Reason(linkURL string, resp *http.Response) string {
+	requested, err := url.Parse(linkURL)
+	if err != nil {
+		return ""
+	}
+
+	// Missing pages are often redirected to the home page
+	final := resp.Request.URL
+	if isRootPath(final.Path) && !isRootPath(requested.Path) &&
+		strings.EqualFold(final.Hostname(), requested.Hostname()) &&
+		!isIndexDocument(requested.Path) && !isAuthRedirect(resp) {
+		return "redirected to home page"
+	}
+
+	if resp.Request.Method != http.MethodGet || !isHTMLResponse(resp) {
+		return ""
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, inspectBytes))
+	if err != nil {
+		return ""
+	}
+	decoded, _ := decodeHTML(data, resp.Header.Get("Content-Type"))
+	doc, err := html.Parse(bytes.NewReader(decoded))
+	if err != nil {
+		return ""
+	}
+
+	if title := findElementText(doc, "title"); notFoundWords.MatchString(title) {
+		return fmt.Sprintf("title %q", title)
+	}
+	if heading := findElementText(doc, "h1"); notFoundWords.MatchString(heading) {
+		return fmt.Sprintf("heading %q", heading)
+	}
+	if text := visibleText(doc); len(text) <= maxSoft404TextLength && notFoundWords.MatchString(text) {
+		return "page text says not found"
+	}
+
+	return ""
+}
+
+func isRootPath(path string) bool {
+	return path == "" || path == "/"
+}
+
+// isIndexDocument reports paths such as /index.html that name the home page
+// itself.
+func isIndexDocument(path string) bool {
+	name := strings.ToLower(strings.TrimPrefix(path, "/"))
+	return !strings.Contains(name, "/") &&
+		(strings.HasPrefix(name, "index.") || strings.HasPrefix(name, "default."))
+}
+
+var loginPath = regexp.MustCompile(`(?i)/(log-?in|sign-?in|auth|sso|wp-login\.php)(/|\.|$)`)
+
+// returnParams are query parameters that carry the page to return to after
+// signing in.
+var returnParams = []string{"next", "return", "returnto", "return_to", "returnurl", "redirect", "redirect_to", "redirect_uri", "continue"}
+
+// isAuthRedirect reports whether a response was reached through a redirect
+// to a sign-in page, which sends visitors home without the page being gone.
+func isAuthRedirect(resp *http.Response) bool {
+	for r := resp; r != nil && r.Request != nil; r = r.Request.Response {
+		target := r.Request.URL
+		if loginPath.MatchString(target.Path) {
+			return true
+		}
+		for name := range target.Query() {
+			if slices.Contains(returnParams, strings.ToLower(name)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// findElementText returns the text of the first element with the given tag.
+func findElementText(n *html.Node, tag string) string {
+	if n.Type == html.ElementNode && n.Data == tag {
+		return extractTextContent(n)
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if text := findElementText(c, tag); text != "" {
+			return text
+		}
+	}
+	return ""
+}
+
+// visibleText returns the page's text, skipping scripts and styles.
+func visibleText(n *html.Node) string {
+	var text strings.Builder
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch {
+		case n.Type == html.TextNode:
+			if trimmed := strings.TrimSpace(n.Data); trimmed != "" {
+				text.WriteString(trimmed + " ")
+			}
+		case n.Type == html.ElementNode && (n.Data == "script" || n.Data == "style" || n.Data == "noscript" || n.Data == "template"):
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+
+	return strings.TrimSpace(text.String())
+}
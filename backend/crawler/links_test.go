@@ -0,0 +1,140 @@
+package crawler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"webcrawler/models"
+)
+
+const padding = "Lorem ipsum dolor sit amet, consectetur adipiscing elit. "
+
+func htmlPage(w http.ResponseWriter, page string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	io.WriteString(w, page)
+}
+
+func TestSoft404(t *testing.T) {
+	allowLocal(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/{$}", func(w http.ResponseWriter, r *http.Request) {
+		htmlPage(w, "<title>Home</title><h1>Welcome</h1>")
+	})
+	mux.HandleFunc("/about", func(w http.ResponseWriter, r *http.Request) {
+		htmlPage(w, "<title>About us</title><h1>About</h1><p>We build crawlers.</p>")
+	})
+	mux.HandleFunc("/gone", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/", http.StatusFound)
+	})
+	mux.HandleFunc("/index.html", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/members", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/?next=%2Fmembers", http.StatusFound)
+	})
+	mux.HandleFunc("/account", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/login", http.StatusFound)
+	})
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/", http.StatusFound)
+	})
+	mux.HandleFunc("/titled", func(w http.ResponseWriter, r *http.Request) {
+		htmlPage(w, "<title>Page Not Found</title><p>Try the search.</p>")
+	})
+	mux.HandleFunc("/headed", func(w http.ResponseWriter, r *http.Request) {
+		htmlPage(w, "<title>Example</title><h1>Sorry, this page does not exist</h1>")
+	})
+	mux.HandleFunc("/short", func(w http.ResponseWriter, r *http.Request) {
+		htmlPage(w, "<title>Example</title><p>The requested item could not be found.</p>")
+	})
+	mux.HandleFunc("/article", func(w http.ResponseWriter, r *http.Request) {
+		htmlPage(w, "<title>Debugging</title><p>"+strings.Repeat(padding, 50)+"The file was not found.</p>")
+	})
+	mux.HandleFunc("/script", func(w http.ResponseWriter, r *http.Request) {
+		htmlPage(w, "<title>App</title><script>if (!page) showError('not found')</script><p>Loading the application</p>")
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// The same server under another host name
+	other := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	mux.HandleFunc("/partner", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, other+"/", http.StatusFound)
+	})
+
+	s := newTestSession(t, server.URL, models.CrawlProfile{})
+
+	tests := []struct {
+		path    string
+		status  string
+		message string
+	}{
+		{"/about", LinkOK, ""},
+		{"/gone", LinkSoft404, "redirected to home page"},
+		{"/index.html", LinkOK, ""},
+		{"/members", LinkOK, ""},
+		{"/account", LinkOK, ""},
+		{"/partner", LinkOK, ""},
+		{"/titled", LinkSoft404, `title "Page Not Found"`},
+		{"/headed", LinkSoft404, "heading"},
+		{"/short", LinkSoft404, "page text"},
+		{"/article", LinkOK, ""},
+		{"/script", LinkOK, ""},
+	}
+
+	for _, tt := range tests {
+		check := s.checkLinkAccessibility(server.URL + tt.path)
+		if check.Status != tt.status || !strings.Contains(check.Message, tt.message) {
+			t.Errorf("%s: got %s (%s), want %s (%s)", tt.path, check.Status, check.Message, tt.status, tt.message)
+		}
+	}
+}
+
+func TestHeadFallback(t *testing.T) {
+	allowLocal(t)
+
+	tests := []struct {
+		headStatus int
+		getStatus  int
+		want       string
+	}{
+		{http.StatusMethodNotAllowed, http.StatusOK, LinkOK},
+		{http.StatusForbidden, http.StatusOK, LinkOK},
+		{http.StatusNotImplemented, http.StatusPartialContent, LinkOK},
+		{http.StatusMethodNotAllowed, http.StatusNotFound, LinkBroken},
+		{http.StatusForbidden, http.StatusForbidden, LinkBlocked},
+		{http.StatusNotFound, http.StatusOK, LinkBroken},
+	}
+
+	for _, tt := range tests {
+		var ranges []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodHead {
+				w.WriteHeader(tt.headStatus)
+				return
+			}
+			ranges = append(ranges, r.Header.Get("Range"))
+			w.Header().Set("Content-Type", "application/pdf")
+			w.WriteHeader(tt.getStatus)
+		}))
+
+		s := newTestSession(t, server.URL, models.CrawlProfile{})
+		check := s.checkLinkAccessibility(server.URL + "/report.pdf")
+		server.Close()
+
+		if check.Status != tt.want {
+			t.Errorf("HEAD %d, GET %d: got %s (%s), want %s", tt.headStatus, tt.getStatus, check.Status, check.Message, tt.want)
+		}
+		fallback := headUnsupported(tt.headStatus)
+		if fallback && (len(ranges) != 1 || ranges[0] != "bytes=0-16383") {
+			t.Errorf("HEAD %d: GET requests with ranges %q, want one ranged GET", tt.headStatus, ranges)
+		}
+		if !fallback && len(ranges) != 0 {
+			t.Errorf("HEAD %d: unexpected GET fallback", tt.headStatus)
+		}
+	}
+}
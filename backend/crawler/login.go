@@ -0,0 +1,233 @@
+package crawler
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+
+	"webcrawler/models"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/publicsuffix"
+)
+
+// login signs in through the profile's login form and keeps the resulting
+// session cookies on the crawl's clients.
+func (s *session) login(login *models.FormLogin) error {
+	jar, err := cookiejar.New(&cookiejar.Options{PublicSuffixList: publicsuffix.List})
+	if err != nil {
+		return err
+	}
+	s.pageClient.Jar = jar
+	s.linkClient.Jar = jar
+
+	// Load the login page to find the form and pick up its cookies and tokens
+	doc, pageURL, err := s.fetchDocument(http.MethodGet, login.LoginURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to load login page: %v", err)
+	}
+
+	form := findLoginForm(doc)
+	if form == nil {
+		return fmt.Errorf("no login form found on %s", login.LoginURL)
+	}
+
+	values, err := fillLoginForm(form, login)
+	if err != nil {
+		return err
+	}
+
+	action := pageURL
+	if attr := getAttr(form, "action"); attr != "" {
+		actionURL, err := url.Parse(attr)
+		if err != nil {
+			return fmt.Errorf("invalid login form action %q: %v", attr, err)
+		}
+		action = pageURL.ResolveReference(actionURL)
+	}
+
+	method := http.MethodPost
+	if strings.EqualFold(getAttr(form, "method"), http.MethodGet) {
+		method = http.MethodGet
+	}
+
+	// Submit the form and check the response looks like a signed-in page
+	result, _, err := s.fetchDocument(method, action.String(), values)
+	if err != nil {
+		return fmt.Errorf("failed to submit login form: %v", err)
+	}
+
+	if login.SuccessText != "" {
+		if !strings.Contains(extractTextContent(result), login.SuccessText) {
+			return fmt.Errorf("login failed: %q not found after signing in", login.SuccessText)
+		}
+	} else if findLoginForm(result) != nil {
+		return fmt.Errorf("login failed: login form still present after signing in")
+	}
+
+	return nil
+}
+
+// fetchDocument requests a page through the crawl session and parses it,
+// returning the document and the final URL after redirects.
+func (s *session) fetchDocument(method, target string, form url.Values) (*html.Node, *url.URL, error) {
+	if method == http.MethodGet && form != nil {
+		targetURL, err := url.Parse(target)
+		if err != nil {
+			return nil, nil, err
+		}
+		targetURL.RawQuery = form.Encode()
+		target, form = targetURL.String(), nil
+	}
+
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+
+	req, err := s.newRequest(method, target, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	resp, err := s.do(s.pageClient, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return nil, nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	page, err := readBody(resp, s.limits.MaxBodyBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !isHTMLMediaType(page.MediaType) {
+		return nil, nil, fmt.Errorf("unexpected content type %s", page.MediaType)
+	}
+
+	decoded, _ := decodeHTML(page.Data, page.ContentType)
+	doc, err := html.Parse(bytes.NewReader(decoded))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return doc, resp.Request.URL, nil
+}
+
+// findLoginForm returns the form most likely to be a login form, falling back
+// to the first form with a password field.
+func findLoginForm(doc *html.Node) *html.Node {
+	var best, fallback *html.Node
+	bestConfidence := 0.0
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "form" {
+			form := analyzeForm(n, &url.URL{})
+			if form.Kind == FormKindLogin && form.Confidence > bestConfidence {
+				best, bestConfidence = n, form.Confidence
+			}
+			if fallback == nil && hasPasswordField(form) {
+				fallback = n
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	if best != nil {
+		return best
+	}
+	return fallback
+}
+
+func hasPasswordField(form models.Form) bool {
+	for _, field := range form.Fields {
+		if field.Type == "password" {
+			return true
+		}
+	}
+	return false
+}
+
+// fillLoginForm collects the form's existing values, such as hidden CSRF
+// tokens, and sets the username and password fields.
+func fillLoginForm(form *html.Node, login *models.FormLogin) (url.Values, error) {
+	values := url.Values{}
+	usernameField, passwordField := login.UsernameField, login.PasswordField
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "input" {
+			name := getAttr(n, "name")
+			inputType := strings.ToLower(getAttr(n, "type"))
+
+			switch {
+			case name == "":
+			case inputType == "password":
+				if passwordField == "" {
+					passwordField = name
+				}
+			case inputType == "text" || inputType == "email" || inputType == "":
+				if usernameField == "" {
+					usernameField = name
+				}
+				values.Set(name, getAttr(n, "value"))
+			case inputType == "checkbox" || inputType == "radio":
+				if hasAttr(n, "checked") {
+					values.Add(name, getAttrDefault(n, "value", "on"))
+				}
+			case inputType == "submit" || inputType == "button" || inputType == "image" || inputType == "reset":
+			default:
+				values.Set(name, getAttr(n, "value"))
+			}
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(form)
+
+	if usernameField == "" || passwordField == "" {
+		return nil, fmt.Errorf("could not identify username and password fields in login form")
+	}
+
+	values.Set(usernameField, login.Username)
+	values.Set(passwordField, login.Password)
+	return values, nil
+}
+
+func getAttr(n *html.Node, key string) string {
+	return getAttrDefault(n, key, "")
+}
+
+func getAttrDefault(n *html.Node, key, fallback string) string {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val
+		}
+	}
+	return fallback
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return true
+		}
+	}
+	return false
+}
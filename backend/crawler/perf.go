@@ -0,0 +1,210 @@
+package crawler
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Budget names recorded on crawl_results.budget_violations.
+const (
+	BudgetTTFB             = "ttfb"
+	BudgetPageBytes        = "page_bytes"
+	BudgetTotalBytes       = "total_bytes"
+	BudgetSubresourceCount = "subresource_count"
+)
+
+// pageAcceptEncoding lists the encodings decoded by decompressBody. The page
+// request asks for them explicitly so the transfer size can be measured.
+const pageAcceptEncoding = "gzip, deflate"
+
+// maxSubresources caps how many subresources are measured per page.
+const maxSubresources = 100
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.Reader.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// errUnsupportedEncoding is returned by decompressBody for a content encoding
+// it cannot decode. The body is left as received.
+var errUnsupportedEncoding = errors.New("unsupported content encoding")
+
+// decompressBody replaces the response body with a decoded stream. It returns
+// the counter for the bytes received on the wire and the content encoding,
+// "none" if the body was sent uncompressed.
+func decompressBody(resp *http.Response) (*countingReader, string, error) {
+	body := resp.Body
+	wire := &countingReader{Reader: body}
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+
+	var decoded io.Reader
+	switch encoding {
+	case "", "identity":
+		encoding = "none"
+		decoded = wire
+	case "gzip", "x-gzip":
+		reader, err := gzip.NewReader(wire)
+		if err != nil {
+			return nil, encoding, fmt.Errorf("invalid gzip body: %v", err)
+		}
+		decoded = reader
+	case "deflate":
+		// Some servers send raw DEFLATE data without the zlib wrapper
+		buffered := bufio.NewReader(wire)
+		if header, _ := buffered.Peek(2); !isZlibHeader(header) {
+			decoded = flate.NewReader(buffered)
+			break
+		}
+		reader, err := zlib.NewReader(buffered)
+		if err != nil {
+			return nil, encoding, fmt.Errorf("invalid deflate body: %v", err)
+		}
+		decoded = reader
+	default:
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{wire, body}
+		return wire, encoding, fmt.Errorf("%w %q", errUnsupportedEncoding, encoding)
+	}
+
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{decoded, body}
+	if encoding != "none" {
+		resp.ContentLength = -1
+		resp.Uncompressed = true
+	}
+	return wire, encoding, nil
+}
+
+// isZlibHeader reports whether a body starts with a zlib header: the deflate
+// method and a checksum making the first two bytes a multiple of 31.
+func isZlibHeader(header []byte) bool {
+	return len(header) == 2 && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0
+}
+
+// collectSubresource records the URL of a resource the page loads, such as a
+// script, stylesheet or image.
+func collectSubresource(n *html.Node, data *CrawlData, s *session) {
+	var ref string
+	switch n.Data {
+	case "script", "img", "iframe", "embed", "audio", "video", "source", "track":
+		ref = getAttr(n, "src")
+	case "link":
+		rel := strings.Fields(strings.ToLower(getAttr(n, "rel")))
+		for _, r := range rel {
+			if r == "stylesheet" || r == "icon" || r == "preload" || r == "modulepreload" {
+				ref = getAttr(n, "href")
+				break
+			}
+		}
+	case "object":
+		ref = getAttr(n, "data")
+	}
+
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return
+	}
+
+	refURL, err := url.Parse(ref)
+	if err != nil {
+		return
+	}
+	refURL = s.baseURL.ResolveReference(refURL)
+	if refURL.Scheme != "http" && refURL.Scheme != "https" {
+		return
+	}
+	refURL.Fragment = ""
+
+	key := refURL.String()
+	if data.seenSubresources[key] {
+		return
+	}
+	data.seenSubresources[key] = true
+	data.subresources = append(data.subresources, key)
+}
+
+// measureSubresources counts the page's subresources and adds up their sizes.
+func measureSubresources(data *CrawlData, s *session) {
+	data.SubresourceCount = len(data.subresources)
+
+	targets := data.subresources
+	if len(targets) > maxSubresources {
+		targets = targets[:maxSubresources]
+	}
+	for _, target := range targets {
+		data.SubresourceBytes += s.resourceSize(target)
+	}
+}
+
+// resourceSize returns the size of a resource, using Content-Length from a
+// HEAD request when available and downloading the body otherwise. Resources
+// that cannot be fetched count as zero bytes.
+func (s *session) resourceSize(target string) int64 {
+	req, err := s.newRequest(http.MethodHead, target, nil)
+	if err != nil {
+		return 0
+	}
+	if resp, err := s.do(s.linkClient, req); err == nil {
+		resp.Body.Close()
+		if resp.StatusCode < 400 && resp.ContentLength >= 0 {
+			return resp.ContentLength
+		}
+	}
+
+	req, err = s.newRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return 0
+	}
+	resp, err := s.do(s.linkClient, req)
+	if err != nil {
+		return 0
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return 0
+	}
+
+	n, _ := io.Copy(io.Discard, io.LimitReader(resp.Body, s.limits.MaxBodyBytes))
+	return n
+}
+
+// checkBudgets lists the configured performance budgets the page exceeds.
+func checkBudgets(data *CrawlData) []string {
+	violations := []string{}
+
+	if config.BudgetTTFBMs > 0 && int64(data.TTFBMs) > config.BudgetTTFBMs {
+		violations = append(violations, BudgetTTFB)
+	}
+	if config.BudgetPageBytes > 0 && data.HTMLBytes > config.BudgetPageBytes {
+		violations = append(violations, BudgetPageBytes)
+	}
+	if config.BudgetTotalBytes > 0 && data.HTMLTransferBytes+data.SubresourceBytes > config.BudgetTotalBytes {
+		violations = append(violations, BudgetTotalBytes)
+	}
+	if config.BudgetSubresources > 0 && int64(data.SubresourceCount) > config.BudgetSubresources {
+		violations = append(violations, BudgetSubresourceCount)
+	}
+
+	return violations
+}
@@ -0,0 +1,93 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+)
+
+const testPage = "<html><body><h1>Hello</h1></body></html>"
+
+func compressed(t *testing.T, encoding string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "zlib":
+		w = zlib.NewWriter(&buf)
+	case "raw":
+		w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	}
+	io.WriteString(w, testPage)
+	w.Close()
+	return buf.Bytes()
+}
+
+func TestDecompressBody(t *testing.T) {
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+		want     string
+	}{
+		{"identity", "", []byte(testPage), "none"},
+		{"gzip", "gzip", compressed(t, "gzip"), "gzip"},
+		{"zlib deflate", "deflate", compressed(t, "zlib"), "deflate"},
+		{"raw deflate", "Deflate", compressed(t, "raw"), "deflate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{
+				Header: http.Header{"Content-Encoding": {tt.encoding}},
+				Body:   io.NopCloser(bytes.NewReader(tt.body)),
+			}
+			wire, encoding, err := decompressBody(resp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != testPage {
+				t.Errorf("decoded body %q", got)
+			}
+			if encoding != tt.want {
+				t.Errorf("encoding %q, want %q", encoding, tt.want)
+			}
+			if wire.n != int64(len(tt.body)) {
+				t.Errorf("counted %d bytes on the wire, want %d", wire.n, len(tt.body))
+			}
+		})
+	}
+}
+
+func TestDecompressBodyUnsupportedEncoding(t *testing.T) {
+	body := []byte{0x1b, 0x28, 0x00, 0xf8}
+	resp := &http.Response{
+		Header: http.Header{"Content-Encoding": {"br"}},
+		Body:   io.NopCloser(bytes.NewReader(body)),
+	}
+
+	wire, encoding, err := decompressBody(resp)
+	if !errors.Is(err, errUnsupportedEncoding) {
+		t.Fatalf("got %v, want an unsupported encoding error", err)
+	}
+	if encoding != "br" {
+		t.Errorf("encoding %q, want br", encoding)
+	}
+
+	// The body is still readable as received so its size can be recorded
+	got, _ := io.ReadAll(resp.Body)
+	if !bytes.Equal(got, body) || wire.n != int64(len(body)) {
+		t.Errorf("body %x, counted %d bytes", got, wire.n)
+	}
+}
@@ -0,0 +1,361 @@
+package crawler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"webcrawler/database"
+	"webcrawler/models"
+	"webcrawler/secrets"
+)
+
+const (
+	defaultPageTimeout      = 30 * time.Second
+	defaultLinkTimeout      = 10 * time.Second
+	defaultPageMaxRedirects = 10
+	defaultLinkMaxRedirects = 5
+)
+
+// session holds the effective crawl profile, limits and HTTP clients for one
+// crawl. Its requests are cancelled with ctx.
+type session struct {
+	ctx        context.Context
+	limits     models.CrawlerLimits
+	profile    models.CrawlProfile
+	baseURL    *url.URL
+	proxy      proxyFunc
+	pageClient *http.Client
+	linkClient *http.Client
+
+	mu      sync.Mutex
+	timings []models.RequestTiming
+}
+
+func newSession(ctx context.Context, profile models.CrawlProfile, baseURL *url.URL) (*session, error) {
+	proxy, err := profileProxy(profile.Proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	pageTimeout, linkTimeout := defaultPageTimeout, defaultLinkTimeout
+	if profile.PageTimeout > 0 {
+		pageTimeout = time.Duration(profile.PageTimeout) * time.Second
+	}
+	if profile.LinkTimeout > 0 {
+		linkTimeout = time.Duration(profile.LinkTimeout) * time.Second
+	}
+
+	pageRedirects, linkRedirects := defaultPageMaxRedirects, defaultLinkMaxRedirects
+	if profile.MaxRedirects != nil {
+		pageRedirects, linkRedirects = *profile.MaxRedirects, *profile.MaxRedirects
+	}
+
+	s := &session{
+		ctx:        ctx,
+		limits:     Limits(),
+		profile:    profile,
+		baseURL:    baseURL,
+		proxy:      proxy,
+		pageClient: newClient(pageTimeout, pageRedirects),
+		linkClient: newClient(linkTimeout, linkRedirects),
+	}
+	s.pageClient.CheckRedirect = s.checkRedirect(pageRedirects)
+	s.linkClient.CheckRedirect = s.checkRedirect(linkRedirects)
+	return s, nil
+}
+
+// checkRedirect limits redirects and drops the profile's headers when a
+// redirect leaves the crawled site. The client itself drops cookies and
+// credentials there.
+func (s *session) checkRedirect(max int) func(*http.Request, []*http.Request) error {
+	limit := limitRedirects(max)
+	return func(req *http.Request, via []*http.Request) error {
+		if err := limit(req, via); err != nil {
+			return err
+		}
+		if !strings.EqualFold(req.URL.Hostname(), s.baseURL.Hostname()) {
+			for name := range s.profile.Headers {
+				req.Header.Del(name)
+			}
+		}
+		return nil
+	}
+}
+
+// newRequest builds a request carrying the profile's User-Agent. Headers,
+// cookies and credentials are only sent to the crawled site itself.
+func (s *session) newRequest(method, target string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(s.ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	if s.proxy != nil {
+		req = withProxy(req, s.proxy)
+	}
+
+	req.Header.Set("User-Agent", config.UserAgent)
+	if s.profile.UserAgent != "" {
+		req.Header.Set("User-Agent", s.profile.UserAgent)
+	}
+
+	// Headers often carry tokens, so like cookies and credentials they are
+	// not sent to other sites
+	if strings.EqualFold(req.URL.Hostname(), s.baseURL.Hostname()) {
+		for name, value := range s.profile.Headers {
+			req.Header.Set(name, value)
+		}
+		for _, cookie := range s.profile.Cookies {
+			req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+		}
+		if s.profile.BasicAuth != nil {
+			req.SetBasicAuth(s.profile.BasicAuth.Username, s.profile.BasicAuth.Password)
+		}
+	}
+
+	// Leave compression to the transport so bodies arrive decoded
+	req.Header.Del("Accept-Encoding")
+
+	return req, nil
+}
+
+// loadProfile returns the effective profile for a URL: the default profile
+// of the user running the crawl overlaid with the URL's own profile. The
+// defaults of whoever added the URL are never used, so one member's
+// credentials do not follow a URL into crawls started by others.
+func loadProfile(urlID int) (models.CrawlProfile, error) {
+	var urlProfile, userProfile sql.NullString
+	query := `
+		SELECT u.crawl_profile, us.crawl_profile
+		FROM urls u
+		LEFT JOIN users us ON us.id = u.started_by
+		WHERE u.id = ?
+	`
+	if err := database.DB.QueryRow(query, urlID).Scan(&urlProfile, &userProfile); err != nil {
+		return models.CrawlProfile{}, err
+	}
+
+	var base, override models.CrawlProfile
+	if userProfile.Valid {
+		if err := json.Unmarshal([]byte(userProfile.String), &base); err != nil {
+			return models.CrawlProfile{}, fmt.Errorf("invalid user crawl profile: %v", err)
+		}
+	}
+	if urlProfile.Valid {
+		if err := json.Unmarshal([]byte(urlProfile.String), &override); err != nil {
+			return models.CrawlProfile{}, fmt.Errorf("invalid URL crawl profile: %v", err)
+		}
+	}
+
+	merged, err := OpenProfile(mergeProfiles(base, override))
+	if err != nil {
+		return models.CrawlProfile{}, fmt.Errorf("failed to decrypt crawl profile: %v", err)
+	}
+	return merged, nil
+}
+
+// SealProfile returns a copy of the profile with its secrets encrypted for
+// storage: passwords, cookie values and header values. Values that are
+// already encrypted are left alone.
+func SealProfile(profile models.CrawlProfile) (models.CrawlProfile, error) {
+	return transformSecrets(profile, func(value string) (string, error) {
+		if secrets.IsEncrypted(value) {
+			return value, nil
+		}
+		return secrets.Encrypt(value)
+	})
+}
+
+// OpenProfile reverses SealProfile.
+func OpenProfile(profile models.CrawlProfile) (models.CrawlProfile, error) {
+	return transformSecrets(profile, secrets.Decrypt)
+}
+
+func transformSecrets(profile models.CrawlProfile, transform func(string) (string, error)) (models.CrawlProfile, error) {
+	if profile.Headers != nil {
+		headers := make(map[string]string, len(profile.Headers))
+		for name, value := range profile.Headers {
+			transformed, err := transform(value)
+			if err != nil {
+				return profile, err
+			}
+			headers[name] = transformed
+		}
+		profile.Headers = headers
+	}
+
+	if profile.Cookies != nil {
+		cookies := make([]models.Cookie, len(profile.Cookies))
+		for i, cookie := range profile.Cookies {
+			value, err := transform(cookie.Value)
+			if err != nil {
+				return profile, err
+			}
+			cookies[i] = models.Cookie{Name: cookie.Name, Value: value}
+		}
+		profile.Cookies = cookies
+	}
+
+	if profile.BasicAuth != nil {
+		basicAuth := *profile.BasicAuth
+		password, err := transform(basicAuth.Password)
+		if err != nil {
+			return profile, err
+		}
+		basicAuth.Password = password
+		profile.BasicAuth = &basicAuth
+	}
+
+	if profile.Login != nil {
+		login := *profile.Login
+		password, err := transform(login.Password)
+		if err != nil {
+			return profile, err
+		}
+		login.Password = password
+		profile.Login = &login
+	}
+
+	if profile.Proxy != nil {
+		proxy := *profile.Proxy
+		password, err := transform(proxy.Password)
+		if err != nil {
+			return profile, err
+		}
+		proxy.Password = password
+		profile.Proxy = &proxy
+	}
+
+	return profile, nil
+}
+
+// SealStoredProfiles encrypts the secrets of profiles stored before they
+// were encrypted, or before cookies and headers were. Profiles that fail to
+// decode are logged and skipped.
+func SealStoredProfiles() {
+	for _, table := range []string{"users", "urls"} {
+		if err := sealStoredProfiles(table); err != nil {
+			log.Printf("Failed to encrypt stored crawl profiles in %s: %v", table, err)
+		}
+	}
+}
+
+func sealStoredProfiles(table string) error {
+	rows, err := database.DB.Query("SELECT id, crawl_profile FROM " + table + " WHERE crawl_profile IS NOT NULL")
+	if err != nil {
+		return err
+	}
+
+	stored := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var raw string
+		if err := rows.Scan(&id, &raw); err != nil {
+			rows.Close()
+			return err
+		}
+		stored[id] = raw
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	sealed := 0
+	for id, raw := range stored {
+		var profile models.CrawlProfile
+		if err := json.Unmarshal([]byte(raw), &profile); err != nil {
+			log.Printf("Skipping invalid crawl profile of %s %d: %v", table, id, err)
+			continue
+		}
+		if !hasPlaintextSecrets(profile) {
+			continue
+		}
+
+		profile, err := SealProfile(profile)
+		if err != nil {
+			return err
+		}
+		encoded, err := json.Marshal(profile)
+		if err != nil {
+			return err
+		}
+		if _, err := database.DB.Exec("UPDATE "+table+" SET crawl_profile = ? WHERE id = ?", string(encoded), id); err != nil {
+			return err
+		}
+		sealed++
+	}
+
+	if sealed > 0 {
+		log.Printf("Encrypted secrets of %d stored crawl profiles in %s", sealed, table)
+	}
+	return nil
+}
+
+func hasPlaintextSecrets(profile models.CrawlProfile) bool {
+	plaintext := false
+	transformSecrets(profile, func(value string) (string, error) {
+		if value != "" && !secrets.IsEncrypted(value) {
+			plaintext = true
+		}
+		return value, nil
+	})
+	return plaintext
+}
+
+func mergeProfiles(base, override models.CrawlProfile) models.CrawlProfile {
+	merged := base
+
+	if override.UserAgent != "" {
+		merged.UserAgent = override.UserAgent
+	}
+	if override.BasicAuth != nil {
+		merged.BasicAuth = override.BasicAuth
+	}
+	if override.Login != nil {
+		merged.Login = override.Login
+	}
+	if override.Proxy != nil {
+		merged.Proxy = override.Proxy
+	}
+	if override.PageTimeout > 0 {
+		merged.PageTimeout = override.PageTimeout
+	}
+	if override.LinkTimeout > 0 {
+		merged.LinkTimeout = override.LinkTimeout
+	}
+	if override.MaxRedirects != nil {
+		merged.MaxRedirects = override.MaxRedirects
+	}
+
+	merged.Headers = make(map[string]string, len(base.Headers)+len(override.Headers))
+	for name, value := range base.Headers {
+		merged.Headers[name] = value
+	}
+	for name, value := range override.Headers {
+		merged.Headers[name] = value
+	}
+
+	// Cookies from the URL profile replace default cookies of the same name
+	merged.Cookies = nil
+	overridden := make(map[string]bool)
+	for _, cookie := range override.Cookies {
+		overridden[cookie.Name] = true
+	}
+	for _, cookie := range base.Cookies {
+		if !overridden[cookie.Name] {
+			merged.Cookies = append(merged.Cookies, cookie)
+		}
+	}
+	merged.Cookies = append(merged.Cookies, override.Cookies...)
+
+	return merged
+}
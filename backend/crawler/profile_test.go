@@ -0,0 +1,223 @@
+package crawler
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"webcrawler/database"
+	"webcrawler/models"
+)
+
+func TestCredentialsStayOnSite(t *testing.T) {
+	allowLocal(t)
+
+	received := make(chan http.Header, 1)
+	offsite := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Clone()
+	}))
+	defer offsite.Close()
+	// Same server, reached by another hostname
+	offsiteURL := strings.Replace(offsite.URL, "127.0.0.1", "localhost", 1)
+
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/away" {
+			http.Redirect(w, r, offsiteURL+"/landing", http.StatusFound)
+			return
+		}
+		received <- r.Header.Clone()
+	}))
+	defer site.Close()
+
+	baseURL, _ := url.Parse(site.URL)
+	s, err := newSession(context.Background(), models.CrawlProfile{
+		Headers: map[string]string{"X-API-Key": "secret-key", "Authorization": "Bearer secret"},
+		Cookies: []models.Cookie{{Name: "session", Value: "secret-cookie"}},
+	}, baseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fetch := func(target string) http.Header {
+		t.Helper()
+		req, err := s.newRequest(http.MethodGet, target, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := s.linkClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return <-received
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		onSite bool
+	}{
+		{"crawled site", site.URL + "/page", true},
+		{"off-site link", offsiteURL + "/page", false},
+		{"redirect off the site", site.URL + "/away", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := fetch(tt.target)
+			for _, name := range []string{"X-Api-Key", "Authorization", "Cookie"} {
+				if sent := header.Get(name) != ""; sent != tt.onSite {
+					t.Errorf("%s sent: %v, want %v", name, sent, tt.onSite)
+				}
+			}
+		})
+	}
+}
+
+func TestSealProfile(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	profile := models.CrawlProfile{
+		Headers:   map[string]string{"Authorization": "Bearer secret-token"},
+		Cookies:   []models.Cookie{{Name: "session", Value: "secret-cookie"}},
+		BasicAuth: &models.BasicAuth{Username: "alice", Password: "secret-basic"},
+	}
+
+	sealed, err := SealProfile(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hasPlaintextSecrets(sealed) || !hasPlaintextSecrets(profile) {
+		t.Fatalf("sealed profile has plaintext secrets: %+v", sealed)
+	}
+	if sealed.Cookies[0].Name != "session" || profile.Cookies[0].Value != "secret-cookie" {
+		t.Error("sealing changed names or the original profile")
+	}
+
+	// Sealing twice does not encrypt twice
+	again, err := SealProfile(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Headers["Authorization"] != sealed.Headers["Authorization"] {
+		t.Error("sealed value was encrypted again")
+	}
+
+	opened, err := OpenProfile(again)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opened.Headers["Authorization"] != "Bearer secret-token" || opened.Cookies[0].Value != "secret-cookie" ||
+		opened.BasicAuth.Password != "secret-basic" {
+		t.Errorf("opened profile differs: %+v", opened)
+	}
+}
+
+// profileStore stands in for the urls and users rows loadProfile joins. The
+// users row is found through the urls column named in the join.
+type profileStore struct {
+	urls  map[int]map[string]driver.Value
+	users map[int64]driver.Value
+}
+
+var joinColumn = regexp.MustCompile(`us\.id = u\.(\w+)`)
+
+func (s *profileStore) Connect(context.Context) (driver.Conn, error) { return s, nil }
+func (s *profileStore) Driver() driver.Driver                        { return nil }
+
+func (s *profileStore) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements not supported")
+}
+func (s *profileStore) Close() error              { return nil }
+func (s *profileStore) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+func (s *profileStore) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	match := joinColumn.FindStringSubmatch(query)
+	if match == nil {
+		return nil, errors.New("unexpected query: " + query)
+	}
+	row, ok := s.urls[int(args[0].Value.(int64))]
+	if !ok {
+		return &profileRows{}, nil
+	}
+	var userProfile driver.Value
+	if userID, ok := row[match[1]].(int64); ok {
+		userProfile = s.users[userID]
+	}
+	return &profileRows{values: []driver.Value{row["crawl_profile"], userProfile}}, nil
+}
+
+type profileRows struct {
+	values []driver.Value
+}
+
+func (r *profileRows) Columns() []string { return []string{"url_profile", "user_profile"} }
+func (r *profileRows) Close() error      { return nil }
+
+func (r *profileRows) Next(dest []driver.Value) error {
+	if r.values == nil {
+		return io.EOF
+	}
+	copy(dest, r.values)
+	r.values = nil
+	return nil
+}
+
+func TestLoadProfileUsesCrawlStarter(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	seal := func(profile models.CrawlProfile) driver.Value {
+		sealed, err := SealProfile(profile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encoded, _ := json.Marshal(sealed)
+		return string(encoded)
+	}
+
+	// Alice added the URL to a shared workspace; Bob reruns it
+	const alice, bob = 1, 2
+	store := &profileStore{
+		urls: map[int]map[string]driver.Value{
+			10: {"user_id": int64(alice), "started_by": int64(bob), "crawl_profile": seal(models.CrawlProfile{UserAgent: "SharedBot"})},
+			11: {"user_id": int64(alice), "started_by": nil, "crawl_profile": nil},
+		},
+		users: map[int64]driver.Value{
+			alice: seal(models.CrawlProfile{BasicAuth: &models.BasicAuth{Username: "alice", Password: "alice-secret"}}),
+			bob:   seal(models.CrawlProfile{Headers: map[string]string{"Authorization": "Bearer bob-token"}}),
+		},
+	}
+	saved := database.DB
+	database.DB = sql.OpenDB(store)
+	t.Cleanup(func() {
+		database.DB.Close()
+		database.DB = saved
+	})
+
+	profile, err := loadProfile(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.BasicAuth != nil {
+		t.Errorf("rerun by Bob used the credentials of Alice, who added the URL: %+v", profile.BasicAuth)
+	}
+	if profile.Headers["Authorization"] != "Bearer bob-token" || profile.UserAgent != "SharedBot" {
+		t.Errorf("got %+v, want Bob's defaults with the URL's profile", profile)
+	}
+
+	// Without a known starter only the URL's own profile applies
+	profile, err = loadProfile(11)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.BasicAuth != nil || len(profile.Headers) != 0 {
+		t.Errorf("got %+v, want an empty profile", profile)
+	}
+}
@@ -0,0 +1,197 @@
+package crawler
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"webcrawler/database"
+	"webcrawler/models"
+)
+
+const (
+	CrawlStateWaiting = "waiting"
+	CrawlStateRunning = "running"
+)
+
+// task is a crawl in the queue. Crawls wait in line until fewer than
+// MaxConcurrentCrawls are running.
+type task struct {
+	urlID     int
+	url       string
+	state     string
+	queuedAt  time.Time
+	startedAt time.Time
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	ready  chan struct{}
+}
+
+var queue = struct {
+	sync.Mutex
+	limits  models.CrawlerLimits
+	tasks   map[int]*task
+	waiting []*task
+	running int
+}{
+	limits: models.CrawlerLimits{
+		MaxConcurrentCrawls: 10,
+		MaxBodyBytes:        10 << 20,
+		RetryAttempts:       3,
+	},
+	tasks: make(map[int]*task),
+}
+
+// enqueue puts a crawl of the URL in line, cancelling any earlier crawl of
+// the same URL.
+func enqueue(urlID int, url string) *task {
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &task{
+		urlID:    urlID,
+		url:      url,
+		state:    CrawlStateWaiting,
+		queuedAt: time.Now(),
+		ctx:      ctx,
+		cancel:   cancel,
+		ready:    make(chan struct{}),
+	}
+
+	queue.Lock()
+	defer queue.Unlock()
+	if earlier, ok := queue.tasks[urlID]; ok {
+		earlier.cancel()
+	}
+	queue.tasks[urlID] = t
+	queue.waiting = append(queue.waiting, t)
+	dispatch()
+	return t
+}
+
+// dispatch starts waiting crawls while slots are free. The queue must be
+// locked.
+func dispatch() {
+	for len(queue.waiting) > 0 && queue.running < queue.limits.MaxConcurrentCrawls {
+		t := queue.waiting[0]
+		queue.waiting = queue.waiting[1:]
+		t.state = CrawlStateRunning
+		t.startedAt = time.Now()
+		queue.running++
+		close(t.ready)
+	}
+}
+
+// wait blocks until the crawl may run. It returns false when the crawl was
+// cancelled first.
+func (t *task) wait() bool {
+	select {
+	case <-t.ready:
+		return t.ctx.Err() == nil
+	case <-t.ctx.Done():
+		return false
+	}
+}
+
+// finish takes the crawl out of the queue and frees its slot.
+func (t *task) finish() {
+	t.cancel()
+
+	queue.Lock()
+	defer queue.Unlock()
+	if queue.tasks[t.urlID] == t {
+		delete(queue.tasks, t.urlID)
+	}
+	if t.state == CrawlStateRunning {
+		queue.running--
+	} else {
+		for i, waiting := range queue.waiting {
+			if waiting == t {
+				queue.waiting = append(queue.waiting[:i], queue.waiting[i+1:]...)
+				break
+			}
+		}
+	}
+	dispatch()
+}
+
+// Cancel stops the crawl of a URL, whether it is running or waiting, and
+// reports whether there was one. A cancelled crawl leaves the URL's status
+// alone.
+func Cancel(urlID int) bool {
+	queue.Lock()
+	defer queue.Unlock()
+
+	t, ok := queue.tasks[urlID]
+	if !ok {
+		return false
+	}
+	delete(queue.tasks, urlID)
+	t.cancel()
+	return true
+}
+
+// ResetInterrupted puts URLs that were still marked running when the server
+// last stopped back in the queued state. The queue only lives in memory, so
+// those crawls are gone, and their rows would otherwise count against the
+// concurrent crawl quota forever.
+func ResetInterrupted() {
+	result, err := database.DB.Exec("UPDATE urls SET status = 'queued' WHERE status = 'running'")
+	if err != nil {
+		log.Printf("Failed to reset interrupted crawls: %v", err)
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows > 0 {
+		log.Printf("Reset %d crawls interrupted by a restart", rows)
+	}
+}
+
+// Queue returns the crawls on this server, oldest first, with the number
+// running and waiting. Cancelled crawls hold their slot until they stop.
+func Queue() models.CrawlQueue {
+	queue.Lock()
+	defer queue.Unlock()
+
+	crawls := make([]models.ActiveCrawl, 0, len(queue.tasks))
+	for _, t := range queue.tasks {
+		crawl := models.ActiveCrawl{
+			URLID:    t.urlID,
+			URL:      t.url,
+			State:    t.state,
+			QueuedAt: t.queuedAt,
+		}
+		if t.state == CrawlStateRunning {
+			startedAt := t.startedAt
+			crawl.StartedAt = &startedAt
+		}
+		crawls = append(crawls, crawl)
+	}
+	sort.Slice(crawls, func(i, j int) bool {
+		return crawls[i].QueuedAt.Before(crawls[j].QueuedAt)
+	})
+
+	return models.CrawlQueue{
+		MaxConcurrentCrawls: queue.limits.MaxConcurrentCrawls,
+		Running:             queue.running,
+		Waiting:             len(queue.waiting),
+		Crawls:              crawls,
+	}
+}
+
+// Limits returns the crawler limits in effect.
+func Limits() models.CrawlerLimits {
+	queue.Lock()
+	defer queue.Unlock()
+	return queue.limits
+}
+
+// SetLimits changes the crawler limits. Crawls already running keep the
+// limits they started with; raising MaxConcurrentCrawls starts waiting
+// crawls at once.
+func SetLimits(limits models.CrawlerLimits) {
+	queue.Lock()
+	defer queue.Unlock()
+	queue.limits = limits
+	dispatch()
+}
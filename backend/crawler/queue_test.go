@@ -0,0 +1,63 @@
+package crawler
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"webcrawler/database"
+)
+
+// statusStore stands in for the status column of urls.
+type statusStore struct {
+	statuses map[int]string
+}
+
+func (s *statusStore) Connect(context.Context) (driver.Conn, error) { return s, nil }
+func (s *statusStore) Driver() driver.Driver                        { return nil }
+
+func (s *statusStore) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements not supported")
+}
+func (s *statusStore) Close() error              { return nil }
+func (s *statusStore) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+func (s *statusStore) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if query != "UPDATE urls SET status = 'queued' WHERE status = 'running'" {
+		return nil, errors.New("unexpected statement: " + query)
+	}
+	var reset int64
+	for id, status := range s.statuses {
+		if status == "running" {
+			s.statuses[id] = "queued"
+			reset++
+		}
+	}
+	return driver.RowsAffected(reset), nil
+}
+
+func TestResetInterrupted(t *testing.T) {
+	store := &statusStore{statuses: map[int]string{
+		1: "running",
+		2: "completed",
+		3: "running",
+		4: "failed",
+	}}
+	saved := database.DB
+	database.DB = sql.OpenDB(store)
+	t.Cleanup(func() {
+		database.DB.Close()
+		database.DB = saved
+	})
+
+	ResetInterrupted()
+
+	want := map[int]string{1: "queued", 2: "completed", 3: "queued", 4: "failed"}
+	for id, status := range want {
+		if store.statuses[id] != status {
+			t.Errorf("URL %d: status %s, want %s", id, store.statuses[id], status)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package crawler
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Error classes recorded on broken_links.error_class.
+const (
+	ErrorClassTimeout        = "timeout"
+	ErrorClassDNS            = "dns"
+	ErrorClassConnection     = "connection"
+	ErrorClassTLS            = "tls"
+	ErrorClassRedirects      = "redirects"
+	ErrorClassBlockedAddress = "blocked_address"
+	ErrorClassNetwork        = "network"
+	ErrorClassRateLimited    = "rate_limited"
+	ErrorClassClientError    = "client_error"
+	ErrorClassServerError    = "server_error"
+	ErrorClassSoft404        = "soft_404"
+	ErrorClassMissingAnchor  = "missing_anchor"
+)
+
+// doRetry sends a request, retrying timeouts, dropped connections and
+// temporary server errors with exponential backoff. Only GET and HEAD
+// requests are retried. It returns the final response and the number of
+// attempts made.
+func (s *session) doRetry(client *http.Client, req *http.Request) (*http.Response, *requestTimer, int, error) {
+	attempts := s.limits.RetryAttempts
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		attempts = 1
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, timer, err := s.send(client, req.Clone(req.Context()))
+
+		if attempt >= attempts {
+			return resp, timer, attempt, err
+		}
+
+		var delay time.Duration
+		switch {
+		case err != nil && retryableError(err):
+			delay = backoff(attempt)
+		case err == nil && retryableStatus(resp.StatusCode):
+			delay = retryAfter(resp, time.Now())
+			if delay < 0 {
+				delay = backoff(attempt)
+			}
+			// Drain a little of the body so the connection can be reused
+			io.CopyN(io.Discard, resp.Body, 4<<10)
+			resp.Body.Close()
+		default:
+			return resp, timer, attempt, err
+		}
+
+		if err := sleep(req.Context(), delay); err != nil {
+			return nil, timer, attempt, err
+		}
+	}
+}
+
+func retryableStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func retryableError(err error) bool {
+	switch classifyError(err) {
+	case ErrorClassTimeout, ErrorClassConnection:
+		return true
+	}
+	return false
+}
+
+// backoff returns the delay before the next attempt: the base delay doubled
+// for each attempt so far, capped at the maximum, with jitter so that
+// requests to the same host spread out.
+func backoff(attempt int) time.Duration {
+	delay := config.RetryBaseDelay << (attempt - 1)
+	if delay <= 0 || delay > config.RetryMaxDelay {
+		delay = config.RetryMaxDelay
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// retryAfter returns the delay requested by a 429 or 503 Retry-After header,
+// capped at the maximum delay, or -1 if there is none.
+func retryAfter(resp *http.Response, now time.Time) time.Duration {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return -1
+	}
+
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return -1
+	}
+
+	var delay time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		delay = time.Duration(seconds) * time.Second
+	} else if at, err := http.ParseTime(value); err == nil {
+		delay = at.Sub(now)
+	} else {
+		return -1
+	}
+
+	if delay < 0 {
+		delay = 0
+	}
+	if delay > config.RetryMaxDelay {
+		delay = config.RetryMaxDelay
+	}
+	return delay
+}
+
+func sleep(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// classifyError sorts a request error into one of the error classes.
+func classifyError(err error) string {
+	var blocked *BlockedAddressError
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var certErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+
+	switch {
+	case errors.As(err, &blocked):
+		return ErrorClassBlockedAddress
+	case errors.Is(err, errTooManyRedirects):
+		return ErrorClassRedirects
+	case errors.As(err, &dnsErr):
+		return ErrorClassDNS
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorClassTimeout
+	case errors.As(err, &certErr), errors.As(err, &recordErr),
+		errors.As(err, &unknownAuthority), errors.As(err, &hostnameErr):
+		return ErrorClassTLS
+	case errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return ErrorClassConnection
+	}
+	return ErrorClassNetwork
+}
+
+// classifyStatus returns the error class for an unsuccessful status code.
+func classifyStatus(statusCode int) string {
+	switch {
+	case statusCode == http.StatusTooManyRequests:
+		return ErrorClassRateLimited
+	case statusCode >= 500:
+		return ErrorClassServerError
+	default:
+		return ErrorClassClientError
+	}
+}
@@ -0,0 +1,151 @@
+package crawler
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"webcrawler/models"
+)
+
+// requestTimer collects httptrace timestamps for one request.
+type requestTimer struct {
+	mu           sync.Mutex
+	start        time.Time
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	firstByte    time.Time
+	end          time.Time
+	reused       bool
+}
+
+func (t *requestTimer) trace() *httptrace.ClientTrace {
+	stamp := func(field *time.Time) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		// Keep the first timestamp when several addresses are tried
+		if field.IsZero() {
+			*field = time.Now()
+		}
+	}
+
+	return &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { stamp(&t.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { stamp(&t.dnsDone) },
+		ConnectStart:         func(string, string) { stamp(&t.connectStart) },
+		ConnectDone:          func(string, string, error) { stamp(&t.connectDone) },
+		TLSHandshakeStart:    func() { stamp(&t.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { stamp(&t.tlsDone) },
+		GotFirstResponseByte: func() { stamp(&t.firstByte) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			t.reused = info.Reused
+			t.mu.Unlock()
+		},
+	}
+}
+
+// timing converts the collected timestamps into a record ending at end.
+func (t *requestTimer) timing(req *http.Request, statusCode int, end time.Time) models.RequestTiming {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return models.RequestTiming{
+		URL:        req.URL.String(),
+		Method:     req.Method,
+		StatusCode: statusCode,
+		DNSMs:      millisBetween(t.dnsStart, t.dnsDone),
+		ConnectMs:  millisBetween(t.connectStart, t.connectDone),
+		TLSMs:      millisBetween(t.tlsStart, t.tlsDone),
+		TTFBMs:     millisBetween(t.start, t.firstByte),
+		TotalMs:    millisBetween(t.start, end),
+		Reused:     t.reused,
+	}
+}
+
+func millisBetween(start, end time.Time) int {
+	if start.IsZero() || end.IsZero() || end.Before(start) {
+		return 0
+	}
+	return int(end.Sub(start).Milliseconds())
+}
+
+// timedBody records the request timing once the body has been consumed.
+type timedBody struct {
+	io.ReadCloser
+	once   sync.Once
+	finish func()
+}
+
+func (b *timedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.once.Do(b.finish)
+	}
+	return n, err
+}
+
+func (b *timedBody) Close() error {
+	b.once.Do(b.finish)
+	return b.ReadCloser.Close()
+}
+
+// phases returns the time to first byte and the time spent downloading the
+// body. The download time is zero until the body has been consumed.
+func (t *requestTimer) phases() (ttfbMs, downloadMs int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return millisBetween(t.start, t.firstByte), millisBetween(t.firstByte, t.end)
+}
+
+// do sends a request, retrying transient failures, and records the timing of
+// each attempt on the session.
+func (s *session) do(client *http.Client, req *http.Request) (*http.Response, error) {
+	resp, _, err := s.doTimed(client, req)
+	return resp, err
+}
+
+// doTimed is do, also returning the timer of the final attempt.
+func (s *session) doTimed(client *http.Client, req *http.Request) (*http.Response, *requestTimer, error) {
+	resp, timer, _, err := s.doRetry(client, req)
+	return resp, timer, err
+}
+
+// send makes a single attempt with tracing enabled. Its timing is recorded
+// when the response body is read to the end or closed.
+func (s *session) send(client *http.Client, req *http.Request) (*http.Response, *requestTimer, error) {
+	timer := &requestTimer{}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), timer.trace()))
+	timer.start = time.Now()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		s.recordTiming(timer.timing(req, 0, time.Now()))
+		return nil, timer, err
+	}
+
+	resp.Body = &timedBody{
+		ReadCloser: resp.Body,
+		finish: func() {
+			end := time.Now()
+			timer.mu.Lock()
+			timer.end = end
+			timer.mu.Unlock()
+			s.recordTiming(timer.timing(req, resp.StatusCode, end))
+		},
+	}
+	return resp, timer, nil
+}
+
+func (s *session) recordTiming(timing models.RequestTiming) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.timings = append(s.timings, timing)
+}
@@ -2,11 +2,15 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"strings"
 
-	_ "github.com/go-sql-driver/mysql"
+	"webcrawler/urlnorm"
+
+	"github.com/go-sql-driver/mysql"
 )
 
 var DB *sql.DB
@@ -49,22 +53,95 @@ func createTables() error {
 		username VARCHAR(50) UNIQUE NOT NULL,
 		email VARCHAR(100) UNIQUE NOT NULL,
 		password_hash VARCHAR(255) NOT NULL,
+		crawl_profile JSON,
+		sessions_revoked_at TIMESTAMP NULL,
+		token_generation INT NOT NULL DEFAULT 0,
+		oidc_issuer VARCHAR(255) NULL,
+		oidc_subject VARCHAR(255) NULL,
+		totp_secret VARCHAR(255) NULL,
+		totp_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+		totp_last_step BIGINT NULL,
+		email_verified_at TIMESTAMP NULL DEFAULT NULL,
+		is_admin BOOLEAN NOT NULL DEFAULT FALSE,
+		disabled_at TIMESTAMP NULL DEFAULT NULL,
+		plan VARCHAR(20) NOT NULL DEFAULT 'free',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		UNIQUE KEY uniq_oidc_identity (oidc_issuer, oidc_subject)
+	);`
+
+	// Organizations group users who share workspaces. Every user also has a
+	// personal organization, which is deleted with them
+	organizationsTable := `
+	CREATE TABLE IF NOT EXISTS organizations (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		name VARCHAR(100) NOT NULL,
+		personal_user_id INT NULL UNIQUE,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		FOREIGN KEY (personal_user_id) REFERENCES users(id) ON DELETE CASCADE
+	);`
+
+	membersTable := `
+	CREATE TABLE IF NOT EXISTS organization_members (
+		organization_id INT NOT NULL,
+		user_id INT NOT NULL,
+		role ENUM('admin', 'editor', 'viewer') NOT NULL DEFAULT 'editor',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (organization_id, user_id),
+		FOREIGN KEY (organization_id) REFERENCES organizations(id) ON DELETE CASCADE,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		INDEX idx_user_id (user_id)
+	);`
+
+	// Pending invitations to join an organization, accepted by email link
+	invitesTable := `
+	CREATE TABLE IF NOT EXISTS organization_invites (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		organization_id INT NOT NULL,
+		email VARCHAR(100) NOT NULL,
+		role ENUM('admin', 'editor', 'viewer') NOT NULL DEFAULT 'editor',
+		token_hash CHAR(64) NOT NULL UNIQUE,
+		invited_by INT NULL,
+		expires_at TIMESTAMP NOT NULL,
+		accepted_at TIMESTAMP NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (organization_id) REFERENCES organizations(id) ON DELETE CASCADE,
+		FOREIGN KEY (invited_by) REFERENCES users(id) ON DELETE SET NULL,
+		INDEX idx_org_email (organization_id, email)
+	);`
+
+	// Workspaces hold the URLs; every member of the organization can use them
+	workspacesTable := `
+	CREATE TABLE IF NOT EXISTS workspaces (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		organization_id INT NOT NULL,
+		name VARCHAR(100) NOT NULL,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		FOREIGN KEY (organization_id) REFERENCES organizations(id) ON DELETE CASCADE,
+		UNIQUE KEY uniq_org_name (organization_id, name)
 	);`
 
-	// URLs table
+	// URLs table. user_id is whoever added the URL; shared URLs outlive them
 	urlTable := `
 	CREATE TABLE IF NOT EXISTS urls (
 		id INT AUTO_INCREMENT PRIMARY KEY,
-		user_id INT NOT NULL,
+		user_id INT NULL,
+		workspace_id INT NOT NULL,
 		url VARCHAR(2048) NOT NULL,
+		url_hash CHAR(64),
+		crawl_profile JSON,
 		status ENUM('queued', 'running', 'completed', 'failed') DEFAULT 'queued',
+		started_by INT NULL,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
-		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		CONSTRAINT fk_urls_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL,
+		CONSTRAINT fk_urls_workspace FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE,
 		INDEX idx_user_id (user_id),
-		INDEX idx_status (status)
+		INDEX idx_status (status),
+		INDEX idx_started_by (started_by, status),
+		UNIQUE KEY uniq_workspace_url (workspace_id, url_hash)
 	);`
 
 	// Crawl results table
@@ -84,6 +161,20 @@ func createTables() error {
 		external_links INT DEFAULT 0,
 		inaccessible_links INT DEFAULT 0,
 		has_login_form BOOLEAN DEFAULT FALSE,
+		outcome VARCHAR(20) NOT NULL DEFAULT 'html',
+		content_type VARCHAR(255) NOT NULL DEFAULT '',
+		content_length BIGINT NOT NULL DEFAULT 0,
+		truncated BOOLEAN NOT NULL DEFAULT FALSE,
+		encoding VARCHAR(50) NOT NULL DEFAULT '',
+		ttfb_ms INT NOT NULL DEFAULT 0,
+		download_ms INT NOT NULL DEFAULT 0,
+		html_bytes BIGINT NOT NULL DEFAULT 0,
+		html_transfer_bytes BIGINT NOT NULL DEFAULT 0,
+		compression VARCHAR(20) NOT NULL DEFAULT '',
+		subresource_count INT NOT NULL DEFAULT 0,
+		subresource_bytes BIGINT NOT NULL DEFAULT 0,
+		over_budget BOOLEAN NOT NULL DEFAULT FALSE,
+		budget_violations VARCHAR(255) NOT NULL DEFAULT '',
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
 		FOREIGN KEY (url_id) REFERENCES urls(id) ON DELETE CASCADE
@@ -97,11 +188,187 @@ func createTables() error {
 		url VARCHAR(2048) NOT NULL,
 		status_code INT NOT NULL,
 		error_message TEXT,
+		kind VARCHAR(20) NOT NULL DEFAULT 'broken',
+		attempts INT NOT NULL DEFAULT 1,
+		error_class VARCHAR(30) NOT NULL DEFAULT '',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (result_id) REFERENCES crawl_results(id) ON DELETE CASCADE
+	);`
+
+	// Forms found on crawled pages
+	formsTable := `
+	CREATE TABLE IF NOT EXISTS page_forms (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		result_id INT NOT NULL,
+		action VARCHAR(2048) NOT NULL,
+		method VARCHAR(10) NOT NULL,
+		kind VARCHAR(20) NOT NULL,
+		confidence DECIMAL(3,2) NOT NULL DEFAULT 0,
+		fields JSON NOT NULL,
+		has_csrf_token BOOLEAN NOT NULL DEFAULT FALSE,
+		insecure_submit BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (result_id) REFERENCES crawl_results(id) ON DELETE CASCADE
+	);`
+
+	// Per-request timings recorded during crawls
+	timingsTable := `
+	CREATE TABLE IF NOT EXISTS request_timings (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		result_id INT NOT NULL,
+		url VARCHAR(2048) NOT NULL,
+		method VARCHAR(10) NOT NULL,
+		status_code INT NOT NULL DEFAULT 0,
+		dns_ms INT NOT NULL DEFAULT 0,
+		connect_ms INT NOT NULL DEFAULT 0,
+		tls_ms INT NOT NULL DEFAULT 0,
+		ttfb_ms INT NOT NULL DEFAULT 0,
+		total_ms INT NOT NULL DEFAULT 0,
+		reused BOOLEAN NOT NULL DEFAULT FALSE,
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		FOREIGN KEY (result_id) REFERENCES crawl_results(id) ON DELETE CASCADE
 	);`
 
-	tables := []string{userTable, urlTable, resultTable, brokenLinksTable}
+	// Refresh tokens, one rotation chain per login session
+	refreshTokensTable := `
+	CREATE TABLE IF NOT EXISTS refresh_tokens (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		user_id INT NOT NULL,
+		session_id CHAR(32) NOT NULL,
+		token_hash CHAR(64) NOT NULL UNIQUE,
+		expires_at TIMESTAMP NOT NULL,
+		revoked_at TIMESTAMP NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		INDEX idx_session_id (session_id)
+	);`
+
+	// Access tokens revoked before they expire
+	revokedTokensTable := `
+	CREATE TABLE IF NOT EXISTS revoked_tokens (
+		jti CHAR(32) PRIMARY KEY,
+		expires_at TIMESTAMP NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		INDEX idx_expires_at (expires_at)
+	);`
+
+	// Personal API keys for scripts and CI
+	apiKeysTable := `
+	CREATE TABLE IF NOT EXISTS api_keys (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		user_id INT NOT NULL,
+		name VARCHAR(100) NOT NULL,
+		prefix VARCHAR(20) NOT NULL,
+		key_hash CHAR(64) NOT NULL UNIQUE,
+		scopes VARCHAR(255) NOT NULL,
+		expires_at TIMESTAMP NULL,
+		last_used_at TIMESTAMP NULL,
+		revoked_at TIMESTAMP NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);`
+
+	// Pending single sign-on logins: the PKCE state until the provider calls
+	// back, then a one-time code the frontend exchanges for tokens
+	oidcLoginsTable := `
+	CREATE TABLE IF NOT EXISTS oidc_logins (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		state VARCHAR(64) NULL UNIQUE,
+		nonce VARCHAR(64) NOT NULL,
+		code_verifier VARCHAR(128) NOT NULL,
+		user_id INT NULL,
+		exchange_hash CHAR(64) NULL UNIQUE,
+		expires_at TIMESTAMP NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);`
+
+	// One-time recovery codes for users with two-factor authentication
+	recoveryCodesTable := `
+	CREATE TABLE IF NOT EXISTS recovery_codes (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		user_id INT NOT NULL,
+		code_hash CHAR(64) NOT NULL,
+		used_at TIMESTAMP NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		UNIQUE KEY uniq_user_code (user_id, code_hash)
+	);`
+
+	// Single-use tokens sent in verification and password reset emails
+	emailTokensTable := `
+	CREATE TABLE IF NOT EXISTS email_tokens (
+		jti CHAR(32) PRIMARY KEY,
+		user_id INT NOT NULL,
+		purpose VARCHAR(30) NOT NULL,
+		email VARCHAR(100) NOT NULL,
+		expires_at TIMESTAMP NOT NULL,
+		used_at TIMESTAMP NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		INDEX idx_user_purpose (user_id, purpose)
+	);`
+
+	// Login attempts, for throttling password guessing and auditing failed
+	// logins. Failures are cleared, not deleted, by a successful login
+	loginAttemptsTable := `
+	CREATE TABLE IF NOT EXISTS login_attempts (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		username VARCHAR(255) NOT NULL,
+		user_id INT NULL,
+		ip VARCHAR(45) NOT NULL,
+		user_agent VARCHAR(255) NOT NULL DEFAULT '',
+		success BOOLEAN NOT NULL,
+		reason VARCHAR(30) NOT NULL,
+		cleared BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL,
+		INDEX idx_username_created (username, created_at),
+		INDEX idx_ip_created (ip, created_at)
+	);`
+
+	// Audit events are append-only: nothing updates or deletes them. They
+	// have no foreign keys so they outlive the users and URLs they name
+	auditEventsTable := `
+	CREATE TABLE IF NOT EXISTS audit_events (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		actor_id INT NULL,
+		actor VARCHAR(255) NOT NULL DEFAULT '',
+		api_key_id INT NULL,
+		action VARCHAR(50) NOT NULL,
+		target_type VARCHAR(30) NOT NULL DEFAULT '',
+		target_ids JSON NULL,
+		workspace_id INT NULL,
+		organization_id INT NULL,
+		details JSON NULL,
+		ip VARCHAR(45) NOT NULL DEFAULT '',
+		user_agent VARCHAR(255) NOT NULL DEFAULT '',
+		request_id VARCHAR(64) NOT NULL DEFAULT '',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		INDEX idx_audit_actor (actor_id, id),
+		INDEX idx_audit_workspace (workspace_id, id),
+		INDEX idx_audit_organization (organization_id, id),
+		INDEX idx_audit_action (action, id)
+	);`
+
+	// Crawls started by each user, for the daily crawl quota
+	crawlStartsTable := `
+	CREATE TABLE IF NOT EXISTS crawl_starts (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		user_id INT NOT NULL,
+		url_id INT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		INDEX idx_user_created (user_id, created_at)
+	);`
+
+	tables := []string{
+		userTable, organizationsTable, membersTable, invitesTable, workspacesTable,
+		urlTable, resultTable, brokenLinksTable, formsTable, timingsTable,
+		refreshTokensTable, revokedTokensTable, apiKeysTable, oidcLoginsTable,
+		recoveryCodesTable, emailTokensTable, loginAttemptsTable, auditEventsTable,
+		crawlStartsTable,
+	}
 
 	for _, table := range tables {
 		if _, err := DB.Exec(table); err != nil {
@@ -109,9 +376,189 @@ func createTables() error {
 		}
 	}
 
+	return migrate()
+}
+
+// migrate brings tables created by older versions up to date. Each statement
+// is applied once; "already exists" errors from MySQL are ignored, and data
+// migrations only touch rows that still need them.
+func migrate() error {
+	if err := migrateRoles(); err != nil {
+		return err
+	}
+
+	migrations := []string{
+		"ALTER TABLE urls ADD COLUMN url_hash CHAR(64) AFTER url",
+		"ALTER TABLE crawl_results ADD COLUMN outcome VARCHAR(20) NOT NULL DEFAULT 'html' AFTER has_login_form",
+		"ALTER TABLE crawl_results ADD COLUMN content_type VARCHAR(255) NOT NULL DEFAULT '' AFTER outcome",
+		"ALTER TABLE crawl_results ADD COLUMN content_length BIGINT NOT NULL DEFAULT 0 AFTER content_type",
+		"ALTER TABLE crawl_results ADD COLUMN truncated BOOLEAN NOT NULL DEFAULT FALSE AFTER content_length",
+		"ALTER TABLE crawl_results ADD COLUMN encoding VARCHAR(50) NOT NULL DEFAULT '' AFTER truncated",
+		"ALTER TABLE crawl_results ADD COLUMN ttfb_ms INT NOT NULL DEFAULT 0 AFTER encoding",
+		"ALTER TABLE crawl_results ADD COLUMN download_ms INT NOT NULL DEFAULT 0 AFTER ttfb_ms",
+		"ALTER TABLE crawl_results ADD COLUMN html_bytes BIGINT NOT NULL DEFAULT 0 AFTER download_ms",
+		"ALTER TABLE crawl_results ADD COLUMN html_transfer_bytes BIGINT NOT NULL DEFAULT 0 AFTER html_bytes",
+		"ALTER TABLE crawl_results ADD COLUMN compression VARCHAR(20) NOT NULL DEFAULT '' AFTER html_transfer_bytes",
+		"ALTER TABLE crawl_results ADD COLUMN subresource_count INT NOT NULL DEFAULT 0 AFTER compression",
+		"ALTER TABLE crawl_results ADD COLUMN subresource_bytes BIGINT NOT NULL DEFAULT 0 AFTER subresource_count",
+		"ALTER TABLE crawl_results ADD COLUMN over_budget BOOLEAN NOT NULL DEFAULT FALSE AFTER subresource_bytes",
+		"ALTER TABLE crawl_results ADD COLUMN budget_violations VARCHAR(255) NOT NULL DEFAULT '' AFTER over_budget",
+		"ALTER TABLE broken_links ADD COLUMN kind VARCHAR(20) NOT NULL DEFAULT 'broken' AFTER error_message",
+		"ALTER TABLE broken_links ADD COLUMN attempts INT NOT NULL DEFAULT 1 AFTER kind",
+		"ALTER TABLE broken_links ADD COLUMN error_class VARCHAR(30) NOT NULL DEFAULT '' AFTER attempts",
+		"ALTER TABLE users ADD COLUMN crawl_profile JSON AFTER password_hash",
+		"ALTER TABLE urls ADD COLUMN crawl_profile JSON AFTER url_hash",
+		"ALTER TABLE users ADD COLUMN sessions_revoked_at TIMESTAMP NULL AFTER crawl_profile",
+		"ALTER TABLE users ADD COLUMN oidc_issuer VARCHAR(255) NULL AFTER sessions_revoked_at",
+		"ALTER TABLE users ADD COLUMN oidc_subject VARCHAR(255) NULL AFTER oidc_issuer",
+		"ALTER TABLE users ADD UNIQUE KEY uniq_oidc_identity (oidc_issuer, oidc_subject)",
+		"ALTER TABLE users ADD COLUMN totp_secret VARCHAR(255) NULL AFTER oidc_subject",
+		"ALTER TABLE users ADD COLUMN totp_enabled BOOLEAN NOT NULL DEFAULT FALSE AFTER totp_secret",
+		"ALTER TABLE users ADD COLUMN totp_last_step BIGINT NULL AFTER totp_enabled",
+		// Accounts that existed before email verification count as verified
+		"ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMP NULL DEFAULT CURRENT_TIMESTAMP AFTER totp_last_step",
+		"ALTER TABLE users ALTER COLUMN email_verified_at SET DEFAULT NULL",
+		"ALTER TABLE users ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT FALSE AFTER email_verified_at",
+		"ALTER TABLE users ADD COLUMN disabled_at TIMESTAMP NULL DEFAULT NULL AFTER is_admin",
+		// Every user gets a personal organization with one workspace, which
+		// takes over the URLs they owned
+		"ALTER TABLE urls ADD COLUMN workspace_id INT NULL AFTER user_id",
+		`INSERT INTO organizations (name, personal_user_id)
+			SELECT u.username, u.id FROM users u
+			WHERE NOT EXISTS (SELECT 1 FROM organizations o WHERE o.personal_user_id = u.id)`,
+		`INSERT IGNORE INTO organization_members (organization_id, user_id, role)
+			SELECT id, personal_user_id, 'admin' FROM organizations WHERE personal_user_id IS NOT NULL`,
+		`INSERT INTO workspaces (organization_id, name)
+			SELECT o.id, 'Personal' FROM organizations o
+			WHERE o.personal_user_id IS NOT NULL
+			AND NOT EXISTS (SELECT 1 FROM workspaces w WHERE w.organization_id = o.id)`,
+		`UPDATE urls u
+			JOIN organizations o ON o.personal_user_id = u.user_id
+			JOIN workspaces w ON w.organization_id = o.id
+			SET u.workspace_id = w.id
+			WHERE u.workspace_id IS NULL`,
+		"ALTER TABLE urls MODIFY workspace_id INT NOT NULL",
+		"ALTER TABLE urls ADD CONSTRAINT fk_urls_workspace FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE",
+		"ALTER TABLE urls ADD UNIQUE KEY uniq_workspace_url (workspace_id, url_hash)",
+		"ALTER TABLE urls DROP KEY uniq_user_url",
+		// URLs in shared workspaces stay when the user who added them leaves
+		"ALTER TABLE urls DROP FOREIGN KEY urls_ibfk_1",
+		"ALTER TABLE urls MODIFY user_id INT NULL",
+		"ALTER TABLE urls ADD CONSTRAINT fk_urls_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL",
+		"ALTER TABLE users ADD COLUMN plan VARCHAR(20) NOT NULL DEFAULT 'free' AFTER disabled_at",
+		"ALTER TABLE urls ADD COLUMN started_by INT NULL AFTER status",
+		"ALTER TABLE urls ADD INDEX idx_started_by (started_by, status)",
+		"ALTER TABLE broken_links DROP COLUMN url_hash",
+		"ALTER TABLE users ADD COLUMN token_generation INT NOT NULL DEFAULT 0 AFTER sessions_revoked_at",
+		"ALTER TABLE audit_events ADD COLUMN organization_id INT NULL AFTER workspace_id",
+		"ALTER TABLE audit_events ADD INDEX idx_audit_organization (organization_id, id)",
+	}
+
+	for _, migration := range migrations {
+		if _, err := DB.Exec(migration); err != nil && !isAlreadyExists(err) {
+			return err
+		}
+	}
+
+	return backfillURLHashes()
+}
+
+// migrateRoles turns the owner and member roles of organizations created
+// before roles were added into admin and editor. Tables whose role column no
+// longer allows the old roles are left alone, so the enum is only rebuilt once.
+func migrateRoles() error {
+	for _, table := range []string{"organization_members", "organization_invites"} {
+		var columnType string
+		err := DB.QueryRow(`SELECT COLUMN_TYPE FROM information_schema.COLUMNS
+			WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = 'role'`, table).Scan(&columnType)
+		if err != nil {
+			return err
+		}
+		if !strings.Contains(columnType, "'owner'") {
+			continue
+		}
+
+		for _, migration := range []string{
+			"ALTER TABLE " + table + " MODIFY role ENUM('owner', 'member', 'admin', 'editor', 'viewer') NOT NULL DEFAULT 'editor'",
+			"UPDATE " + table + " SET role = IF(role = 'owner', 'admin', 'editor') WHERE role IN ('owner', 'member')",
+			"ALTER TABLE " + table + " MODIFY role ENUM('admin', 'editor', 'viewer') NOT NULL DEFAULT 'editor'",
+		} {
+			if _, err := DB.Exec(migration); err != nil {
+				return err
+			}
+		}
+		log.Printf("Migrated %s to admin, editor and viewer roles", table)
+	}
 	return nil
 }
 
+// backfillURLHashes hashes URLs added before duplicates were detected. When
+// a workspace already holds several spellings of the same URL, the oldest
+// gets the hash; the others keep their results but stay unhashed, and are
+// logged so they can be cleaned up by hand.
+func backfillURLHashes() error {
+	rows, err := DB.Query("SELECT id, workspace_id, url FROM urls WHERE url_hash IS NULL ORDER BY id")
+	if err != nil {
+		return err
+	}
+
+	type legacyURL struct {
+		id, workspaceID int
+		url             string
+	}
+	var legacy []legacyURL
+	for rows.Next() {
+		var u legacyURL
+		if err := rows.Scan(&u.id, &u.workspaceID, &u.url); err != nil {
+			rows.Close()
+			return err
+		}
+		legacy = append(legacy, u)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	hashed, duplicates := 0, 0
+	for _, u := range legacy {
+		canonical, err := urlnorm.Canonicalize(u.url)
+		if err != nil {
+			continue
+		}
+
+		_, err = DB.Exec("UPDATE urls SET url_hash = ? WHERE id = ?", urlnorm.Hash(canonical), u.id)
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1062 {
+			log.Printf("URL %d duplicates another URL in workspace %d: %s", u.id, u.workspaceID, u.url)
+			duplicates++
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		hashed++
+	}
+
+	if hashed > 0 || duplicates > 0 {
+		log.Printf("Backfilled hashes of %d URLs, %d duplicates left unhashed", hashed, duplicates)
+	}
+	return nil
+}
+
+func isAlreadyExists(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case 1050, 1060, 1061: // table, column, key already exists
+			return true
+		case 1091, 1826: // key to drop is gone, foreign key already exists
+			return true
+		}
+	}
+	return false
+}
+
 func getEnv(key, fallback string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -0,0 +1,564 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"webcrawler/audit"
+	"webcrawler/crawler"
+	"webcrawler/database"
+	"webcrawler/models"
+	"webcrawler/passwords"
+	"webcrawler/quota"
+	"webcrawler/tokens"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// UnlockUser lifts a login delay or lockout on an account.
+func UnlockUser(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid user ID",
+		})
+		return
+	}
+
+	var username string
+	err = database.DB.QueryRow("SELECT username FROM users WHERE id = ?", userID).Scan(&username)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "User not found",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to fetch user",
+		})
+		return
+	}
+
+	if err := clearFailedLogins(username); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to unlock user",
+		})
+		return
+	}
+
+	auditUser(c, audit.UserUnlock, userID)
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Message: "User unlocked",
+	})
+}
+
+// GetLoginAttempts lists login attempts, newest first. Only failures are
+// listed unless all=true; username and ip narrow the list down.
+func GetLoginAttempts(c *gin.Context) {
+	page, pageSize := pagination(c)
+
+	where := "WHERE 1 = 1"
+	args := []interface{}{}
+	if c.Query("all") != "true" {
+		where += " AND success = FALSE"
+	}
+	if username := c.Query("username"); username != "" {
+		where += " AND username = ?"
+		args = append(args, username)
+	}
+	if ip := c.Query("ip"); ip != "" {
+		where += " AND ip = ?"
+		args = append(args, ip)
+	}
+
+	var total int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM login_attempts "+where, args...).Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to count login attempts",
+		})
+		return
+	}
+
+	query := `
+		SELECT id, username, user_id, ip, user_agent, success, reason, cleared, created_at
+		FROM login_attempts ` + where + `
+		ORDER BY id DESC
+		LIMIT ? OFFSET ?
+	`
+	rows, err := database.DB.Query(query, append(args, pageSize, (page-1)*pageSize)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to fetch login attempts",
+		})
+		return
+	}
+	defer rows.Close()
+
+	attempts := []models.LoginAttempt{}
+	for rows.Next() {
+		var attempt models.LoginAttempt
+		var userID sql.NullInt64
+		err := rows.Scan(
+			&attempt.ID, &attempt.Username, &userID, &attempt.IP, &attempt.UserAgent,
+			&attempt.Success, &attempt.Reason, &attempt.Cleared, &attempt.CreatedAt,
+		)
+		if err != nil {
+			continue
+		}
+		if userID.Valid {
+			id := int(userID.Int64)
+			attempt.UserID = &id
+		}
+		attempts = append(attempts, attempt)
+	}
+
+	c.JSON(http.StatusOK, paginated(attempts, total, page, pageSize))
+}
+
+// pagination reads the page and page_size query parameters of a listing.
+func pagination(c *gin.Context) (page, pageSize int) {
+	page, _ = strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ = strconv.Atoi(c.DefaultQuery("page_size", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 200 {
+		pageSize = 50
+	}
+	return page, pageSize
+}
+
+func paginated(data interface{}, total, page, pageSize int) models.PaginatedResponse {
+	return models.PaginatedResponse{
+		Data:       data,
+		Total:      total,
+		Page:       page,
+		PageSize:   pageSize,
+		TotalPages: (total + pageSize - 1) / pageSize,
+	}
+}
+
+// GetUsers lists all users, newest first. q searches usernames and email
+// addresses.
+func GetUsers(c *gin.Context) {
+	page, pageSize := pagination(c)
+
+	where := "WHERE 1 = 1"
+	args := []interface{}{}
+	if q := c.Query("q"); q != "" {
+		where += " AND (u.username LIKE ? OR u.email LIKE ?)"
+		searchParam := "%" + q + "%"
+		args = append(args, searchParam, searchParam)
+	}
+
+	var total int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM users u "+where, args...).Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to count users",
+		})
+		return
+	}
+
+	query := `
+		SELECT u.id, u.username, u.email, u.email_verified_at IS NOT NULL, u.is_admin,
+			u.totp_enabled, u.plan, u.disabled_at, u.created_at,
+			(SELECT MAX(a.created_at) FROM login_attempts a WHERE a.user_id = u.id AND a.success = TRUE)
+		FROM users u ` + where + `
+		ORDER BY u.id DESC
+		LIMIT ? OFFSET ?
+	`
+	rows, err := database.DB.Query(query, append(args, pageSize, (page-1)*pageSize)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to fetch users",
+		})
+		return
+	}
+	defer rows.Close()
+
+	users := []models.AdminUser{}
+	for rows.Next() {
+		var user models.AdminUser
+		var disabledAt, lastLoginAt sql.NullTime
+		err := rows.Scan(
+			&user.ID, &user.Username, &user.Email, &user.EmailVerified, &user.IsAdmin,
+			&user.TOTPEnabled, &user.Plan, &disabledAt, &user.CreatedAt, &lastLoginAt,
+		)
+		if err != nil {
+			continue
+		}
+		if disabledAt.Valid {
+			user.DisabledAt = &disabledAt.Time
+		}
+		if lastLoginAt.Valid {
+			user.LastLoginAt = &lastLoginAt.Time
+		}
+		users = append(users, user)
+	}
+
+	c.JSON(http.StatusOK, paginated(users, total, page, pageSize))
+}
+
+// DisableUser blocks an account from logging in and ends its sessions. Its
+// API keys stop working until the account is enabled again.
+func DisableUser(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid user ID",
+		})
+		return
+	}
+	if userID == c.GetInt("user_id") {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "You cannot disable your own account",
+		})
+		return
+	}
+
+	if !setUserDisabled(c, userID, true) {
+		return
+	}
+	if err := tokens.RevokeAllSessions(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to end sessions",
+		})
+		return
+	}
+
+	auditUser(c, audit.UserDisable, userID)
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Message: "User disabled",
+	})
+}
+
+// EnableUser lets a disabled account log in again.
+func EnableUser(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid user ID",
+		})
+		return
+	}
+
+	if !setUserDisabled(c, userID, false) {
+		return
+	}
+
+	auditUser(c, audit.UserEnable, userID)
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Message: "User enabled",
+	})
+}
+
+// UpdateUserPlan moves a user to another plan. Crawls already running are
+// not stopped when the new plan allows fewer.
+func UpdateUserPlan(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid user ID",
+		})
+		return
+	}
+
+	var req models.UpdatePlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+	if _, ok := quota.Plans[req.Plan]; !ok {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Unknown plan",
+		})
+		return
+	}
+
+	var previous string
+	err = database.DB.QueryRow("SELECT plan FROM users WHERE id = ?", userID).Scan(&previous)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "User not found",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to fetch user",
+		})
+		return
+	}
+
+	if _, err := database.DB.Exec("UPDATE users SET plan = ? WHERE id = ?", req.Plan, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to update user",
+		})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.UserPlan,
+		TargetType: audit.TargetUser,
+		TargetIDs:  []int{userID},
+		Details:    map[string]interface{}{"from": previous, "to": req.Plan},
+	})
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Message: "Plan updated",
+	})
+}
+
+func auditUser(c *gin.Context, action string, userID int) {
+	audit.Record(c, audit.Event{
+		Action:     action,
+		TargetType: audit.TargetUser,
+		TargetIDs:  []int{userID},
+	})
+}
+
+func setUserDisabled(c *gin.Context, userID int, disabled bool) bool {
+	query := "UPDATE users SET disabled_at = NULL WHERE id = ?"
+	if disabled {
+		query = "UPDATE users SET disabled_at = COALESCE(disabled_at, NOW()) WHERE id = ?"
+	}
+	if _, err := database.DB.Exec(query, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to update user",
+		})
+		return false
+	}
+
+	// RowsAffected is zero for unchanged rows, so look the user up instead
+	var exists bool
+	err := database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = ?)", userID).Scan(&exists)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to update user",
+		})
+		return false
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "User not found",
+		})
+		return false
+	}
+	return true
+}
+
+// GetUsage lists per-user usage, heaviest users first.
+func GetUsage(c *gin.Context) {
+	page, pageSize := pagination(c)
+
+	var total int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM users").Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to count users",
+		})
+		return
+	}
+
+	query := `
+		SELECT u.id, u.username,
+			COUNT(l.id),
+			COALESCE(SUM(l.status = 'running'), 0),
+			COALESCE(SUM(l.status = 'completed'), 0),
+			COALESCE(SUM(l.status = 'failed'), 0),
+			(SELECT COUNT(*) FROM api_keys k WHERE k.user_id = u.id AND k.revoked_at IS NULL),
+			(SELECT COUNT(*) FROM organization_members m WHERE m.user_id = u.id)
+		FROM users u
+		LEFT JOIN urls l ON l.user_id = u.id
+		GROUP BY u.id, u.username
+		ORDER BY COUNT(l.id) DESC, u.id
+		LIMIT ? OFFSET ?
+	`
+	rows, err := database.DB.Query(query, pageSize, (page-1)*pageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to fetch usage",
+		})
+		return
+	}
+	defer rows.Close()
+
+	usage := []models.UserUsage{}
+	for rows.Next() {
+		var u models.UserUsage
+		err := rows.Scan(&u.UserID, &u.Username, &u.URLs, &u.Running, &u.Completed, &u.Failed, &u.APIKeys, &u.Organizations)
+		if err != nil {
+			continue
+		}
+		usage = append(usage, u)
+	}
+
+	c.JSON(http.StatusOK, paginated(usage, total, page, pageSize))
+}
+
+// GetCrawlQueue shows the crawls waiting and running on this server and how
+// many URLs are in each status.
+func GetCrawlQueue(c *gin.Context) {
+	rows, err := database.DB.Query("SELECT status, COUNT(*) FROM urls GROUP BY status")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to fetch crawl queue",
+		})
+		return
+	}
+	defer rows.Close()
+
+	queue := crawler.Queue()
+	queue.Statuses = map[string]int{}
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			continue
+		}
+		queue.Statuses[status] = count
+	}
+
+	c.JSON(http.StatusOK, queue)
+}
+
+// CancelCrawl stops any user's crawl of a URL, like StopCrawling.
+func CancelCrawl(c *gin.Context) {
+	urlID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid URL ID",
+		})
+		return
+	}
+
+	cancelled := crawler.Cancel(urlID)
+	result, err := database.DB.Exec("UPDATE urls SET status = 'queued' WHERE id = ? AND status = 'running'", urlID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to update URL status",
+		})
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 && !cancelled {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "No running crawl for this URL",
+		})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.CrawlCancel,
+		TargetType: audit.TargetURL,
+		TargetIDs:  []int{urlID},
+	})
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Message: "Crawl cancelled",
+	})
+}
+
+// GetCrawlerLimits returns the crawler limits in effect.
+func GetCrawlerLimits(c *gin.Context) {
+	c.JSON(http.StatusOK, crawler.Limits())
+}
+
+// UpdateCrawlerLimits changes crawler limits until the server restarts.
+func UpdateCrawlerLimits(c *gin.Context) {
+	var req models.UpdateCrawlerLimitsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	limits := crawler.Limits()
+	if req.MaxConcurrentCrawls != nil {
+		limits.MaxConcurrentCrawls = *req.MaxConcurrentCrawls
+	}
+	if req.MaxBodyBytes != nil {
+		limits.MaxBodyBytes = *req.MaxBodyBytes
+	}
+	if req.RetryAttempts != nil {
+		limits.RetryAttempts = *req.RetryAttempts
+	}
+	crawler.SetLimits(limits)
+	audit.Record(c, audit.Event{
+		Action: audit.LimitsUpdate,
+		Details: map[string]interface{}{
+			"max_concurrent_crawls": limits.MaxConcurrentCrawls,
+			"max_body_bytes":        limits.MaxBodyBytes,
+			"retry_attempts":        limits.RetryAttempts,
+		},
+	})
+
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Message: "Crawler limits updated",
+		Data:    limits,
+	})
+}
+
+// BootstrapAdmin makes the account named by ADMIN_USERNAME a system
+// administrator, creating it from ADMIN_EMAIL and ADMIN_PASSWORD when it
+// does not exist yet. The password of an existing account is left alone.
+func BootstrapAdmin() {
+	username := os.Getenv("ADMIN_USERNAME")
+	if username == "" {
+		return
+	}
+
+	result, err := database.DB.Exec("UPDATE users SET is_admin = TRUE WHERE username = ?", username)
+	if err != nil {
+		log.Fatal("Failed to bootstrap administrator:", err)
+	}
+	var exists bool
+	if err := database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE username = ?)", username).Scan(&exists); err != nil {
+		log.Fatal("Failed to bootstrap administrator:", err)
+	}
+	if exists {
+		if rows, _ := result.RowsAffected(); rows > 0 {
+			log.Printf("Made %s a system administrator", username)
+		}
+		return
+	}
+
+	email, password := os.Getenv("ADMIN_EMAIL"), os.Getenv("ADMIN_PASSWORD")
+	if email == "" || password == "" {
+		log.Fatal("ADMIN_EMAIL and ADMIN_PASSWORD are required to create the administrator ", username)
+	}
+	if err := passwords.Validate(password, username, email); err != nil {
+		log.Fatal("Invalid ADMIN_PASSWORD: ", err)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		log.Fatal("Failed to hash ADMIN_PASSWORD:", err)
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		log.Fatal("Failed to create administrator:", err)
+	}
+	defer tx.Rollback()
+
+	// The address comes from the operator, so it counts as verified
+	result, err = tx.Exec(
+		"INSERT INTO users (username, email, password_hash, email_verified_at, is_admin) VALUES (?, ?, ?, NOW(), TRUE)",
+		username, email, string(hash),
+	)
+	if err == nil {
+		userID, _ := result.LastInsertId()
+		err = createPersonalWorkspace(tx, int(userID), username)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Fatal("Failed to create administrator:", err)
+	}
+	log.Printf("Created system administrator %s", username)
+}
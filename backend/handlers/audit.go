@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"webcrawler/authz"
+	"webcrawler/database"
+	"webcrawler/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetAuditEvents lists audit events, newest first. System administrators see
+// every event; everyone else sees their own actions and those in workspaces
+// and organizations where their role may read the audit log. action,
+// actor_id, workspace_id, organization_id, target_type and target_id narrow
+// the list down.
+func GetAuditEvents(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	page, pageSize := pagination(c)
+
+	isAdmin, err := authz.Lookup().IsSystemAdmin(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to check permissions",
+		})
+		return
+	}
+
+	where := "WHERE 1 = 1"
+	args := []interface{}{}
+	if !isAdmin {
+		where += " AND (actor_id = ? OR workspace_id IN (" + authz.WorkspacesWith(authz.ViewAudit) + ")" +
+			" OR organization_id IN (" + authz.OrganizationsWith(authz.ViewAudit) + "))"
+		args = append(args, userID, userID, userID)
+	}
+	if action := c.Query("action"); action != "" {
+		where += " AND action = ?"
+		args = append(args, action)
+	}
+	if targetType := c.Query("target_type"); targetType != "" {
+		where += " AND target_type = ?"
+		args = append(args, targetType)
+	}
+	for _, filter := range []struct{ param, condition string }{
+		{"actor_id", " AND actor_id = ?"},
+		{"workspace_id", " AND workspace_id = ?"},
+		{"organization_id", " AND organization_id = ?"},
+		{"target_id", " AND JSON_CONTAINS(target_ids, CAST(? AS JSON))"},
+	} {
+		value := c.Query(filter.param)
+		if value == "" {
+			continue
+		}
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error: "Invalid " + filter.param,
+			})
+			return
+		}
+		where += filter.condition
+		args = append(args, id)
+	}
+
+	var total int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM audit_events "+where, args...).Scan(&total); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to count audit events",
+		})
+		return
+	}
+
+	query := `
+		SELECT id, actor_id, actor, api_key_id, action, target_type, target_ids,
+			workspace_id, organization_id, details, ip, user_agent, request_id, created_at
+		FROM audit_events ` + where + `
+		ORDER BY id DESC
+		LIMIT ? OFFSET ?
+	`
+	rows, err := database.DB.Query(query, append(args, pageSize, (page-1)*pageSize)...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to fetch audit events",
+		})
+		return
+	}
+	defer rows.Close()
+
+	events := []models.AuditEvent{}
+	for rows.Next() {
+		var event models.AuditEvent
+		var actorID, apiKeyID, workspaceID, organizationID sql.NullInt64
+		var targetIDs, details sql.NullString
+		err := rows.Scan(
+			&event.ID, &actorID, &event.Actor, &apiKeyID, &event.Action, &event.TargetType, &targetIDs,
+			&workspaceID, &organizationID, &details, &event.IP, &event.UserAgent, &event.RequestID, &event.CreatedAt,
+		)
+		if err != nil {
+			continue
+		}
+		event.ActorID = nullInt(actorID)
+		event.APIKeyID = nullInt(apiKeyID)
+		event.WorkspaceID = nullInt(workspaceID)
+		event.OrganizationID = nullInt(organizationID)
+		if targetIDs.Valid {
+			json.Unmarshal([]byte(targetIDs.String), &event.TargetIDs)
+		}
+		if details.Valid {
+			json.Unmarshal([]byte(details.String), &event.Details)
+		}
+		events = append(events, event)
+	}
+
+	c.JSON(http.StatusOK, paginated(events, total, page, pageSize))
+}
+
+func nullInt(n sql.NullInt64) *int {
+	if !n.Valid {
+		return nil
+	}
+	id := int(n.Int64)
+	return &id
+}
@@ -1,17 +1,17 @@
 package handlers
 
 import (
-	"database/sql"
+	"log"
 	"net/http"
-	"os"
 	"strconv"
-	"time"
 
+	"webcrawler/audit"
+	"webcrawler/authz"
 	"webcrawler/database"
 	"webcrawler/models"
+	"webcrawler/passwords"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -24,6 +24,10 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	if throttleLogin(c, req.Username) {
+		return
+	}
+
 	// Find user by username
 	var user models.User
 	query := "SELECT id, username, email, password_hash FROM users WHERE username = ?"
@@ -31,6 +35,10 @@ func Login(c *gin.Context) {
 		&user.ID, &user.Username, &user.Email, &user.PasswordHash,
 	)
 	if err != nil {
+		// Spend as long as a real password check so timing does not reveal
+		// whether the username exists
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(req.Password))
+		recordLoginAttempt(c, req.Username, 0, false, loginReasonUnknownUser)
 		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
 			Error: "Invalid credentials",
 		})
@@ -39,33 +47,19 @@ func Login(c *gin.Context) {
 
 	// Check password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+		recordLoginAttempt(c, req.Username, user.ID, false, loginReasonBadPassword)
 		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
 			Error: "Invalid credentials",
 		})
 		return
 	}
 
-	// Generate JWT token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id":  user.ID,
-		"username": user.Username,
-		"exp":      time.Now().Add(time.Hour * 72).Unix(),
-	})
-
-	tokenString, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "Failed to generate token",
-		})
-		return
-	}
-
-	c.JSON(http.StatusOK, models.AuthResponse{
-		Token: tokenString,
-		User:  user,
-	})
+	completeLogin(c, user, loginReasonPassword, loginReasonPasswordOK)
 }
 
+// dummyPasswordHash is compared against when the username does not exist.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+
 func Register(c *gin.Context) {
 	var req models.RegisterRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -75,6 +69,13 @@ func Register(c *gin.Context) {
 		return
 	}
 
+	if err := passwords.Validate(req.Password, req.Username, req.Email); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
 	// Hash password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -84,9 +85,18 @@ func Register(c *gin.Context) {
 		return
 	}
 
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to create user",
+		})
+		return
+	}
+	defer tx.Rollback()
+
 	// Insert user
 	query := "INSERT INTO users (username, email, password_hash) VALUES (?, ?, ?)"
-	result, err := database.DB.Exec(query, req.Username, req.Email, string(hashedPassword))
+	result, err := tx.Exec(query, req.Username, req.Email, string(hashedPassword))
 	if err != nil {
 		c.JSON(http.StatusConflict, models.ErrorResponse{
 			Error: "Username or email already exists",
@@ -96,6 +106,32 @@ func Register(c *gin.Context) {
 
 	userID, _ := result.LastInsertId()
 
+	if err := createPersonalWorkspace(tx, int(userID), req.Username); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to create user",
+		})
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to create user",
+		})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.Register,
+		ActorID:    int(userID),
+		Actor:      req.Username,
+		TargetType: audit.TargetUser,
+		TargetIDs:  []int{int(userID)},
+	})
+
+	// Crawling stays locked until the address is confirmed
+	if err := sendVerificationEmail(int(userID), req.Username, req.Email); err != nil {
+		log.Printf("Failed to send verification email to user %d: %v", userID, err)
+	}
+
 	// Create user object
 	user := models.User{
 		ID:       int(userID),
@@ -103,25 +139,25 @@ func Register(c *gin.Context) {
 		Email:    req.Email,
 	}
 
-	// Generate JWT token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id":  user.ID,
-		"username": user.Username,
-		"exp":      time.Now().Add(time.Hour * 72).Unix(),
-	})
-
-	tokenString, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "Failed to generate token",
-		})
-		return
-	}
+	startSession(c, http.StatusCreated, user)
+}
 
-	c.JSON(http.StatusCreated, models.AuthResponse{
-		Token: tokenString,
-		User:  user,
-	})
+// urlSortColumns maps sort_by values accepted by GetURLs to columns.
+var urlSortColumns = map[string]string{
+	"url":                 "u.url",
+	"status":              "u.status",
+	"created_at":          "u.created_at",
+	"updated_at":          "u.updated_at",
+	"title":               "r.title",
+	"internal_links":      "r.internal_links",
+	"external_links":      "r.external_links",
+	"ttfb_ms":             "r.ttfb_ms",
+	"download_ms":         "r.download_ms",
+	"html_bytes":          "r.html_bytes",
+	"html_transfer_bytes": "r.html_transfer_bytes",
+	"subresource_count":   "r.subresource_count",
+	"subresource_bytes":   "r.subresource_bytes",
+	"over_budget":         "r.over_budget",
 }
 
 func GetURLs(c *gin.Context) {
@@ -135,18 +171,22 @@ func GetURLs(c *gin.Context) {
 	sortBy := c.DefaultQuery("sort_by", "created_at")
 	sortOrder := c.DefaultQuery("sort_order", "desc")
 
+	// List one workspace when asked, otherwise every workspace of the user
+	scope := inWorkspacesWith(authz.ViewURLs)
+	scopeArgs := []interface{}{userID}
+	if workspaceID, _ := strconv.Atoi(c.Query("workspace_id")); workspaceID > 0 {
+		scope += " AND u.workspace_id = ?"
+		scopeArgs = append(scopeArgs, workspaceID)
+	}
+
 	// Build query
 	query := `
-		SELECT u.id, u.url, u.status, u.created_at, u.updated_at,
-			   r.id, r.title, r.html_version, r.h1_count, r.h2_count, r.h3_count, 
-			   r.h4_count, r.h5_count, r.h6_count, r.internal_links, r.external_links,
-			   r.inaccessible_links, r.has_login_form
+		SELECT ` + urlWithResultColumns + `
 		FROM urls u
 		LEFT JOIN crawl_results r ON u.id = r.url_id
-		WHERE u.user_id = ?
-	`
+		WHERE` + scope
 
-	args := []interface{}{userID}
+	args := append([]interface{}{}, scopeArgs...)
 
 	if search != "" {
 		query += " AND (u.url LIKE ? OR r.title LIKE ?)"
@@ -160,15 +200,11 @@ func GetURLs(c *gin.Context) {
 	}
 
 	// Add sorting
-	if sortBy == "title" {
-		query += " ORDER BY r.title"
-	} else if sortBy == "internal_links" {
-		query += " ORDER BY r.internal_links"
-	} else if sortBy == "external_links" {
-		query += " ORDER BY r.external_links"
-	} else {
-		query += " ORDER BY u." + sortBy
+	sortColumn, ok := urlSortColumns[sortBy]
+	if !ok {
+		sortColumn = "u.created_at"
 	}
+	query += " ORDER BY " + sortColumn
 
 	if sortOrder == "asc" {
 		query += " ASC"
@@ -181,9 +217,8 @@ func GetURLs(c *gin.Context) {
 		SELECT COUNT(*)
 		FROM urls u
 		LEFT JOIN crawl_results r ON u.id = r.url_id
-		WHERE u.user_id = ?
-	`
-	countArgs := []interface{}{userID}
+		WHERE` + scope
+	countArgs := append([]interface{}{}, scopeArgs...)
 
 	if search != "" {
 		countQuery += " AND (u.url LIKE ? OR r.title LIKE ?)"
@@ -223,42 +258,10 @@ func GetURLs(c *gin.Context) {
 	var urls []models.URL
 	for rows.Next() {
 		var url models.URL
-		var result models.CrawlResult
-		var resultID sql.NullInt64
-		var title, htmlVersion sql.NullString
-		var h1, h2, h3, h4, h5, h6, internal, external, inaccessible sql.NullInt64
-		var hasLoginForm sql.NullBool
-
-		err := rows.Scan(
-			&url.ID, &url.URL, &url.Status, &url.CreatedAt, &url.UpdatedAt,
-			&resultID, &title, &htmlVersion, &h1, &h2, &h3, &h4, &h5, &h6,
-			&internal, &external, &inaccessible, &hasLoginForm,
-		)
-		if err != nil {
+		if err := scanURLWithResult(rows, &url); err != nil {
 			continue
 		}
 
-		url.UserID = userID
-
-		// If result exists, populate it
-		if resultID.Valid {
-			result.ID = int(resultID.Int64)
-			result.URLID = url.ID
-			result.Title = title.String
-			result.HTMLVersion = htmlVersion.String
-			result.H1Count = int(h1.Int64)
-			result.H2Count = int(h2.Int64)
-			result.H3Count = int(h3.Int64)
-			result.H4Count = int(h4.Int64)
-			result.H5Count = int(h5.Int64)
-			result.H6Count = int(h6.Int64)
-			result.InternalLinks = int(internal.Int64)
-			result.ExternalLinks = int(external.Int64)
-			result.InaccessibleLinks = int(inaccessible.Int64)
-			result.HasLoginForm = hasLoginForm.Bool
-			url.Result = &result
-		}
-
 		urls = append(urls, url)
 	}
 
@@ -0,0 +1,270 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"webcrawler/audit"
+	"webcrawler/database"
+	"webcrawler/mailer"
+	"webcrawler/models"
+	"webcrawler/passwords"
+	"webcrawler/tokens"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// appURL is the frontend base URL used in email links, APP_URL.
+func appURL() string {
+	if value := os.Getenv("APP_URL"); value != "" {
+		return strings.TrimRight(value, "/")
+	}
+	return "http://localhost:5173"
+}
+
+func emailLink(path, token string) string {
+	return appURL() + path + "?" + url.Values{"token": {token}}.Encode()
+}
+
+// sendVerificationEmail mails a link that confirms the user owns the address.
+func sendVerificationEmail(userID int, username, email string) error {
+	token, err := tokens.IssueEmailToken(userID, email, tokens.PurposeVerifyEmail, tokens.VerifyEmailTTL)
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf(`Hi %s,
+
+Please confirm your email address for Web Crawler by opening this link:
+
+%s
+
+The link expires in 24 hours. If you did not create an account, you can ignore this email.
+`, username, emailLink("/verify-email", token))
+
+	return mailer.Send(email, "Confirm your email address", body)
+}
+
+func sendPasswordResetEmail(userID int, username, email string) error {
+	token, err := tokens.IssueEmailToken(userID, email, tokens.PurposeResetPassword, tokens.ResetPasswordTTL)
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf(`Hi %s,
+
+Someone asked to reset the password for your Web Crawler account. To choose a new password, open this link:
+
+%s
+
+The link expires in 1 hour and can be used once. If you did not ask for a reset, you can ignore this email; your password has not changed.
+`, username, emailLink("/reset-password", token))
+
+	return mailer.Send(email, "Reset your password", body)
+}
+
+// VerifyEmail marks the user's email address as verified. The token must have
+// been sent to the address currently on the account.
+func VerifyEmail(c *gin.Context) {
+	var req models.EmailTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	userID, email, err := tokens.ConsumeEmailToken(req.Token, tokens.PurposeVerifyEmail)
+	if errors.Is(err, tokens.ErrInvalidEmailToken) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid or expired verification link",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to verify email",
+		})
+		return
+	}
+
+	result, err := database.DB.Exec(
+		"UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()) WHERE id = ? AND email = ?",
+		userID, email,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to verify email",
+		})
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		var current string
+		err := database.DB.QueryRow("SELECT email FROM users WHERE id = ?", userID).Scan(&current)
+		if err != nil || current != email {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error: "Invalid or expired verification link",
+			})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Message: "Email address verified",
+	})
+}
+
+// ResendVerification sends a new verification link to the current user.
+func ResendVerification(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	var username, email string
+	var verified bool
+	query := "SELECT username, email, email_verified_at IS NOT NULL FROM users WHERE id = ?"
+	if err := database.DB.QueryRow(query, userID).Scan(&username, &email, &verified); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to send verification email",
+		})
+		return
+	}
+	if verified {
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error: "Email address is already verified",
+		})
+		return
+	}
+
+	if err := sendVerificationEmail(userID, username, email); err != nil {
+		log.Printf("Failed to send verification email to user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to send verification email",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Message: "Verification email sent",
+	})
+}
+
+// ForgotPassword emails a password reset link. The response is the same
+// whether or not the address belongs to an account.
+func ForgotPassword(c *gin.Context) {
+	var req models.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	var userID int
+	var username, email string
+	err := database.DB.QueryRow("SELECT id, username, email FROM users WHERE email = ?", req.Email).Scan(&userID, &username, &email)
+	if err == nil {
+		// Sending in the background keeps the response time from revealing
+		// whether the account exists
+		go func() {
+			if err := sendPasswordResetEmail(userID, username, email); err != nil {
+				log.Printf("Failed to send password reset email to user %d: %v", userID, err)
+			}
+		}()
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Message: "If an account exists for that address, a password reset link has been sent",
+	})
+}
+
+// ResetPassword sets a new password with a token from ForgotPassword and logs
+// out every existing session.
+func ResetPassword(c *gin.Context) {
+	var req models.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	userID, email, err := tokens.PeekEmailToken(req.Token, tokens.PurposeResetPassword)
+	if errors.Is(err, tokens.ErrInvalidEmailToken) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid or expired reset link",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to reset password",
+		})
+		return
+	}
+
+	// Check the new password before spending the link, so a rejected
+	// password can be corrected
+	var username string
+	if err := database.DB.QueryRow("SELECT username FROM users WHERE id = ?", userID).Scan(&username); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid or expired reset link",
+		})
+		return
+	}
+	if err := passwords.Validate(req.Password, username, email); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to hash password",
+		})
+		return
+	}
+
+	if _, _, err := tokens.ConsumeEmailToken(req.Token, tokens.PurposeResetPassword); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid or expired reset link",
+		})
+		return
+	}
+
+	// Following the link also proves the address, as long as it is unchanged
+	_, err = database.DB.Exec(
+		`UPDATE users SET password_hash = ?,
+			email_verified_at = IF(email = ?, COALESCE(email_verified_at, NOW()), email_verified_at)
+		WHERE id = ?`,
+		string(hashedPassword), email, userID,
+	)
+	if err == nil {
+		err = tokens.RevokeAllSessions(userID)
+	}
+	if err == nil {
+		// A reset also lifts a lockout from guessing
+		err = clearFailedLogins(username)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to reset password",
+		})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:  audit.PasswordReset,
+		ActorID: userID,
+		Actor:   username,
+	})
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Message: "Password has been reset. Please log in with your new password",
+	})
+}
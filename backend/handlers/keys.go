@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"webcrawler/audit"
+	"webcrawler/database"
+	"webcrawler/models"
+	"webcrawler/tokens"
+
+	"github.com/gin-gonic/gin"
+)
+
+func CreateAPIKey(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	var req models.APIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Expiry must be in the future",
+		})
+		return
+	}
+
+	key, prefix, hash, err := tokens.NewAPIKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to generate API key",
+		})
+		return
+	}
+
+	scopes := uniqueScopes(req.Scopes)
+	result, err := database.DB.Exec(
+		"INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expires_at) VALUES (?, ?, ?, ?, ?, ?)",
+		userID, req.Name, prefix, hash, strings.Join(scopes, ","), req.ExpiresAt,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to create API key",
+		})
+		return
+	}
+
+	keyID, _ := result.LastInsertId()
+	audit.Record(c, audit.Event{
+		Action:     audit.APIKeyCreate,
+		TargetType: audit.TargetAPIKey,
+		TargetIDs:  []int{int(keyID)},
+		Details:    map[string]interface{}{"name": req.Name, "scopes": scopes},
+	})
+
+	c.JSON(http.StatusCreated, models.CreatedAPIKeyResponse{
+		APIKey: models.APIKey{
+			ID:        int(keyID),
+			Name:      req.Name,
+			Prefix:    prefix,
+			Scopes:    scopes,
+			ExpiresAt: req.ExpiresAt,
+			CreatedAt: time.Now(),
+		},
+		Key: key,
+	})
+}
+
+func GetAPIKeys(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	keys, err := loadAPIKeys(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to get API keys",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// loadAPIKeys returns the user's active API keys, newest first.
+func loadAPIKeys(userID int) ([]models.APIKey, error) {
+	query := `
+		SELECT id, name, prefix, scopes, expires_at, last_used_at, created_at
+		FROM api_keys
+		WHERE user_id = ? AND revoked_at IS NULL
+		ORDER BY created_at DESC
+	`
+	rows, err := database.DB.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		var key models.APIKey
+		var scopes string
+		var expiresAt, lastUsedAt sql.NullTime
+		err := rows.Scan(&key.ID, &key.Name, &key.Prefix, &scopes, &expiresAt, &lastUsedAt, &key.CreatedAt)
+		if err != nil {
+			continue
+		}
+		key.Scopes = tokens.SplitScopes(scopes)
+		if expiresAt.Valid {
+			key.ExpiresAt = &expiresAt.Time
+		}
+		if lastUsedAt.Valid {
+			key.LastUsedAt = &lastUsedAt.Time
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func RevokeAPIKey(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	keyID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid API key ID",
+		})
+		return
+	}
+
+	result, err := database.DB.Exec(
+		"UPDATE api_keys SET revoked_at = NOW() WHERE id = ? AND user_id = ? AND revoked_at IS NULL",
+		keyID, userID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to revoke API key",
+		})
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "API key not found",
+		})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     audit.APIKeyRevoke,
+		TargetType: audit.TargetAPIKey,
+		TargetIDs:  []int{keyID},
+	})
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Message: "API key revoked",
+	})
+}
+
+func uniqueScopes(scopes []string) []string {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, scope := range scopes {
+		if !seen[scope] {
+			seen[scope] = true
+			unique = append(unique, scope)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"webcrawler/audit"
+	"webcrawler/database"
+	"webcrawler/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Failed logins are counted over a sliding window, per username and per
+// client IP. After a few failures each further attempt must wait twice as
+// long as the last; after many the account or IP is locked out for a while.
+const (
+	attemptWindow   = 15 * time.Minute
+	lockoutDuration = 15 * time.Minute
+	maxLoginDelay   = 30 * time.Second
+
+	accountDelayAfter = 3
+	accountLockAfter  = 10
+	ipDelayAfter      = 10
+	ipLockAfter       = 50
+)
+
+// Reasons recorded on login_attempts.
+const (
+	loginReasonPassword  = "password"
+	loginReasonSSO       = "sso"
+	loginReasonTwoFactor = "two_factor"
+	// The first step succeeded and a second factor was asked for
+	loginReasonPasswordOK = "password_ok"
+	loginReasonSSOOK      = "sso_ok"
+
+	loginReasonUnknownUser = "unknown_user"
+	loginReasonBadPassword = "bad_password"
+	loginReasonBadCode     = "bad_code"
+)
+
+// throttleLogin responds with 429 and returns true when the username or the
+// client IP has failed too often recently.
+func throttleLogin(c *gin.Context, username string) bool {
+	wait, err := loginBlockedFor(username, c.ClientIP())
+	if err != nil {
+		// Do not lock everyone out when the attempts table is unavailable
+		log.Printf("Failed to check login attempts: %v", err)
+		return false
+	}
+	if wait <= 0 {
+		return false
+	}
+
+	seconds := int((wait + time.Second - 1) / time.Second)
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, models.ErrorResponse{
+		Error: fmt.Sprintf("Too many failed login attempts. Try again in %d seconds", seconds),
+	})
+	return true
+}
+
+// loginBlockedFor returns how much longer logins for the username from the
+// IP have to wait. Unknown usernames are throttled like real ones so the
+// response does not reveal which accounts exist.
+func loginBlockedFor(username, ip string) (time.Duration, error) {
+	failures, since, err := recentFailures("username = ? AND cleared = FALSE", username)
+	if err != nil {
+		return 0, err
+	}
+	wait := blockedFor(failures, since, accountDelayAfter, accountLockAfter)
+
+	// Successful logins do not clear IP failures, otherwise one valid
+	// account would let an attacker keep guessing at others
+	failures, since, err = recentFailures("ip = ?", ip)
+	if err != nil {
+		return 0, err
+	}
+	if ipWait := blockedFor(failures, since, ipDelayAfter, ipLockAfter); ipWait > wait {
+		wait = ipWait
+	}
+	return wait, nil
+}
+
+// recentFailures counts failed attempts in the window and how long ago the
+// last one was.
+func recentFailures(condition string, value string) (int, time.Duration, error) {
+	var count, seconds int
+	query := `
+		SELECT COUNT(*), COALESCE(TIMESTAMPDIFF(SECOND, MAX(created_at), NOW()), 0)
+		FROM login_attempts
+		WHERE ` + condition + ` AND success = FALSE AND created_at > NOW() - INTERVAL ? SECOND
+	`
+	err := database.DB.QueryRow(query, value, int(attemptWindow.Seconds())).Scan(&count, &seconds)
+	return count, time.Duration(seconds) * time.Second, err
+}
+
+func blockedFor(failures int, since time.Duration, delayAfter, lockAfter int) time.Duration {
+	var block time.Duration
+	switch {
+	case failures >= lockAfter:
+		block = lockoutDuration
+	case failures >= delayAfter:
+		shift := min(failures-delayAfter, 5)
+		block = min(time.Second<<shift, maxLoginDelay)
+	default:
+		return 0
+	}
+	return block - since
+}
+
+// recordLoginAttempt adds an attempt to login_attempts, for throttling, and
+// to the audit log.
+func recordLoginAttempt(c *gin.Context, username string, userID int, success bool, reason string) {
+	var user interface{}
+	if userID != 0 {
+		user = userID
+	}
+
+	userAgent := c.Request.UserAgent()
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+
+	_, err := database.DB.Exec(
+		"INSERT INTO login_attempts (username, user_id, ip, user_agent, success, reason) VALUES (?, ?, ?, ?, ?, ?)",
+		username, user, c.ClientIP(), userAgent, success, reason,
+	)
+	if err != nil {
+		log.Printf("Failed to record login attempt: %v", err)
+	}
+	if !success {
+		log.Printf("Failed login for %q from %s: %s", username, c.ClientIP(), reason)
+	}
+
+	action := audit.Login
+	switch {
+	case !success:
+		action = audit.LoginFailed
+	case reason == loginReasonPasswordOK || reason == loginReasonSSOOK:
+		action = audit.LoginChallenge
+	}
+	audit.Record(c, audit.Event{
+		Action:  action,
+		ActorID: userID,
+		Actor:   username,
+		Details: map[string]interface{}{"reason": reason},
+	})
+}
+
+// clearFailedLogins lifts any delay or lockout on a username, after a
+// successful login or an admin unlock. The attempts stay in the audit trail.
+func clearFailedLogins(username string) error {
+	_, err := database.DB.Exec(
+		"UPDATE login_attempts SET cleared = TRUE WHERE username = ? AND success = FALSE AND cleared = FALSE",
+		username,
+	)
+	return err
+}
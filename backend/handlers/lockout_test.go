@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBlockedFor(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		since    time.Duration
+		blocked  time.Duration
+	}{
+		{"no failures", 0, 0, 0},
+		{"below delay threshold", 2, 0, 0},
+		{"first delay", 3, 0, time.Second},
+		{"delay doubles", 4, 0, 2 * time.Second},
+		{"delay doubles again", 6, 0, 8 * time.Second},
+		{"delay is capped", 8, 0, maxLoginDelay},
+		{"delay stays capped", 9, 0, maxLoginDelay},
+		{"lockout", 10, 0, lockoutDuration},
+		{"many failures", 40, 0, lockoutDuration},
+		{"delay partly served", 4, time.Second, time.Second},
+		{"delay served", 4, 5 * time.Second, -3 * time.Second},
+		{"lockout partly served", 10, 10 * time.Minute, 5 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := blockedFor(tt.failures, tt.since, accountDelayAfter, accountLockAfter)
+			if got != tt.blocked {
+				t.Errorf("blockedFor(%d, %v) = %v, want %v", tt.failures, tt.since, got, tt.blocked)
+			}
+		})
+	}
+}
+
+func TestIPThresholds(t *testing.T) {
+	if blockedFor(accountLockAfter, 0, ipDelayAfter, ipLockAfter) != time.Second {
+		t.Error("an IP is locked out as soon as one account is")
+	}
+	if blockedFor(ipLockAfter, 0, ipDelayAfter, ipLockAfter) != lockoutDuration {
+		t.Error("an IP is not locked out at its own threshold")
+	}
+}
@@ -0,0 +1,512 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"webcrawler/audit"
+	"webcrawler/authz"
+	"webcrawler/database"
+	"webcrawler/models"
+	"webcrawler/passwords"
+	"webcrawler/tokens"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// account is the part of a user row that the /api/me handlers work with.
+type account struct {
+	profile      models.Profile
+	passwordHash string
+}
+
+func loadAccount(userID int) (account, error) {
+	var a account
+	var verifiedAt sql.NullTime
+	var subject sql.NullString
+	query := `
+		SELECT id, username, email, password_hash, email_verified_at, totp_enabled,
+			   oidc_subject, created_at, updated_at
+		FROM users
+		WHERE id = ?
+	`
+	err := database.DB.QueryRow(query, userID).Scan(
+		&a.profile.ID, &a.profile.Username, &a.profile.Email, &a.passwordHash, &verifiedAt,
+		&a.profile.TwoFactorEnabled, &subject, &a.profile.CreatedAt, &a.profile.UpdatedAt,
+	)
+	if err != nil {
+		return a, err
+	}
+
+	a.profile.EmailVerified = verifiedAt.Valid
+	a.profile.HasPassword = a.passwordHash != ""
+	a.profile.SSOLinked = subject.Valid
+	return a, nil
+}
+
+// checkPassword reports whether password matches the account. Accounts
+// created through SSO have no password and never match.
+func (a account) checkPassword(password string) bool {
+	if a.passwordHash == "" {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(a.passwordHash), []byte(password)) == nil
+}
+
+// GetMe returns the current user's account.
+func GetMe(c *gin.Context) {
+	a, err := loadAccount(c.GetInt("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to get account",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, a.profile)
+}
+
+// UpdateMe changes the username or email address. A new email address has
+// to be verified again before crawling is allowed.
+func UpdateMe(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	var req models.UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	a, err := loadAccount(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to update account",
+		})
+		return
+	}
+
+	username, email := a.profile.Username, a.profile.Email
+	if req.Username != nil {
+		username = *req.Username
+	}
+	if req.Email != nil {
+		email = *req.Email
+	}
+	emailChanged := email != a.profile.Email
+
+	if username == a.profile.Username && !emailChanged {
+		c.JSON(http.StatusOK, a.profile)
+		return
+	}
+
+	// Moving the account to another address is as sensitive as a password
+	// change, so it needs the password when there is one
+	if emailChanged && a.profile.HasPassword && !a.checkPassword(req.CurrentPassword) {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error: "Current password is incorrect",
+		})
+		return
+	}
+
+	_, err = database.DB.Exec(
+		"UPDATE users SET username = ?, email = ?, email_verified_at = IF(email = ?, email_verified_at, NULL) WHERE id = ?",
+		username, email, a.profile.Email, userID,
+	)
+	if err != nil {
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error: "Username or email already exists",
+		})
+		return
+	}
+
+	if emailChanged {
+		if err := sendVerificationEmail(userID, username, email); err != nil {
+			log.Printf("Failed to send verification email to user %d: %v", userID, err)
+		}
+	}
+
+	a, err = loadAccount(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to get account",
+		})
+		return
+	}
+
+	message := "Account updated"
+	if emailChanged {
+		message = "Account updated. Please confirm your new email address"
+	}
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Message: message,
+		Data:    a.profile,
+	})
+}
+
+// ChangePassword replaces the password after checking the current one. Every
+// other session is logged out; the caller gets tokens for a new session.
+func ChangePassword(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	var req models.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	a, err := loadAccount(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to change password",
+		})
+		return
+	}
+	if !a.profile.HasPassword {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "This account signs in with single sign-on. Use password reset to set a password",
+		})
+		return
+	}
+	if !a.checkPassword(req.CurrentPassword) {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error: "Current password is incorrect",
+		})
+		return
+	}
+
+	if err := passwords.Validate(req.NewPassword, a.profile.Username, a.profile.Email); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to hash password",
+		})
+		return
+	}
+
+	_, err = database.DB.Exec("UPDATE users SET password_hash = ? WHERE id = ?", string(hashedPassword), userID)
+	if err == nil {
+		err = tokens.RevokeAllSessions(userID)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to change password",
+		})
+		return
+	}
+
+	audit.Record(c, audit.Event{Action: audit.PasswordChange})
+	startSession(c, http.StatusOK, models.User{
+		ID:        a.profile.ID,
+		Username:  a.profile.Username,
+		Email:     a.profile.Email,
+		CreatedAt: a.profile.CreatedAt,
+		UpdatedAt: a.profile.UpdatedAt,
+	})
+}
+
+// DeleteMe deletes the account. The personal workspace with its URLs and
+// crawl results, API keys and sessions go with it through the foreign keys;
+// URLs the user added to shared workspaces stay there. Organizations the user
+// is the only member of are deleted too, while organizations with other
+// members need another admin first.
+func DeleteMe(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	var req models.DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	a, err := loadAccount(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to delete account",
+		})
+		return
+	}
+
+	// SSO accounts have no password to confirm with, so they type their
+	// username instead
+	confirmed := a.checkPassword(req.Password)
+	if !a.profile.HasPassword {
+		confirmed = req.Username == a.profile.Username
+	}
+	if !confirmed {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error: "Confirmation does not match",
+		})
+		return
+	}
+	if a.profile.TwoFactorEnabled && !requireSecondFactor(c, userID, req.Code) {
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to delete account",
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	handOff, solo, err := adminOrganizations(tx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to delete account",
+		})
+		return
+	}
+	if len(handOff) > 0 {
+		c.JSON(http.StatusConflict, models.LastAdminResponse{
+			Error:         "You are the last admin of these organizations. Make another member an admin or delete the organization first",
+			Organizations: handOff,
+		})
+		return
+	}
+
+	// The personal workspace's URLs go through the foreign keys, but their
+	// crawls still need to be stopped
+	personalURLs, err := lockURLs(tx, "w.organization_id IN (SELECT id FROM organizations WHERE personal_user_id = ?)", userID)
+	urls := map[int][]models.URL{}
+	for _, org := range solo {
+		if err != nil {
+			break
+		}
+		urls[org.ID], err = lockURLs(tx, "w.organization_id = ?", org.ID)
+		if err == nil {
+			_, err = tx.Exec("DELETE FROM organizations WHERE id = ?", org.ID)
+		}
+	}
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM users WHERE id = ?", userID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to delete account",
+		})
+		return
+	}
+
+	log.Printf("Deleted user %d", userID)
+	cancelCrawls(personalURLs)
+	for _, org := range solo {
+		cancelCrawls(urls[org.ID])
+		audit.Record(c, audit.Event{
+			Action:         audit.OrgDelete,
+			TargetType:     audit.TargetOrg,
+			TargetIDs:      []int{org.ID},
+			OrganizationID: org.ID,
+			Details:        map[string]interface{}{"name": org.Name},
+		})
+		auditURLs(c, audit.URLDelete, urls[org.ID])
+	}
+	audit.Record(c, audit.Event{
+		Action:     audit.AccountDelete,
+		TargetType: audit.TargetUser,
+		TargetIDs:  []int{userID},
+	})
+
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Message: "Account deleted",
+	})
+}
+
+// adminOrganizations returns the shared organizations in which the user is
+// an admin and no other member is: those with other members, which would be
+// left without an admin, and those with no other members at all. The
+// memberships stay locked like in changeMember.
+func adminOrganizations(tx *sql.Tx, userID int) (handOff, solo []models.Organization, err error) {
+	query := `
+		SELECT o.id, o.name
+		FROM organization_members m
+		JOIN organizations o ON o.id = m.organization_id
+		WHERE m.user_id = ? AND m.role = ? AND o.personal_user_id IS NULL
+		ORDER BY o.name
+		FOR UPDATE
+	`
+	rows, err := tx.Query(query, userID, authz.RoleAdmin)
+	if err != nil {
+		return nil, nil, err
+	}
+	var orgs []models.Organization
+	for rows.Next() {
+		org := models.Organization{Role: string(authz.RoleAdmin)}
+		if err := rows.Scan(&org.ID, &org.Name); err != nil {
+			rows.Close()
+			return nil, nil, err
+		}
+		orgs = append(orgs, org)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	for _, org := range orgs {
+		var others, admins int
+		err := tx.QueryRow(
+			"SELECT COUNT(*), COALESCE(SUM(role = ?), 0) FROM organization_members WHERE organization_id = ? AND user_id <> ? FOR UPDATE",
+			authz.RoleAdmin, org.ID, userID,
+		).Scan(&others, &admins)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch {
+		case others == 0:
+			solo = append(solo, org)
+		case admins == 0:
+			handOff = append(handOff, org)
+		}
+	}
+	return handOff, solo, nil
+}
+
+// ExportMe downloads everything stored about the current user as JSON.
+func ExportMe(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	export, err := buildExport(userID)
+	if err != nil {
+		log.Printf("Failed to export user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to export account",
+		})
+		return
+	}
+
+	filename := fmt.Sprintf("webcrawler-export-%s.json", export.ExportedAt.Format("2006-01-02"))
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.JSON(http.StatusOK, export)
+}
+
+func buildExport(userID int) (*models.AccountExport, error) {
+	a, err := loadAccount(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	export := &models.AccountExport{
+		ExportedAt: time.Now().UTC(),
+		Profile:    a.profile,
+	}
+
+	var raw sql.NullString
+	if err := database.DB.QueryRow("SELECT crawl_profile FROM users WHERE id = ?", userID).Scan(&raw); err != nil {
+		return nil, err
+	}
+	export.CrawlProfile = redactProfile(decodeProfile(raw))
+
+	if export.URLs, err = loadExportURLs(userID); err != nil {
+		return nil, err
+	}
+	if export.APIKeys, err = loadAPIKeys(userID); err != nil {
+		return nil, err
+	}
+	if export.LoginAttempts, err = loadUserLoginAttempts(userID); err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+// loadExportURLs returns every URL the user added, in any workspace, with
+// the full crawl result.
+func loadExportURLs(userID int) ([]models.URL, error) {
+	query := `
+		SELECT ` + urlWithResultColumns + `
+		FROM urls u
+		LEFT JOIN crawl_results r ON u.id = r.url_id
+		WHERE u.user_id = ?
+		ORDER BY u.created_at
+	`
+	rows, err := database.DB.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	urls := []models.URL{}
+	for rows.Next() {
+		var url models.URL
+		if err := scanURLWithResult(rows, &url); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		urls = append(urls, url)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Details are loaded after the rows are closed so each query gets a
+	// connection of its own
+	for i := range urls {
+		result := urls[i].Result
+		if result == nil {
+			continue
+		}
+		if result.BrokenLinks, err = loadBrokenLinks(result.ID); err != nil {
+			return nil, err
+		}
+		if result.Forms, err = loadForms(result.ID); err != nil {
+			return nil, err
+		}
+		if result.Timings, err = loadTimings(result.ID); err != nil {
+			return nil, err
+		}
+	}
+	return urls, nil
+}
+
+func loadUserLoginAttempts(userID int) ([]models.LoginAttempt, error) {
+	query := `
+		SELECT id, username, user_id, ip, user_agent, success, reason, cleared, created_at
+		FROM login_attempts
+		WHERE user_id = ?
+		ORDER BY created_at DESC
+	`
+	rows, err := database.DB.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attempts := []models.LoginAttempt{}
+	for rows.Next() {
+		var attempt models.LoginAttempt
+		var user sql.NullInt64
+		err := rows.Scan(
+			&attempt.ID, &attempt.Username, &user, &attempt.IP, &attempt.UserAgent,
+			&attempt.Success, &attempt.Reason, &attempt.Cleared, &attempt.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if user.Valid {
+			id := int(user.Int64)
+			attempt.UserID = &id
+		}
+		attempts = append(attempts, attempt)
+	}
+	return attempts, rows.Err()
+}
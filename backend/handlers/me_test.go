@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"webcrawler/audit"
+	"webcrawler/database"
+	"webcrawler/models"
+	"webcrawler/tokens"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// adminOrg is a shared organization in which user 1 is an admin.
+type adminOrg struct {
+	id, others, otherAdmins int
+	name                    string
+	urls                    []int
+}
+
+// accountStore stands in for the rows of user 1 that the /api/me handlers
+// and the session tokens read and update. Transactions are applied
+// immediately.
+type accountStore struct {
+	mu           sync.Mutex
+	passwordHash string
+	generation   int
+	// sessions maps session IDs to whether they have a live refresh token
+	sessions map[string]bool
+	orgs     []adminOrg
+	deleted  []string
+	actions  []string
+}
+
+func (s *accountStore) Connect(context.Context) (driver.Conn, error) { return s, nil }
+func (s *accountStore) Driver() driver.Driver                        { return nil }
+
+func (s *accountStore) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements not supported")
+}
+func (s *accountStore) Close() error              { return nil }
+func (s *accountStore) Begin() (driver.Tx, error) { return s, nil }
+func (s *accountStore) Commit() error             { return nil }
+func (s *accountStore) Rollback() error           { return nil }
+
+func (s *accountStore) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	query = strings.Join(strings.Fields(query), " ")
+
+	switch {
+	case strings.HasPrefix(query, "SELECT id, username, email, password_hash, email_verified_at"):
+		now := time.Now()
+		return &fakeRows{
+			columns: []string{"id", "username", "email", "password_hash", "email_verified_at", "totp_enabled", "oidc_subject", "created_at", "updated_at"},
+			values:  [][]driver.Value{{int64(1), "alice", "alice@example.com", s.passwordHash, now, false, nil, now, now}},
+		}, nil
+
+	case strings.HasPrefix(query, "SELECT u.token_generation, EXISTS(SELECT 1 FROM refresh_tokens"):
+		return &fakeRows{
+			columns: []string{"token_generation", "live"},
+			values:  [][]driver.Value{{int64(s.generation), s.sessions[args[0].Value.(string)]}},
+		}, nil
+
+	case strings.HasPrefix(query, "SELECT u.sessions_revoked_at, u.token_generation"):
+		return &fakeRows{
+			columns: []string{"sessions_revoked_at", "token_generation", "listed"},
+			values:  [][]driver.Value{{nil, int64(s.generation), false}},
+		}, nil
+
+	case strings.HasPrefix(query, "SELECT o.id, o.name FROM organization_members m"):
+		rows := &fakeRows{columns: []string{"id", "name"}}
+		for _, org := range s.orgs {
+			rows.values = append(rows.values, []driver.Value{int64(org.id), org.name})
+		}
+		return rows, nil
+
+	case strings.HasPrefix(query, "SELECT COUNT(*), COALESCE(SUM(role = ?), 0) FROM organization_members"):
+		for _, org := range s.orgs {
+			if int64(org.id) == args[1].Value.(int64) {
+				return &fakeRows{
+					columns: []string{"others", "admins"},
+					values:  [][]driver.Value{{int64(org.others), int64(org.otherAdmins)}},
+				}, nil
+			}
+		}
+
+	case strings.HasPrefix(query, "SELECT u.id, u.workspace_id, u.url FROM urls u"):
+		rows := &fakeRows{columns: []string{"id", "workspace_id", "url"}}
+		for _, org := range s.orgs {
+			if int64(org.id) == args[0].Value.(int64) {
+				for _, id := range org.urls {
+					rows.values = append(rows.values, []driver.Value{int64(id), int64(org.id * 10), "https://example.com/"})
+				}
+			}
+		}
+		return rows, nil
+	}
+	return nil, errors.New("unexpected query: " + query)
+}
+
+func (s *accountStore) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	query = strings.Join(strings.Fields(query), " ")
+
+	switch {
+	case strings.HasPrefix(query, "UPDATE users SET password_hash"):
+		s.passwordHash = args[0].Value.(string)
+	case strings.HasPrefix(query, "UPDATE users SET sessions_revoked_at = NOW(), token_generation = token_generation + 1"):
+		s.generation++
+	case strings.HasPrefix(query, "UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = ?"):
+		for sessionID := range s.sessions {
+			s.sessions[sessionID] = false
+		}
+	case strings.HasPrefix(query, "INSERT INTO refresh_tokens"):
+		s.sessions[args[1].Value.(string)] = true
+	case strings.HasPrefix(query, "DELETE FROM organizations"), strings.HasPrefix(query, "DELETE FROM users"):
+		s.deleted = append(s.deleted, query[len("DELETE FROM "):strings.Index(query, " WHERE")]+" "+strconv.FormatInt(args[0].Value.(int64), 10))
+	case strings.HasPrefix(query, "INSERT INTO audit_events"):
+		s.actions = append(s.actions, args[3].Value.(string))
+	default:
+		return nil, errors.New("unexpected statement: " + query)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+// useAccountStore points the database at a store for user 1 with password.
+func useAccountStore(t *testing.T, password string) *accountStore {
+	t.Helper()
+	t.Setenv("JWT_SECRET", "test-secret")
+	t.Setenv("BREACHED_PASSWORDS_PATH", "")
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &accountStore{passwordHash: string(hash), sessions: map[string]bool{}}
+
+	saved := database.DB
+	database.DB = sql.OpenDB(store)
+	t.Cleanup(func() {
+		database.DB.Close()
+		database.DB = saved
+	})
+	return store
+}
+
+// callAsUser runs handler for user 1 with body as the JSON request.
+func callAsUser(handler gin.HandlerFunc, method string, body interface{}) *httptest.ResponseRecorder {
+	encoded, _ := json.Marshal(body)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, "/api/me", bytes.NewReader(encoded))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set("user_id", 1)
+	c.Set("username", "alice")
+	handler(c)
+	return w
+}
+
+func TestChangePasswordKeepsOnlyNewSession(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := useAccountStore(t, "Old-passw0rd")
+
+	// Two sessions from before the change
+	var before []*tokens.Claims
+	for range 2 {
+		sessionID, _, err := tokens.StartSession(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		accessToken, err := tokens.IssueAccessToken(1, "alice", sessionID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		claims, _ := tokens.ParseAccessToken(accessToken)
+		before = append(before, claims)
+	}
+
+	wrong := callAsUser(ChangePassword, http.MethodPut, models.ChangePasswordRequest{
+		CurrentPassword: "Wrong-passw0rd",
+		NewPassword:     "Brand-new-s3cret",
+	})
+	if wrong.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong current password: got %d", wrong.Code)
+	}
+
+	w := callAsUser(ChangePassword, http.MethodPut, models.ChangePasswordRequest{
+		CurrentPassword: "Old-passw0rd",
+		NewPassword:     "Brand-new-s3cret",
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(store.passwordHash), []byte("Brand-new-s3cret")) != nil {
+		t.Error("password hash not updated")
+	}
+
+	for i, claims := range before {
+		if revoked, err := tokens.IsRevoked(claims); err != nil || !revoked {
+			t.Errorf("session %d from before the change: revoked = (%v, %v)", i, revoked, err)
+		}
+	}
+
+	var resp models.AuthResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	claims, err := tokens.ParseAccessToken(resp.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked, err := tokens.IsRevoked(claims); err != nil || revoked {
+		t.Errorf("new session: revoked = (%v, %v)", revoked, err)
+	}
+	if !store.sessions[claims.SessionID] {
+		t.Error("new session has no live refresh token")
+	}
+	if len(store.actions) != 1 || store.actions[0] != audit.PasswordChange {
+		t.Errorf("audit actions: %v", store.actions)
+	}
+}
+
+func TestDeleteMeNeedsAnotherAdmin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := useAccountStore(t, "Passw0rd-alice")
+	store.orgs = []adminOrg{
+		{id: 2, name: "Acme", others: 2, otherAdmins: 0},
+		{id: 3, name: "Shared", others: 3, otherAdmins: 1},
+		{id: 4, name: "Side project", others: 0, urls: []int{40, 41}},
+	}
+
+	w := callAsUser(DeleteMe, http.MethodDelete, models.DeleteAccountRequest{Password: "Passw0rd-alice"})
+	if w.Code != http.StatusConflict {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+	var resp models.LastAdminResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Organizations) != 1 || resp.Organizations[0].ID != 2 || resp.Organizations[0].Name != "Acme" {
+		t.Errorf("organizations to hand off: %+v", resp.Organizations)
+	}
+	if len(store.deleted) != 0 || len(store.actions) != 0 {
+		t.Fatalf("deleted %v, recorded %v", store.deleted, store.actions)
+	}
+
+	// Once Acme has another admin the account goes, along with the
+	// organization no one else belongs to
+	store.orgs[0].otherAdmins = 1
+	w = callAsUser(DeleteMe, http.MethodDelete, models.DeleteAccountRequest{Password: "Passw0rd-alice"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", w.Code, w.Body)
+	}
+	if want := []string{"organizations 4", "users 1"}; !reflect.DeepEqual(store.deleted, want) {
+		t.Errorf("deleted %v, want %v", store.deleted, want)
+	}
+	if want := []string{audit.OrgDelete, audit.URLDelete, audit.AccountDelete}; !reflect.DeepEqual(store.actions, want) {
+		t.Errorf("audit actions %v, want %v", store.actions, want)
+	}
+}
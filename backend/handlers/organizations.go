@@ -0,0 +1,665 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"webcrawler/audit"
+	"webcrawler/authz"
+	"webcrawler/database"
+	"webcrawler/mailer"
+	"webcrawler/models"
+	"webcrawler/tokens"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultWorkspaceName = "Default"
+
+// orgParam returns the organization in the :id parameter, which Authorize
+// has already checked, and whether it is a personal organization.
+func orgParam(c *gin.Context) (orgID int, personal bool, ok bool) {
+	orgID, _ = strconv.Atoi(c.Param("id"))
+	err := database.DB.QueryRow("SELECT personal_user_id IS NOT NULL FROM organizations WHERE id = ?", orgID).Scan(&personal)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to get organization",
+		})
+		return 0, false, false
+	}
+	return orgID, personal, true
+}
+
+// rejectPersonalOrg writes the error response for actions that make no sense
+// on a personal organization.
+func rejectPersonalOrg(c *gin.Context, personal bool) bool {
+	if personal {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Personal organizations cannot be shared. Create an organization to work with others",
+		})
+	}
+	return personal
+}
+
+// GetOrganizations lists the organizations the user belongs to.
+func GetOrganizations(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	query := `
+		SELECT o.id, o.name, o.personal_user_id IS NOT NULL, m.role, o.created_at
+		FROM organizations o
+		JOIN organization_members m ON m.organization_id = o.id
+		WHERE m.user_id = ?
+		ORDER BY o.personal_user_id IS NULL, o.name
+	`
+	rows, err := database.DB.Query(query, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to get organizations",
+		})
+		return
+	}
+	defer rows.Close()
+
+	orgs := []models.Organization{}
+	for rows.Next() {
+		var org models.Organization
+		if err := rows.Scan(&org.ID, &org.Name, &org.Personal, &org.Role, &org.CreatedAt); err != nil {
+			continue
+		}
+		orgs = append(orgs, org)
+	}
+
+	c.JSON(http.StatusOK, orgs)
+}
+
+// CreateOrganization creates an organization with one workspace and makes
+// the user its admin.
+func CreateOrganization(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	var req models.CreateOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to create organization",
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	var orgID int64
+	result, err := tx.Exec("INSERT INTO organizations (name) VALUES (?)", req.Name)
+	if err == nil {
+		orgID, _ = result.LastInsertId()
+		_, err = tx.Exec("INSERT INTO organization_members (organization_id, user_id, role) VALUES (?, ?, ?)", orgID, userID, authz.RoleAdmin)
+	}
+	if err == nil {
+		_, err = tx.Exec("INSERT INTO workspaces (organization_id, name) VALUES (?, ?)", orgID, defaultWorkspaceName)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to create organization",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.SuccessResponse{
+		Message: "Organization created",
+		Data: models.Organization{
+			ID:   int(orgID),
+			Name: req.Name,
+			Role: string(authz.RoleAdmin),
+		},
+	})
+}
+
+// DeleteOrganization deletes an organization with its workspaces and URLs.
+func DeleteOrganization(c *gin.Context) {
+	orgID, personal, ok := orgParam(c)
+	if !ok {
+		return
+	}
+	if personal {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Personal organizations are deleted with the account",
+		})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to delete organization",
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	var name string
+	err = tx.QueryRow("SELECT name FROM organizations WHERE id = ?", orgID).Scan(&name)
+	var urls []models.URL
+	if err == nil {
+		urls, err = lockURLs(tx, "w.organization_id = ?", orgID)
+	}
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM organizations WHERE id = ?", orgID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to delete organization",
+		})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:         audit.OrgDelete,
+		TargetType:     audit.TargetOrg,
+		TargetIDs:      []int{orgID},
+		OrganizationID: orgID,
+		Details:        map[string]interface{}{"name": name},
+	})
+	cancelCrawls(urls)
+	auditURLs(c, audit.URLDelete, urls)
+
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Message: "Organization deleted",
+	})
+}
+
+// lockURLs returns the URLs of the workspaces w matching where, which a
+// cascading delete in tx is about to remove. Locking them keeps the audit
+// log in step with what the delete removes.
+func lockURLs(tx *sql.Tx, where string, args ...interface{}) ([]models.URL, error) {
+	query := `
+		SELECT u.id, u.workspace_id, u.url FROM urls u
+		JOIN workspaces w ON w.id = u.workspace_id
+		WHERE ` + where + `
+		FOR UPDATE
+	`
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var urls []models.URL
+	for rows.Next() {
+		var url models.URL
+		if err := rows.Scan(&url.ID, &url.WorkspaceID, &url.URL); err != nil {
+			return nil, err
+		}
+		urls = append(urls, url)
+	}
+	return urls, rows.Err()
+}
+
+// GetMembers lists the members of an organization.
+func GetMembers(c *gin.Context) {
+	orgID, _ := strconv.Atoi(c.Param("id"))
+
+	query := `
+		SELECT u.id, u.username, u.email, m.role, m.created_at
+		FROM organization_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.organization_id = ?
+		ORDER BY m.created_at
+	`
+	rows, err := database.DB.Query(query, orgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to get members",
+		})
+		return
+	}
+	defer rows.Close()
+
+	members := []models.Member{}
+	for rows.Next() {
+		var member models.Member
+		if err := rows.Scan(&member.UserID, &member.Username, &member.Email, &member.Role, &member.CreatedAt); err != nil {
+			continue
+		}
+		members = append(members, member)
+	}
+
+	c.JSON(http.StatusOK, members)
+}
+
+// UpdateMember changes a member's role.
+func UpdateMember(c *gin.Context) {
+	memberID, ok := memberParam(c)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	changeMember(c, memberID, authz.Role(req.Role), audit.MemberUpdate, "Member updated")
+}
+
+// RemoveMember removes a member from the organization.
+func RemoveMember(c *gin.Context) {
+	memberID, ok := memberParam(c)
+	if !ok {
+		return
+	}
+
+	changeMember(c, memberID, "", audit.MemberRemove, "Member removed")
+}
+
+// LeaveOrganization removes the current user from the organization.
+func LeaveOrganization(c *gin.Context) {
+	changeMember(c, c.GetInt("user_id"), "", audit.MemberLeave, "You have left the organization")
+}
+
+func memberParam(c *gin.Context) (int, bool) {
+	memberID, err := strconv.Atoi(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid user ID",
+		})
+		return 0, false
+	}
+	return memberID, true
+}
+
+// changeMember gives a member a new role, or removes them when role is
+// empty, and records action in the audit log. The last admin can be neither
+// demoted nor removed.
+func changeMember(c *gin.Context, memberID int, role authz.Role, action, message string) {
+	orgID, personal, ok := orgParam(c)
+	if !ok {
+		return
+	}
+	if rejectPersonalOrg(c, personal) {
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to update member",
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	var current authz.Role
+	var admins int
+	err = tx.QueryRow("SELECT role FROM organization_members WHERE organization_id = ? AND user_id = ?", orgID, memberID).Scan(&current)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "Member not found",
+		})
+		return
+	}
+	if err == nil {
+		// Locking the admins keeps two admins from removing each other at once
+		err = tx.QueryRow(
+			"SELECT COUNT(*) FROM organization_members WHERE organization_id = ? AND role = ? FOR UPDATE",
+			orgID, authz.RoleAdmin,
+		).Scan(&admins)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to update member",
+		})
+		return
+	}
+	if current == authz.RoleAdmin && role != authz.RoleAdmin && admins <= 1 {
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error: "An organization needs at least one admin",
+		})
+		return
+	}
+
+	if role == "" {
+		_, err = tx.Exec("DELETE FROM organization_members WHERE organization_id = ? AND user_id = ?", orgID, memberID)
+	} else {
+		_, err = tx.Exec("UPDATE organization_members SET role = ? WHERE organization_id = ? AND user_id = ?", role, orgID, memberID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to update member",
+		})
+		return
+	}
+
+	details := map[string]interface{}{"previous_role": current}
+	if role != "" {
+		details["role"] = role
+	}
+	audit.Record(c, audit.Event{
+		Action:         action,
+		TargetType:     audit.TargetUser,
+		TargetIDs:      []int{memberID},
+		OrganizationID: orgID,
+		Details:        details,
+	})
+
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Message: message,
+	})
+}
+
+// CreateInvite emails an invitation to join the organization. Inviting the
+// same address again replaces the earlier invitation.
+func CreateInvite(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	orgID, personal, ok := orgParam(c)
+	if !ok {
+		return
+	}
+	if rejectPersonalOrg(c, personal) {
+		return
+	}
+
+	var req models.InviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+	if req.Role == "" {
+		req.Role = string(authz.RoleEditor)
+	}
+
+	var isMember bool
+	query := `
+		SELECT EXISTS(
+			SELECT 1 FROM organization_members m
+			JOIN users u ON u.id = m.user_id
+			WHERE m.organization_id = ? AND u.email = ?
+		)
+	`
+	if err := database.DB.QueryRow(query, orgID, req.Email).Scan(&isMember); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to create invitation",
+		})
+		return
+	}
+	if isMember {
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error: "That address already belongs to a member",
+		})
+		return
+	}
+
+	token, hash, err := tokens.NewInviteToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to create invitation",
+		})
+		return
+	}
+
+	_, err = database.DB.Exec("DELETE FROM organization_invites WHERE organization_id = ? AND email = ? AND accepted_at IS NULL", orgID, req.Email)
+	var result sql.Result
+	if err == nil {
+		result, err = database.DB.Exec(
+			"INSERT INTO organization_invites (organization_id, email, role, token_hash, invited_by, expires_at) VALUES (?, ?, ?, ?, ?, NOW() + INTERVAL ? SECOND)",
+			orgID, req.Email, req.Role, hash, userID, int(tokens.InviteTTL.Seconds()),
+		)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to create invitation",
+		})
+		return
+	}
+
+	if err := sendInviteEmail(orgID, c.GetString("username"), req.Email, token); err != nil {
+		log.Printf("Failed to send invitation to %s for organization %d: %v", req.Email, orgID, err)
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to send invitation",
+		})
+		return
+	}
+
+	inviteID, _ := result.LastInsertId()
+	audit.Record(c, audit.Event{
+		Action:         audit.InviteCreate,
+		TargetType:     audit.TargetInvite,
+		TargetIDs:      []int{int(inviteID)},
+		OrganizationID: orgID,
+		Details:        map[string]interface{}{"email": req.Email, "role": req.Role},
+	})
+
+	c.JSON(http.StatusCreated, models.SuccessResponse{
+		Message: "Invitation sent",
+		Data: models.Invite{
+			ID:    int(inviteID),
+			Email: req.Email,
+			Role:  req.Role,
+		},
+	})
+}
+
+func sendInviteEmail(orgID int, inviter, email, token string) error {
+	var orgName string
+	if err := database.DB.QueryRow("SELECT name FROM organizations WHERE id = ?", orgID).Scan(&orgName); err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf(`Hi,
+
+%s invited you to join %s on Web Crawler, to share the sites you monitor.
+
+To accept, sign in or create an account with this email address and open this link:
+
+%s
+
+The invitation expires in 7 days. If you were not expecting it, you can ignore this email.
+`, inviter, orgName, emailLink("/invites/accept", token))
+
+	return mailer.Send(email, "You are invited to join "+orgName, body)
+}
+
+// GetInvites lists the organization's pending invitations.
+func GetInvites(c *gin.Context) {
+	orgID, _ := strconv.Atoi(c.Param("id"))
+
+	query := `
+		SELECT i.id, i.email, i.role, COALESCE(u.username, ''), i.expires_at, i.created_at
+		FROM organization_invites i
+		LEFT JOIN users u ON u.id = i.invited_by
+		WHERE i.organization_id = ? AND i.accepted_at IS NULL AND i.expires_at > NOW()
+		ORDER BY i.created_at DESC
+	`
+	rows, err := database.DB.Query(query, orgID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to get invitations",
+		})
+		return
+	}
+	defer rows.Close()
+
+	invites := []models.Invite{}
+	for rows.Next() {
+		var invite models.Invite
+		err := rows.Scan(&invite.ID, &invite.Email, &invite.Role, &invite.InvitedBy, &invite.ExpiresAt, &invite.CreatedAt)
+		if err != nil {
+			continue
+		}
+		invites = append(invites, invite)
+	}
+
+	c.JSON(http.StatusOK, invites)
+}
+
+// RevokeInvite cancels a pending invitation.
+func RevokeInvite(c *gin.Context) {
+	orgID, _ := strconv.Atoi(c.Param("id"))
+	inviteID, err := strconv.Atoi(c.Param("inviteId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid invitation ID",
+		})
+		return
+	}
+
+	// Look the invitation up first so the audit log can name the invitee
+	var email string
+	err = database.DB.QueryRow(
+		"SELECT email FROM organization_invites WHERE id = ? AND organization_id = ? AND accepted_at IS NULL",
+		inviteID, orgID,
+	).Scan(&email)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "Invitation not found",
+		})
+		return
+	}
+	var result sql.Result
+	if err == nil {
+		result, err = database.DB.Exec(
+			"DELETE FROM organization_invites WHERE id = ? AND organization_id = ? AND accepted_at IS NULL",
+			inviteID, orgID,
+		)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to revoke invitation",
+		})
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "Invitation not found",
+		})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:         audit.InviteRevoke,
+		TargetType:     audit.TargetInvite,
+		TargetIDs:      []int{inviteID},
+		OrganizationID: orgID,
+		Details:        map[string]interface{}{"email": email},
+	})
+
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Message: "Invitation revoked",
+	})
+}
+
+// AcceptInvite adds the current user to the organization of an invitation.
+// The invitation must have been sent to the user's email address.
+func AcceptInvite(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	var req models.AcceptInviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	var inviteID, orgID int
+	var email, role, userEmail string
+	query := `
+		SELECT id, organization_id, email, role
+		FROM organization_invites
+		WHERE token_hash = ? AND accepted_at IS NULL AND expires_at > NOW()
+	`
+	err := database.DB.QueryRow(query, tokens.Hash(req.Token)).Scan(&inviteID, &orgID, &email, &role)
+	if err == nil {
+		err = database.DB.QueryRow("SELECT email FROM users WHERE id = ?", userID).Scan(&userEmail)
+	}
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid or expired invitation",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to accept invitation",
+		})
+		return
+	}
+	if !strings.EqualFold(email, userEmail) {
+		c.JSON(http.StatusForbidden, models.ErrorResponse{
+			Error: "This invitation was sent to a different email address",
+		})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to accept invitation",
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	// Each invitation is accepted once
+	result, err := tx.Exec("UPDATE organization_invites SET accepted_at = NOW() WHERE id = ? AND accepted_at IS NULL", inviteID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to accept invitation",
+		})
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows != 1 {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid or expired invitation",
+		})
+		return
+	}
+
+	_, err = tx.Exec("INSERT IGNORE INTO organization_members (organization_id, user_id, role) VALUES (?, ?, ?)", orgID, userID, role)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to accept invitation",
+		})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:         audit.InviteAccept,
+		TargetType:     audit.TargetInvite,
+		TargetIDs:      []int{inviteID},
+		OrganizationID: orgID,
+		Details:        map[string]interface{}{"email": email, "role": role},
+	})
+
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Message: "Invitation accepted",
+		Data:    map[string]int{"organization_id": orgID},
+	})
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"webcrawler/models"
+	"webcrawler/quota"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetQuota returns the user's plan limits and their usage.
+func GetQuota(c *gin.Context) {
+	usage, err := quota.Usage(c.GetInt("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to get quota",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, usage)
+}
+
+// writeQuotaError answers with 403 and the quota that was exceeded, or with
+// failure for any other error.
+func writeQuotaError(c *gin.Context, err error, failure string) {
+	var exceeded *quota.ExceededError
+	if errors.As(err, &exceeded) {
+		c.JSON(http.StatusForbidden, models.QuotaExceededResponse{
+			Error: exceeded.Error(),
+			Quota: exceeded.Quota,
+			Limit: exceeded.Limit,
+			Used:  exceeded.Used,
+		})
+		return
+	}
+
+	c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+		Error: failure,
+	})
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"webcrawler/audit"
+	"webcrawler/database"
+	"webcrawler/models"
+	"webcrawler/tokens"
+
+	"github.com/gin-gonic/gin"
+)
+
+// startSession opens a login session for the user and responds with its
+// access and refresh tokens. It returns false if no session was issued.
+func startSession(c *gin.Context, status int, user models.User) bool {
+	sessionID, refreshToken, err := tokens.StartSession(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to create session",
+		})
+		return false
+	}
+
+	return respondWithTokens(c, status, user, sessionID, refreshToken)
+}
+
+func respondWithTokens(c *gin.Context, status int, user models.User, sessionID, refreshToken string) bool {
+	accessToken, err := tokens.IssueAccessToken(user.ID, user.Username, sessionID)
+	if errors.Is(err, tokens.ErrSessionRevoked) {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error: "Session has been revoked",
+		})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to generate token",
+		})
+		return false
+	}
+
+	c.JSON(status, models.AuthResponse{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(tokens.AccessTTL().Seconds()),
+		User:         user,
+	})
+	return true
+}
+
+// RefreshToken exchanges a refresh token for a new access token and a new
+// refresh token.
+func RefreshToken(c *gin.Context) {
+	var req models.RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	userID, sessionID, refreshToken, err := tokens.Rotate(req.RefreshToken)
+	if errors.Is(err, tokens.ErrInvalidRefreshToken) || errors.Is(err, tokens.ErrRefreshTokenReused) {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to refresh token",
+		})
+		return
+	}
+
+	var user models.User
+	query := "SELECT id, username, email, created_at, updated_at FROM users WHERE id = ?"
+	err = database.DB.QueryRow(query, userID).Scan(&user.ID, &user.Username, &user.Email, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error: "User not found",
+		})
+		return
+	}
+
+	respondWithTokens(c, http.StatusOK, user, sessionID, refreshToken)
+}
+
+// Logout revokes the current access token and the refresh tokens of its
+// session.
+func Logout(c *gin.Context) {
+	claims := c.MustGet("token_claims").(*tokens.Claims)
+
+	if err := tokens.RevokeAccessToken(claims); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to log out",
+		})
+		return
+	}
+	if claims.SessionID != "" {
+		if err := tokens.RevokeSession(claims.UserID, claims.SessionID); err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error: "Failed to log out",
+			})
+			return
+		}
+	}
+
+	audit.Record(c, audit.Event{Action: audit.Logout})
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Message: "Logged out successfully",
+	})
+}
+
+// LogoutAll revokes every session of the current user, including tokens
+// already handed out to other devices.
+func LogoutAll(c *gin.Context) {
+	claims := c.MustGet("token_claims").(*tokens.Claims)
+
+	// The current token is listed too, as it may share a second with the cutoff
+	err := tokens.RevokeAllSessions(claims.UserID)
+	if err == nil {
+		err = tokens.RevokeAccessToken(claims)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to log out sessions",
+		})
+		return
+	}
+
+	audit.Record(c, audit.Event{Action: audit.LogoutAll})
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Message: "Logged out of all sessions",
+	})
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+
+	"webcrawler/crawler"
+	"webcrawler/database"
+	"webcrawler/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetCrawlProfile returns the user's default crawl profile.
+func GetCrawlProfile(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	var raw sql.NullString
+	err := database.DB.QueryRow("SELECT crawl_profile FROM users WHERE id = ?", userID).Scan(&raw)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to get crawl profile",
+		})
+		return
+	}
+
+	profile := redactProfile(decodeProfile(raw))
+	if profile == nil {
+		profile = &models.CrawlProfile{}
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// UpdateCrawlProfile replaces the user's default crawl profile, which applies
+// to every crawl the user starts where the URL does not override the setting
+// itself.
+func UpdateCrawlProfile(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	var req models.CrawlProfile
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	if err := crawler.ValidateProfile(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid crawl profile: " + err.Error(),
+		})
+		return
+	}
+
+	// Profiles are returned without secrets, so keep the stored ones when
+	// the client sends them back blank
+	var raw sql.NullString
+	if database.DB.QueryRow("SELECT crawl_profile FROM users WHERE id = ?", userID).Scan(&raw) == nil {
+		keepSecrets(&req, decodeProfile(raw))
+	}
+
+	profileJSON, err := encodeProfile(&req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to store crawl profile",
+		})
+		return
+	}
+
+	_, err = database.DB.Exec("UPDATE users SET crawl_profile = ? WHERE id = ?", profileJSON, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to update crawl profile",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Message: "Crawl profile updated successfully",
+		Data:    redactProfile(&req),
+	})
+}
+
+// encodeProfile serializes a crawl profile for storage with its secrets
+// encrypted; nil stays NULL.
+func encodeProfile(profile *models.CrawlProfile) (interface{}, error) {
+	if profile == nil {
+		return nil, nil
+	}
+
+	sealed, err := crawler.SealProfile(*profile)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded, err := json.Marshal(sealed)
+	if err != nil {
+		return nil, err
+	}
+	return string(encoded), nil
+}
+
+func decodeProfile(raw sql.NullString) *models.CrawlProfile {
+	if !raw.Valid {
+		return nil
+	}
+
+	var profile models.CrawlProfile
+	if err := json.Unmarshal([]byte(raw.String), &profile); err != nil {
+		return nil
+	}
+
+	opened, err := crawler.OpenProfile(profile)
+	if err != nil {
+		return nil
+	}
+	return &opened
+}
+
+// keepSecrets fills in secrets omitted from an updated profile from the
+// current one: passwords as long as the username is unchanged, and cookie
+// and header values by name.
+func keepSecrets(updated, current *models.CrawlProfile) {
+	if current == nil {
+		return
+	}
+
+	for name, value := range updated.Headers {
+		if value == "" && current.Headers[name] != "" {
+			updated.Headers[name] = current.Headers[name]
+		}
+	}
+
+	currentCookies := make(map[string]string, len(current.Cookies))
+	for _, cookie := range current.Cookies {
+		currentCookies[cookie.Name] = cookie.Value
+	}
+	for i, cookie := range updated.Cookies {
+		if cookie.Value == "" {
+			updated.Cookies[i].Value = currentCookies[cookie.Name]
+		}
+	}
+
+	if updated.BasicAuth != nil && updated.BasicAuth.Password == "" && current.BasicAuth != nil &&
+		current.BasicAuth.Username == updated.BasicAuth.Username {
+		updated.BasicAuth.Password = current.BasicAuth.Password
+	}
+
+	if updated.Login != nil && updated.Login.Password == "" && current.Login != nil &&
+		current.Login.Username == updated.Login.Username {
+		updated.Login.Password = current.Login.Password
+	}
+
+	if updated.Proxy != nil && updated.Proxy.Password == "" && current.Proxy != nil &&
+		current.Proxy.Username == updated.Proxy.Username {
+		updated.Proxy.Password = current.Proxy.Password
+	}
+}
+
+// redactProfile returns a copy of the profile that is safe to send back to
+// clients, who may be read-only members of a shared workspace: passwords
+// are removed, and cookies and headers keep their names but not their
+// values.
+func redactProfile(profile *models.CrawlProfile) *models.CrawlProfile {
+	if profile == nil {
+		return nil
+	}
+
+	redacted := *profile
+	if profile.Headers != nil {
+		redacted.Headers = make(map[string]string, len(profile.Headers))
+		for name := range profile.Headers {
+			redacted.Headers[name] = ""
+		}
+	}
+	if profile.Cookies != nil {
+		redacted.Cookies = make([]models.Cookie, len(profile.Cookies))
+		for i, cookie := range profile.Cookies {
+			redacted.Cookies[i] = models.Cookie{Name: cookie.Name}
+		}
+	}
+	if profile.BasicAuth != nil {
+		redacted.BasicAuth = &models.BasicAuth{Username: profile.BasicAuth.Username}
+	}
+	if profile.Login != nil {
+		login := *profile.Login
+		login.Password = ""
+		redacted.Login = &login
+	}
+	if profile.Proxy != nil {
+		proxy := *profile.Proxy
+		proxy.Password = ""
+		redacted.Proxy = &proxy
+	}
+	return &redacted
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"webcrawler/models"
+)
+
+func secretProfile() *models.CrawlProfile {
+	return &models.CrawlProfile{
+		Headers:   map[string]string{"Authorization": "Bearer secret-token"},
+		Cookies:   []models.Cookie{{Name: "session", Value: "secret-cookie"}},
+		BasicAuth: &models.BasicAuth{Username: "alice", Password: "secret-basic"},
+		Login:     &models.FormLogin{LoginURL: "https://example.com/login", Username: "alice", Password: "secret-login"},
+		Proxy:     &models.ProxySettings{Username: "alice", Password: "secret-proxy"},
+	}
+}
+
+func TestRedactProfile(t *testing.T) {
+	profile := secretProfile()
+	encoded, _ := json.Marshal(redactProfile(profile))
+
+	if strings.Contains(string(encoded), "secret") {
+		t.Errorf("redacted profile leaks a secret: %s", encoded)
+	}
+	for _, name := range []string{"Authorization", "session", "alice"} {
+		if !strings.Contains(string(encoded), name) {
+			t.Errorf("redacted profile lost %q: %s", name, encoded)
+		}
+	}
+	if profile.Headers["Authorization"] == "" || profile.Cookies[0].Value == "" {
+		t.Error("redactProfile changed the original profile")
+	}
+}
+
+func TestKeepSecrets(t *testing.T) {
+	current := secretProfile()
+	updated := redactProfile(current)
+	updated.Cookies = append(updated.Cookies, models.Cookie{Name: "new", Value: "fresh"})
+	updated.Headers["X-Other"] = "changed"
+
+	keepSecrets(updated, current)
+
+	if updated.Headers["Authorization"] != "Bearer secret-token" || updated.Headers["X-Other"] != "changed" {
+		t.Errorf("headers: %v", updated.Headers)
+	}
+	if updated.Cookies[0].Value != "secret-cookie" || updated.Cookies[1].Value != "fresh" {
+		t.Errorf("cookies: %v", updated.Cookies)
+	}
+	if updated.BasicAuth.Password != "secret-basic" || updated.Login.Password != "secret-login" || updated.Proxy.Password != "secret-proxy" {
+		t.Error("passwords were not kept")
+	}
+
+	// A changed username needs its password again
+	renamed := redactProfile(current)
+	renamed.BasicAuth.Username = "bob"
+	keepSecrets(renamed, current)
+	if renamed.BasicAuth.Password != "" {
+		t.Error("password kept for another username")
+	}
+}
@@ -0,0 +1,351 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"webcrawler/database"
+	"webcrawler/models"
+	"webcrawler/oidc"
+	"webcrawler/tokens"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	errSSOAccountNotFound = errors.New("no account for this identity and automatic provisioning is disabled")
+	errSSOEmailLinked     = errors.New("the account with this email is linked to another identity")
+	errSSOEmailUnverified = errors.New("the account with this email has not verified it")
+)
+
+var invalidUsernameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// GetSSOConfig tells the frontend whether to offer single sign-on.
+func GetSSOConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, models.SSOConfigResponse{
+		Enabled: oidc.Enabled(),
+	})
+}
+
+// SSOLogin starts the authorization code flow by redirecting the browser to
+// the identity provider.
+func SSOLogin(c *gin.Context) {
+	if !oidc.Enabled() {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "Single sign-on is not configured",
+		})
+		return
+	}
+
+	provider, err := oidc.Discover()
+	if err != nil {
+		log.Printf("OIDC discovery failed: %v", err)
+		c.JSON(http.StatusBadGateway, models.ErrorResponse{
+			Error: "Identity provider is unavailable",
+		})
+		return
+	}
+
+	// Drop logins that were abandoned or never exchanged
+	if _, err := database.DB.Exec("DELETE FROM oidc_logins WHERE expires_at < NOW()"); err != nil {
+		log.Printf("Failed to prune OIDC logins: %v", err)
+	}
+
+	state, nonce, verifier := oidc.RandomString(32), oidc.RandomString(32), oidc.NewVerifier()
+	_, err = database.DB.Exec(
+		"INSERT INTO oidc_logins (state, nonce, code_verifier, expires_at) VALUES (?, ?, ?, NOW() + INTERVAL 10 MINUTE)",
+		state, nonce, verifier,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to start login",
+		})
+		return
+	}
+
+	c.Redirect(http.StatusFound, provider.AuthCodeURL(state, nonce, verifier))
+}
+
+// SSOCallback completes the login when the identity provider redirects back,
+// then sends the browser to the frontend with a one-time code.
+func SSOCallback(c *gin.Context) {
+	if !oidc.Enabled() {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "Single sign-on is not configured",
+		})
+		return
+	}
+
+	if providerErr := c.Query("error"); providerErr != "" {
+		redirectToFrontend(c, "error", providerErr)
+		return
+	}
+
+	// Each state is accepted once
+	var loginID int
+	var nonce, verifier string
+	err := database.DB.QueryRow(
+		"SELECT id, nonce, code_verifier FROM oidc_logins WHERE state = ? AND expires_at > NOW()",
+		c.Query("state"),
+	).Scan(&loginID, &nonce, &verifier)
+	if err != nil {
+		redirectToFrontend(c, "error", "invalid_state")
+		return
+	}
+	result, err := database.DB.Exec("UPDATE oidc_logins SET state = NULL WHERE id = ? AND state IS NOT NULL", loginID)
+	if err != nil {
+		redirectToFrontend(c, "error", "server_error")
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows != 1 {
+		redirectToFrontend(c, "error", "invalid_state")
+		return
+	}
+
+	provider, err := oidc.Discover()
+	if err != nil {
+		log.Printf("OIDC discovery failed: %v", err)
+		redirectToFrontend(c, "error", "provider_unavailable")
+		return
+	}
+
+	idToken, err := provider.Exchange(c.Query("code"), verifier)
+	if err != nil {
+		log.Printf("OIDC code exchange failed: %v", err)
+		redirectToFrontend(c, "error", "exchange_failed")
+		return
+	}
+
+	claims, err := provider.Verify(idToken, nonce)
+	if err != nil {
+		log.Printf("OIDC ID token rejected: %v", err)
+		redirectToFrontend(c, "error", "invalid_token")
+		return
+	}
+
+	user, err := findOrCreateSSOUser(provider.Issuer, claims)
+	if err == errSSOEmailUnverified {
+		// The owner logs in with their password and verifies the address
+		// first, which proves the account is theirs
+		redirectToFrontend(c, "error", "email_unverified")
+		return
+	}
+	if err != nil {
+		log.Printf("OIDC login for %s failed: %v", claims.Subject, err)
+		redirectToFrontend(c, "error", "account_unavailable")
+		return
+	}
+
+	// Hand the frontend a short-lived code rather than tokens in the URL
+	code := oidc.RandomString(32)
+	_, err = database.DB.Exec(
+		"UPDATE oidc_logins SET user_id = ?, exchange_hash = ?, expires_at = NOW() + INTERVAL 1 MINUTE WHERE id = ?",
+		user.ID, tokens.Hash(code), loginID,
+	)
+	if err != nil {
+		redirectToFrontend(c, "error", "server_error")
+		return
+	}
+
+	redirectToFrontend(c, "code", code)
+}
+
+// SSOExchange trades the one-time code from SSOCallback for session tokens.
+func SSOExchange(c *gin.Context) {
+	var req models.SSOExchangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	var loginID, userID int
+	err := database.DB.QueryRow(
+		"SELECT id, user_id FROM oidc_logins WHERE exchange_hash = ? AND user_id IS NOT NULL AND expires_at > NOW()",
+		tokens.Hash(req.Code),
+	).Scan(&loginID, &userID)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error: "Invalid or expired login code",
+		})
+		return
+	}
+
+	result, err := database.DB.Exec("DELETE FROM oidc_logins WHERE id = ?", loginID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to complete login",
+		})
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows != 1 {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error: "Invalid or expired login code",
+		})
+		return
+	}
+
+	var user models.User
+	query := "SELECT id, username, email, created_at, updated_at FROM users WHERE id = ?"
+	err = database.DB.QueryRow(query, userID).Scan(&user.ID, &user.Username, &user.Email, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error: "User not found",
+		})
+		return
+	}
+
+	completeLogin(c, user, loginReasonSSO, loginReasonSSOOK)
+}
+
+func redirectToFrontend(c *gin.Context, key, value string) {
+	target := oidc.Settings().FrontendURL + "#" + url.Values{key: {value}}.Encode()
+	c.Redirect(http.StatusFound, target)
+}
+
+// findOrCreateSSOUser maps an identity to a local user: by issuer and
+// subject, then by verified email (linking the existing account if it
+// verified the address too), and finally by creating a new user.
+func findOrCreateSSOUser(issuer string, claims *oidc.Claims) (models.User, error) {
+	var user models.User
+	query := "SELECT id, username, email, created_at, updated_at FROM users WHERE oidc_issuer = ? AND oidc_subject = ?"
+	err := database.DB.QueryRow(query, issuer, claims.Subject).Scan(
+		&user.ID, &user.Username, &user.Email, &user.CreatedAt, &user.UpdatedAt,
+	)
+	if err == nil {
+		return user, nil
+	}
+	if err != sql.ErrNoRows {
+		return user, err
+	}
+
+	if claims.Email == "" || !claims.IsEmailVerified() {
+		return user, errors.New("identity has no verified email address")
+	}
+
+	// Link an existing account with the same email, or create one
+	var account *ssoEmailAccount
+	var verified, linked bool
+	query = "SELECT id, username, email, created_at, updated_at, email_verified_at IS NOT NULL, oidc_subject IS NOT NULL FROM users WHERE email = ?"
+	err = database.DB.QueryRow(query, claims.Email).Scan(
+		&user.ID, &user.Username, &user.Email, &user.CreatedAt, &user.UpdatedAt, &verified, &linked,
+	)
+	if err == nil {
+		account = &ssoEmailAccount{verified: verified, linked: linked}
+	} else if err != sql.ErrNoRows {
+		return user, err
+	}
+
+	link, err := ssoLinkOrProvision(account, oidc.Settings().AutoProvision)
+	if err != nil {
+		return user, err
+	}
+	if link {
+		_, err = database.DB.Exec(
+			"UPDATE users SET oidc_issuer = ?, oidc_subject = ? WHERE id = ? AND oidc_subject IS NULL",
+			issuer, claims.Subject, user.ID,
+		)
+		if err != nil {
+			return user, err
+		}
+		log.Printf("Linked user %d to OIDC subject %s", user.ID, claims.Subject)
+		return user, nil
+	}
+
+	username, err := availableUsername(claims.Username())
+	if err != nil {
+		return user, err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return user, err
+	}
+	defer tx.Rollback()
+
+	// SSO users have no local password; the provider verified the email
+	result, err := tx.Exec(
+		"INSERT INTO users (username, email, password_hash, oidc_issuer, oidc_subject, email_verified_at) VALUES (?, ?, '', ?, ?, NOW())",
+		username, claims.Email, issuer, claims.Subject,
+	)
+	if err != nil {
+		return user, err
+	}
+
+	userID, _ := result.LastInsertId()
+	if err := createPersonalWorkspace(tx, int(userID), username); err != nil {
+		return user, err
+	}
+	if err := tx.Commit(); err != nil {
+		return user, err
+	}
+	log.Printf("Provisioned user %d for OIDC subject %s", userID, claims.Subject)
+
+	return models.User{
+		ID:       int(userID),
+		Username: username,
+		Email:    claims.Email,
+	}, nil
+}
+
+// ssoEmailAccount is the local account with the same email address as an
+// identity that is not linked yet.
+type ssoEmailAccount struct {
+	verified bool
+	linked   bool
+}
+
+// ssoLinkOrProvision decides whether a new identity is linked to the local
+// account with its email address or gets a new account. Only accounts that
+// proved they own the address are linked: anyone can register an account
+// with someone else's email, and linking it would hand them the victim's
+// SSO logins.
+func ssoLinkOrProvision(account *ssoEmailAccount, autoProvision bool) (link bool, err error) {
+	switch {
+	case account == nil && autoProvision:
+		return false, nil
+	case account == nil:
+		return false, errSSOAccountNotFound
+	case account.linked:
+		return false, errSSOEmailLinked
+	case !account.verified:
+		return false, errSSOEmailUnverified
+	}
+	return true, nil
+}
+
+// availableUsername turns a claim into a valid username, adding a number
+// when it is already taken.
+func availableUsername(claim string) (string, error) {
+	base := strings.Trim(invalidUsernameChars.ReplaceAllString(claim, ""), ".-_")
+	if len(base) > 40 {
+		base = base[:40]
+	}
+	if base == "" {
+		base = "user"
+	}
+
+	for i := 1; i <= 100; i++ {
+		candidate := base
+		if i > 1 {
+			candidate = fmt.Sprintf("%s%d", base, i)
+		}
+
+		var exists bool
+		if err := database.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE username = ?)", candidate).Scan(&exists); err != nil {
+			return "", err
+		}
+		if !exists {
+			return candidate, nil
+		}
+	}
+
+	return "", errors.New("could not find a free username")
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import "testing"
+
+func TestSSOLinkOrProvision(t *testing.T) {
+	tests := []struct {
+		name          string
+		account       *ssoEmailAccount
+		autoProvision bool
+		link          bool
+		err           error
+	}{
+		{"new email provisions", nil, true, false, nil},
+		{"new email without provisioning", nil, false, false, errSSOAccountNotFound},
+		{"verified account links", &ssoEmailAccount{verified: true}, true, true, nil},
+		{"verified account links without provisioning", &ssoEmailAccount{verified: true}, false, true, nil},
+		{"unverified account is not linked", &ssoEmailAccount{}, true, false, errSSOEmailUnverified},
+		{"account linked elsewhere", &ssoEmailAccount{verified: true, linked: true}, true, false, errSSOEmailLinked},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			link, err := ssoLinkOrProvision(tt.account, tt.autoProvision)
+			if link != tt.link || err != tt.err {
+				t.Errorf("got (%v, %v), want (%v, %v)", link, err, tt.link, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,491 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"webcrawler/audit"
+	"webcrawler/database"
+	"webcrawler/models"
+	"webcrawler/secrets"
+	"webcrawler/tokens"
+	"webcrawler/totp"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errTwoFactorNotEnabled = errors.New("two-factor authentication is not enabled")
+
+// completeLogin finishes a successful first login step: users with
+// two-factor authentication get a challenge token, everyone else a session.
+// The attempt is recorded with reason once a session is issued, or with
+// challengeReason once the challenge is.
+func completeLogin(c *gin.Context, user models.User, reason, challengeReason string) {
+	var enabled, disabled bool
+	query := "SELECT totp_enabled, disabled_at IS NOT NULL FROM users WHERE id = ?"
+	err := database.DB.QueryRow(query, user.ID).Scan(&enabled, &disabled)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to log in",
+		})
+		return
+	}
+	if disabled {
+		c.JSON(http.StatusForbidden, models.ErrorResponse{
+			Error: "This account has been disabled",
+		})
+		return
+	}
+
+	if !enabled {
+		if startSession(c, http.StatusOK, user) {
+			loginSucceeded(c, user, reason)
+		}
+		return
+	}
+
+	challenge, err := tokens.IssueChallengeToken(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to generate token",
+		})
+		return
+	}
+
+	recordLoginAttempt(c, user.Username, user.ID, true, challengeReason)
+	c.JSON(http.StatusOK, models.TwoFactorChallengeResponse{
+		TwoFactorRequired: true,
+		ChallengeToken:    challenge,
+		ExpiresIn:         int(tokens.ChallengeTTL.Seconds()),
+	})
+}
+
+// loginSucceeded records a login that issued a session and lifts any delay
+// on the username.
+func loginSucceeded(c *gin.Context, user models.User, reason string) {
+	recordLoginAttempt(c, user.Username, user.ID, true, reason)
+	if err := clearFailedLogins(user.Username); err != nil {
+		log.Printf("Failed to clear failed logins for user %d: %v", user.ID, err)
+	}
+}
+
+// LoginTwoFactor is the second login step: it exchanges a challenge token
+// and a TOTP or recovery code for a session.
+func LoginTwoFactor(c *gin.Context) {
+	var req models.TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	userID, claims, err := tokens.ParseChallengeToken(req.ChallengeToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error: "Invalid or expired challenge token",
+		})
+		return
+	}
+
+	var user models.User
+	query := "SELECT id, username, email, created_at, updated_at FROM users WHERE id = ?"
+	err = database.DB.QueryRow(query, userID).Scan(&user.ID, &user.Username, &user.Email, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error: "User not found",
+		})
+		return
+	}
+
+	// Code guesses count towards the same limits as password guesses
+	if throttleLogin(c, user.Username) {
+		return
+	}
+
+	ok, err := checkSecondFactor(userID, req.Code)
+	if err != nil && !errors.Is(err, errTwoFactorNotEnabled) {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to verify code",
+		})
+		return
+	}
+	if !ok {
+		recordLoginAttempt(c, user.Username, user.ID, false, loginReasonBadCode)
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error: "Invalid authentication code",
+		})
+		return
+	}
+
+	// The challenge is spent once it has been answered
+	if err := tokens.RevokeAccessToken(claims); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to log in",
+		})
+		return
+	}
+
+	if startSession(c, http.StatusOK, user) {
+		loginSucceeded(c, user, loginReasonTwoFactor)
+	}
+}
+
+func GetTwoFactorStatus(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	var status models.TwoFactorStatus
+	query := `
+		SELECT u.totp_enabled,
+			(SELECT COUNT(*) FROM recovery_codes r WHERE r.user_id = u.id AND r.used_at IS NULL)
+		FROM users u
+		WHERE u.id = ?
+	`
+	err := database.DB.QueryRow(query, userID).Scan(&status.Enabled, &status.RecoveryCodesRemaining)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to fetch two-factor status",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// EnrollTwoFactor generates a new secret for the user to add to their
+// authenticator app. It only takes effect once VerifyTwoFactor confirms a
+// code from the app.
+func EnrollTwoFactor(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	username := c.GetString("username")
+
+	var enabled bool
+	if err := database.DB.QueryRow("SELECT totp_enabled FROM users WHERE id = ?", userID).Scan(&enabled); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to start enrollment",
+		})
+		return
+	}
+	if enabled {
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error: "Two-factor authentication is already enabled",
+		})
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to generate secret",
+		})
+		return
+	}
+	encrypted, err := secrets.Encrypt(secret)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to store secret",
+		})
+		return
+	}
+
+	_, err = database.DB.Exec(
+		"UPDATE users SET totp_secret = ?, totp_last_step = NULL WHERE id = ? AND totp_enabled = FALSE",
+		encrypted, userID,
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to store secret",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.TwoFactorEnrollment{
+		Secret:     secret,
+		OTPAuthURI: totp.URI(totpIssuer(), username, secret),
+	})
+}
+
+// VerifyTwoFactor confirms enrollment with a code from the authenticator app,
+// enables two-factor authentication and returns the recovery codes.
+func VerifyTwoFactor(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	var req models.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	var encrypted sql.NullString
+	var enabled bool
+	err := database.DB.QueryRow("SELECT totp_secret, totp_enabled FROM users WHERE id = ?", userID).Scan(&encrypted, &enabled)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to verify code",
+		})
+		return
+	}
+	if enabled {
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error: "Two-factor authentication is already enabled",
+		})
+		return
+	}
+	if !encrypted.Valid {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Start enrollment first",
+		})
+		return
+	}
+
+	secret, err := secrets.Decrypt(encrypted.String)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to verify code",
+		})
+		return
+	}
+
+	step, ok := totp.Validate(secret, req.Code, time.Now(), -1)
+	if !ok {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid authentication code",
+		})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to enable two-factor authentication",
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE users SET totp_enabled = TRUE, totp_last_step = ? WHERE id = ?", step, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to enable two-factor authentication",
+		})
+		return
+	}
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to enable two-factor authentication",
+		})
+		return
+	}
+
+	audit.Record(c, audit.Event{Action: audit.TwoFactorOn})
+
+	c.JSON(http.StatusOK, models.RecoveryCodesResponse{
+		RecoveryCodes: codes,
+	})
+}
+
+// DisableTwoFactor turns two-factor authentication off after checking a
+// current TOTP or recovery code.
+func DisableTwoFactor(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	var req models.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	if !requireSecondFactor(c, userID, req.Code) {
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to disable two-factor authentication",
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE users SET totp_enabled = FALSE, totp_secret = NULL, totp_last_step = NULL WHERE id = ?", userID)
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to disable two-factor authentication",
+		})
+		return
+	}
+
+	audit.Record(c, audit.Event{Action: audit.TwoFactorOff})
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Message: "Two-factor authentication disabled",
+	})
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after checking a
+// current TOTP or recovery code.
+func RegenerateRecoveryCodes(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	var req models.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	if !requireSecondFactor(c, userID, req.Code) {
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to generate recovery codes",
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	codes, err := replaceRecoveryCodes(tx, userID)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to generate recovery codes",
+		})
+		return
+	}
+
+	audit.Record(c, audit.Event{Action: audit.RecoveryCodes})
+	c.JSON(http.StatusOK, models.RecoveryCodesResponse{
+		RecoveryCodes: codes,
+	})
+}
+
+// requireSecondFactor checks a code for a management action and writes the
+// error response when it is not accepted.
+func requireSecondFactor(c *gin.Context, userID int, code string) bool {
+	ok, err := checkSecondFactor(userID, code)
+	if errors.Is(err, errTwoFactorNotEnabled) {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Two-factor authentication is not enabled",
+		})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to verify code",
+		})
+		return false
+	}
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error: "Invalid authentication code",
+		})
+		return false
+	}
+	return true
+}
+
+// checkSecondFactor accepts either a current TOTP code or an unused recovery
+// code. Each TOTP code and each recovery code is accepted once.
+func checkSecondFactor(userID int, code string) (bool, error) {
+	var encrypted sql.NullString
+	var lastStep sql.NullInt64
+	var enabled bool
+	err := database.DB.QueryRow(
+		"SELECT totp_secret, totp_enabled, totp_last_step FROM users WHERE id = ?", userID,
+	).Scan(&encrypted, &enabled, &lastStep)
+	if err != nil {
+		return false, err
+	}
+	if !enabled || !encrypted.Valid {
+		return false, errTwoFactorNotEnabled
+	}
+
+	if !totp.IsCode(code) {
+		result, err := database.DB.Exec(
+			"UPDATE recovery_codes SET used_at = NOW() WHERE user_id = ? AND code_hash = ? AND used_at IS NULL",
+			userID, tokens.Hash(totp.NormalizeRecoveryCode(code)),
+		)
+		if err != nil {
+			return false, err
+		}
+		rows, _ := result.RowsAffected()
+		return rows == 1, nil
+	}
+
+	secret, err := secrets.Decrypt(encrypted.String)
+	if err != nil {
+		return false, err
+	}
+
+	last := int64(-1)
+	if lastStep.Valid {
+		last = lastStep.Int64
+	}
+	step, ok := totp.Validate(secret, code, time.Now(), last)
+	if !ok {
+		return false, nil
+	}
+
+	// Record the step so the same code cannot be replayed, even concurrently
+	result, err := database.DB.Exec(
+		"UPDATE users SET totp_last_step = ? WHERE id = ? AND (totp_last_step IS NULL OR totp_last_step < ?)",
+		step, userID, step,
+	)
+	if err != nil {
+		return false, err
+	}
+	rows, _ := result.RowsAffected()
+	return rows == 1, nil
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, userID int) ([]string, error) {
+	codes, err := totp.NewRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+		return nil, err
+	}
+	for _, code := range codes {
+		_, err := tx.Exec(
+			"INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?)",
+			userID, tokens.Hash(totp.NormalizeRecoveryCode(code)),
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+// totpIssuer is the account label shown in authenticator apps, TOTP_ISSUER.
+func totpIssuer() string {
+	if issuer := os.Getenv("TOTP_ISSUER"); issuer != "" {
+		return issuer
+	}
+	return "Web Crawler"
+}
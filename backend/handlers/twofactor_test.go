@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"webcrawler/database"
+	"webcrawler/secrets"
+	"webcrawler/tokens"
+	"webcrawler/totp"
+)
+
+// twoFactorStore stands in for the users and recovery_codes rows that
+// checkSecondFactor reads and updates.
+type twoFactorStore struct {
+	mu       sync.Mutex
+	secret   string
+	enabled  bool
+	lastStep *int64
+	// recovery maps code hashes to whether they were used
+	recovery map[string]bool
+}
+
+func (s *twoFactorStore) Connect(context.Context) (driver.Conn, error) { return s, nil }
+func (s *twoFactorStore) Driver() driver.Driver                        { return nil }
+
+func (s *twoFactorStore) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements not supported")
+}
+func (s *twoFactorStore) Close() error              { return nil }
+func (s *twoFactorStore) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+func (s *twoFactorStore) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !strings.HasPrefix(query, "SELECT totp_secret, totp_enabled, totp_last_step FROM users") {
+		return nil, errors.New("unexpected query: " + query)
+	}
+
+	var lastStep driver.Value
+	if s.lastStep != nil {
+		lastStep = *s.lastStep
+	}
+	return &fakeRows{
+		columns: []string{"totp_secret", "totp_enabled", "totp_last_step"},
+		values:  [][]driver.Value{{s.secret, s.enabled, lastStep}},
+	}, nil
+}
+
+func (s *twoFactorStore) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case strings.HasPrefix(query, "UPDATE recovery_codes SET used_at"):
+		hash := args[1].Value.(string)
+		if used, ok := s.recovery[hash]; !ok || used {
+			return driver.RowsAffected(0), nil
+		}
+		s.recovery[hash] = true
+		return driver.RowsAffected(1), nil
+
+	case strings.HasPrefix(query, "UPDATE users SET totp_last_step"):
+		step := args[0].Value.(int64)
+		if s.lastStep != nil && *s.lastStep >= step {
+			return driver.RowsAffected(0), nil
+		}
+		s.lastStep = &step
+		return driver.RowsAffected(1), nil
+	}
+	return nil, errors.New("unexpected statement: " + query)
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+// useTwoFactorStore points the database at a store for the user with TOTP
+// secret and the recovery codes.
+func useTwoFactorStore(t *testing.T, secret string, recoveryCodes ...string) *twoFactorStore {
+	t.Helper()
+	t.Setenv("JWT_SECRET", "test-secret")
+	encrypted, err := secrets.Encrypt(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &twoFactorStore{secret: encrypted, enabled: true, recovery: map[string]bool{}}
+	for _, code := range recoveryCodes {
+		store.recovery[tokens.Hash(totp.NormalizeRecoveryCode(code))] = false
+	}
+
+	saved := database.DB
+	database.DB = sql.OpenDB(store)
+	t.Cleanup(func() {
+		database.DB.Close()
+		database.DB = saved
+	})
+	return store
+}
+
+func TestCheckSecondFactorRejectsReplay(t *testing.T) {
+	secret, _ := totp.GenerateSecret()
+	store := useTwoFactorStore(t, secret)
+
+	step := totp.Step(time.Now())
+	code, _ := totp.Code(secret, step)
+
+	if ok, err := checkSecondFactor(1, code); !ok || err != nil {
+		t.Fatalf("fresh code: got (%v, %v)", ok, err)
+	}
+	if store.lastStep == nil || *store.lastStep < step {
+		t.Fatalf("totp_last_step not recorded: %v", store.lastStep)
+	}
+	if ok, _ := checkSecondFactor(1, code); ok {
+		t.Error("code accepted twice")
+	}
+
+	previous, _ := totp.Code(secret, *store.lastStep-1)
+	if ok, _ := checkSecondFactor(1, previous); ok {
+		t.Error("earlier code accepted after a later one was used")
+	}
+}
+
+func TestCheckSecondFactorRecoveryCodes(t *testing.T) {
+	secret, _ := totp.GenerateSecret()
+	useTwoFactorStore(t, secret, "abcde-fghjk", "mnpqr-stuvw")
+
+	tests := []struct {
+		code string
+		ok   bool
+	}{
+		{"ABCDE FGHJK", true},
+		{"abcde-fghjk", false}, // already used
+		{" mnpqrstuvw ", true},
+		{"xyzab-cdefg", false},
+	}
+
+	for _, tt := range tests {
+		ok, err := checkSecondFactor(1, tt.code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != tt.ok {
+			t.Errorf("%q: got %v, want %v", tt.code, ok, tt.ok)
+		}
+	}
+}
+
+func TestCheckSecondFactorNotEnabled(t *testing.T) {
+	store := useTwoFactorStore(t, "")
+	store.enabled = false
+
+	if _, err := checkSecondFactor(1, "123456"); !errors.Is(err, errTwoFactorNotEnabled) {
+		t.Errorf("got %v, want errTwoFactorNotEnabled", err)
+	}
+}
@@ -2,12 +2,18 @@ package handlers
 
 import (
 	"database/sql"
+	"encoding/json"
 	"net/http"
 	"strconv"
+	"strings"
 
+	"webcrawler/audit"
+	"webcrawler/authz"
 	"webcrawler/crawler"
 	"webcrawler/database"
 	"webcrawler/models"
+	"webcrawler/quota"
+	"webcrawler/urlnorm"
 
 	"github.com/gin-gonic/gin"
 )
@@ -23,10 +29,86 @@ func CreateURL(c *gin.Context) {
 		return
 	}
 
+	if err := crawler.ValidateProfile(req.Profile); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid crawl profile: " + err.Error(),
+		})
+		return
+	}
+
+	// The URL is crawled as submitted; its canonical form only serves to
+	// spot duplicates, since some sites care about a trailing slash or the
+	// order of query parameters
+	submittedURL := strings.TrimSpace(req.URL)
+	canonicalURL, err := urlnorm.Canonicalize(submittedURL)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid URL: " + err.Error(),
+		})
+		return
+	}
+	urlHash := urlnorm.Hash(canonicalURL)
+
+	workspaceID, ok := resolveWorkspace(c, req.WorkspaceID, authz.ManageCrawls)
+	if !ok {
+		return
+	}
+
+	// Reject duplicates of a URL the workspace already has
+	var existingID int
+	err = findURLByHash(workspaceID, urlHash, &existingID)
+	if err == nil {
+		c.JSON(http.StatusConflict, models.DuplicateURLResponse{
+			Error:      "URL already exists",
+			ExistingID: existingID,
+		})
+		return
+	} else if err != sql.ErrNoRows {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to check for duplicate URL",
+		})
+		return
+	}
+
+	profileJSON, err := encodeProfile(req.Profile)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to store crawl profile",
+		})
+		return
+	}
+
+	// Check the quota and insert in one transaction so concurrent requests
+	// cannot both take the last free slot
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to create URL",
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	if err := quota.CheckURLs(tx, userID, 1); err != nil {
+		writeQuotaError(c, err, "Failed to check URL quota")
+		return
+	}
+
 	// Insert URL
-	query := "INSERT INTO urls (user_id, url, status) VALUES (?, ?, 'queued')"
-	result, err := database.DB.Exec(query, userID, req.URL)
+	query := "INSERT INTO urls (user_id, workspace_id, url, url_hash, crawl_profile, status) VALUES (?, ?, ?, ?, ?, 'queued')"
+	result, err := tx.Exec(query, userID, workspaceID, submittedURL, urlHash, profileJSON)
+	if err == nil {
+		err = tx.Commit()
+	}
 	if err != nil {
+		// A concurrent request may have inserted the same URL in the meantime
+		if findURLByHash(workspaceID, urlHash, &existingID) == nil {
+			c.JSON(http.StatusConflict, models.DuplicateURLResponse{
+				Error:      "URL already exists",
+				ExistingID: existingID,
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error: "Failed to create URL",
 		})
@@ -37,11 +119,14 @@ func CreateURL(c *gin.Context) {
 
 	// Return created URL
 	url := models.URL{
-		ID:     int(urlID),
-		UserID: userID,
-		URL:    req.URL,
-		Status: "queued",
+		ID:          int(urlID),
+		UserID:      userID,
+		WorkspaceID: workspaceID,
+		URL:         submittedURL,
+		Status:      "queued",
+		Profile:     redactProfile(req.Profile),
 	}
+	auditURLs(c, audit.URLCreate, []models.URL{url})
 
 	c.JSON(http.StatusCreated, models.SuccessResponse{
 		Message: "URL created successfully",
@@ -49,6 +134,136 @@ func CreateURL(c *gin.Context) {
 	})
 }
 
+func findURLByHash(workspaceID int, urlHash string, id *int) error {
+	return database.DB.QueryRow("SELECT id FROM urls WHERE workspace_id = ? AND url_hash = ?", workspaceID, urlHash).Scan(id)
+}
+
+// inWorkspacesWith restricts a query on urls u to the workspaces in which
+// the user, passed as its parameter, has the permission.
+func inWorkspacesWith(permission authz.Permission) string {
+	return " u.workspace_id IN (" + authz.WorkspacesWith(permission) + ")"
+}
+
+// auditURLs records an action on URLs with one event per workspace, so each
+// workspace's admins see their share of a bulk action.
+func auditURLs(c *gin.Context, action string, urls []models.URL) {
+	var workspaces []int
+	byWorkspace := map[int][]models.URL{}
+	for _, url := range urls {
+		if _, ok := byWorkspace[url.WorkspaceID]; !ok {
+			workspaces = append(workspaces, url.WorkspaceID)
+		}
+		byWorkspace[url.WorkspaceID] = append(byWorkspace[url.WorkspaceID], url)
+	}
+
+	for _, workspaceID := range workspaces {
+		ids := []int{}
+		addresses := []string{}
+		for _, url := range byWorkspace[workspaceID] {
+			ids = append(ids, url.ID)
+			addresses = append(addresses, url.URL)
+		}
+		audit.Record(c, audit.Event{
+			Action:      action,
+			TargetType:  audit.TargetURL,
+			TargetIDs:   ids,
+			WorkspaceID: workspaceID,
+			Details:     map[string]interface{}{"urls": addresses},
+		})
+	}
+}
+
+// cancelCrawls stops any crawl of deleted URLs, which would otherwise keep
+// running and holding a queue slot.
+func cancelCrawls(urls []models.URL) {
+	for _, url := range urls {
+		crawler.Cancel(url.ID)
+	}
+}
+
+// urlWithResultColumns selects a URL joined with its crawl result, if any.
+const urlWithResultColumns = `u.id, u.user_id, u.workspace_id, u.url, u.status, u.crawl_profile, u.created_at, u.updated_at,
+			   r.id, r.title, r.html_version, r.h1_count, r.h2_count, r.h3_count,
+			   r.h4_count, r.h5_count, r.h6_count, r.internal_links, r.external_links,
+			   r.inaccessible_links, r.has_login_form, r.outcome, r.content_type,
+			   r.content_length, r.truncated, r.encoding, r.ttfb_ms, r.download_ms,
+			   r.html_bytes, r.html_transfer_bytes, r.compression, r.subresource_count,
+			   r.subresource_bytes, r.over_budget, r.budget_violations`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanURLWithResult scans a row selected with urlWithResultColumns. The
+// result is only attached when the URL has been crawled.
+func scanURLWithResult(row rowScanner, url *models.URL) error {
+	var resultID, userID sql.NullInt64
+	var profile sql.NullString
+	var title, htmlVersion, outcome, contentType, encoding, compression, violations sql.NullString
+	var h1, h2, h3, h4, h5, h6, internal, external, inaccessible, contentLength sql.NullInt64
+	var ttfb, download, htmlBytes, transferBytes, subresources, subresourceBytes sql.NullInt64
+	var hasLoginForm, truncated, overBudget sql.NullBool
+
+	err := row.Scan(
+		&url.ID, &userID, &url.WorkspaceID, &url.URL, &url.Status, &profile, &url.CreatedAt, &url.UpdatedAt,
+		&resultID, &title, &htmlVersion, &h1, &h2, &h3, &h4, &h5, &h6,
+		&internal, &external, &inaccessible, &hasLoginForm, &outcome, &contentType,
+		&contentLength, &truncated, &encoding, &ttfb, &download,
+		&htmlBytes, &transferBytes, &compression, &subresources,
+		&subresourceBytes, &overBudget, &violations,
+	)
+	if err != nil {
+		return err
+	}
+
+	url.UserID = int(userID.Int64)
+	url.Profile = redactProfile(decodeProfile(profile))
+
+	// If result exists, populate it
+	if resultID.Valid {
+		url.Result = &models.CrawlResult{
+			ID:                int(resultID.Int64),
+			URLID:             url.ID,
+			Title:             title.String,
+			HTMLVersion:       htmlVersion.String,
+			H1Count:           int(h1.Int64),
+			H2Count:           int(h2.Int64),
+			H3Count:           int(h3.Int64),
+			H4Count:           int(h4.Int64),
+			H5Count:           int(h5.Int64),
+			H6Count:           int(h6.Int64),
+			InternalLinks:     int(internal.Int64),
+			ExternalLinks:     int(external.Int64),
+			InaccessibleLinks: int(inaccessible.Int64),
+			HasLoginForm:      hasLoginForm.Bool,
+			Outcome:           outcome.String,
+			ContentType:       contentType.String,
+			ContentLength:     contentLength.Int64,
+			Truncated:         truncated.Bool,
+			Encoding:          encoding.String,
+			TTFBMs:            int(ttfb.Int64),
+			DownloadMs:        int(download.Int64),
+			HTMLBytes:         htmlBytes.Int64,
+			HTMLTransferBytes: transferBytes.Int64,
+			Compression:       compression.String,
+			SubresourceCount:  int(subresources.Int64),
+			SubresourceBytes:  subresourceBytes.Int64,
+			OverBudget:        overBudget.Bool,
+			BudgetViolations:  splitViolations(violations.String),
+		}
+	}
+
+	return nil
+}
+
+// splitViolations parses the comma-separated budget_violations column.
+func splitViolations(value string) []string {
+	if value == "" {
+		return []string{}
+	}
+	return strings.Split(value, ",")
+}
+
 func GetURL(c *gin.Context) {
 	userID := c.GetInt("user_id")
 	urlID, err := strconv.Atoi(c.Param("id"))
@@ -60,27 +275,14 @@ func GetURL(c *gin.Context) {
 	}
 
 	query := `
-		SELECT u.id, u.url, u.status, u.created_at, u.updated_at,
-			   r.id, r.title, r.html_version, r.h1_count, r.h2_count, r.h3_count, 
-			   r.h4_count, r.h5_count, r.h6_count, r.internal_links, r.external_links,
-			   r.inaccessible_links, r.has_login_form
+		SELECT ` + urlWithResultColumns + `
 		FROM urls u
 		LEFT JOIN crawl_results r ON u.id = r.url_id
-		WHERE u.id = ? AND u.user_id = ?
+		WHERE u.id = ? AND` + inWorkspacesWith(authz.ViewURLs) + `
 	`
 
 	var url models.URL
-	var result models.CrawlResult
-	var resultID sql.NullInt64
-	var title, htmlVersion sql.NullString
-	var h1, h2, h3, h4, h5, h6, internal, external, inaccessible sql.NullInt64
-	var hasLoginForm sql.NullBool
-
-	err = database.DB.QueryRow(query, urlID, userID).Scan(
-		&url.ID, &url.URL, &url.Status, &url.CreatedAt, &url.UpdatedAt,
-		&resultID, &title, &htmlVersion, &h1, &h2, &h3, &h4, &h5, &h6,
-		&internal, &external, &inaccessible, &hasLoginForm,
-	)
+	err = scanURLWithResult(database.DB.QueryRow(query, urlID, userID), &url)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, models.ErrorResponse{
@@ -94,27 +296,6 @@ func GetURL(c *gin.Context) {
 		return
 	}
 
-	url.UserID = userID
-
-	// If result exists, populate it
-	if resultID.Valid {
-		result.ID = int(resultID.Int64)
-		result.URLID = url.ID
-		result.Title = title.String
-		result.HTMLVersion = htmlVersion.String
-		result.H1Count = int(h1.Int64)
-		result.H2Count = int(h2.Int64)
-		result.H3Count = int(h3.Int64)
-		result.H4Count = int(h4.Int64)
-		result.H5Count = int(h5.Int64)
-		result.H6Count = int(h6.Int64)
-		result.InternalLinks = int(internal.Int64)
-		result.ExternalLinks = int(external.Int64)
-		result.InaccessibleLinks = int(inaccessible.Int64)
-		result.HasLoginForm = hasLoginForm.Bool
-		url.Result = &result
-	}
-
 	c.JSON(http.StatusOK, url)
 }
 
@@ -128,10 +309,10 @@ func StartCrawling(c *gin.Context) {
 		return
 	}
 
-	// Check if URL exists and belongs to user
+	// Check if URL exists in one of the user's workspaces
 	var url models.URL
-	query := "SELECT id, url, status FROM urls WHERE id = ? AND user_id = ?"
-	err = database.DB.QueryRow(query, urlID, userID).Scan(&url.ID, &url.URL, &url.Status)
+	query := "SELECT u.id, u.workspace_id, u.url, u.status FROM urls u WHERE u.id = ? AND" + inWorkspacesWith(authz.ManageCrawls)
+	err = database.DB.QueryRow(query, urlID, userID).Scan(&url.ID, &url.WorkspaceID, &url.URL, &url.Status)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, models.ErrorResponse{
@@ -145,17 +326,10 @@ func StartCrawling(c *gin.Context) {
 		return
 	}
 
-	// Update status to running
-	_, err = database.DB.Exec("UPDATE urls SET status = 'running' WHERE id = ?", urlID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "Failed to update URL status",
-		})
+	if !startCrawls(c, userID, []models.URL{url}) {
 		return
 	}
-
-	// Start crawling in background
-	go crawler.CrawlURL(urlID, url.URL)
+	auditURLs(c, audit.CrawlStart, []models.URL{url})
 
 	c.JSON(http.StatusOK, models.SuccessResponse{
 		Message: "Crawling started",
@@ -172,9 +346,10 @@ func StopCrawling(c *gin.Context) {
 		return
 	}
 
-	// Check if URL exists and belongs to user
-	query := "SELECT id FROM urls WHERE id = ? AND user_id = ?"
-	err = database.DB.QueryRow(query, urlID, userID).Scan(&urlID)
+	// Check if URL exists in one of the user's workspaces
+	var url models.URL
+	query := "SELECT u.id, u.workspace_id, u.url FROM urls u WHERE u.id = ? AND" + inWorkspacesWith(authz.ManageCrawls)
+	err = database.DB.QueryRow(query, urlID, userID).Scan(&url.ID, &url.WorkspaceID, &url.URL)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, models.ErrorResponse{
@@ -196,6 +371,8 @@ func StopCrawling(c *gin.Context) {
 		})
 		return
 	}
+	crawler.Cancel(urlID)
+	auditURLs(c, audit.CrawlStop, []models.URL{url})
 
 	c.JSON(http.StatusOK, models.SuccessResponse{
 		Message: "Crawling stopped",
@@ -212,8 +389,25 @@ func DeleteURL(c *gin.Context) {
 		return
 	}
 
+	// Look the URL up first so the audit log can name it
+	var url models.URL
+	query := "SELECT u.id, u.workspace_id, u.url FROM urls u WHERE u.id = ? AND" + inWorkspacesWith(authz.ManageCrawls)
+	err = database.DB.QueryRow(query, urlID, userID).Scan(&url.ID, &url.WorkspaceID, &url.URL)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Error: "URL not found",
+			})
+		} else {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error: "Failed to delete URL",
+			})
+		}
+		return
+	}
+
 	// Delete URL (cascade will handle related records)
-	result, err := database.DB.Exec("DELETE FROM urls WHERE id = ? AND user_id = ?", urlID, userID)
+	result, err := database.DB.Exec("DELETE FROM urls WHERE id = ?", urlID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error: "Failed to delete URL",
@@ -228,6 +422,8 @@ func DeleteURL(c *gin.Context) {
 		})
 		return
 	}
+	cancelCrawls([]models.URL{url})
+	auditURLs(c, audit.URLDelete, []models.URL{url})
 
 	c.JSON(http.StatusOK, models.SuccessResponse{
 		Message: "URL deleted successfully",
@@ -248,18 +444,25 @@ func GetResults(c *gin.Context) {
 	query := `
 		SELECT r.id, r.title, r.html_version, r.h1_count, r.h2_count, r.h3_count, 
 			   r.h4_count, r.h5_count, r.h6_count, r.internal_links, r.external_links,
-			   r.inaccessible_links, r.has_login_form, r.created_at, r.updated_at
+			   r.inaccessible_links, r.has_login_form, r.outcome, r.content_type,
+			   r.content_length, r.truncated, r.encoding, r.ttfb_ms, r.download_ms,
+			   r.html_bytes, r.html_transfer_bytes, r.compression, r.subresource_count,
+			   r.subresource_bytes, r.over_budget, r.budget_violations, r.created_at, r.updated_at
 		FROM crawl_results r
 		JOIN urls u ON r.url_id = u.id
-		WHERE u.id = ? AND u.user_id = ?
+		WHERE u.id = ? AND` + inWorkspacesWith(authz.ViewURLs) + `
 	`
 
 	var result models.CrawlResult
+	var violations string
 	err = database.DB.QueryRow(query, urlID, userID).Scan(
 		&result.ID, &result.Title, &result.HTMLVersion, &result.H1Count, &result.H2Count,
 		&result.H3Count, &result.H4Count, &result.H5Count, &result.H6Count,
 		&result.InternalLinks, &result.ExternalLinks, &result.InaccessibleLinks,
-		&result.HasLoginForm, &result.CreatedAt, &result.UpdatedAt,
+		&result.HasLoginForm, &result.Outcome, &result.ContentType,
+		&result.ContentLength, &result.Truncated, &result.Encoding, &result.TTFBMs, &result.DownloadMs,
+		&result.HTMLBytes, &result.HTMLTransferBytes, &result.Compression, &result.SubresourceCount,
+		&result.SubresourceBytes, &result.OverBudget, &violations, &result.CreatedAt, &result.UpdatedAt,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -275,32 +478,111 @@ func GetResults(c *gin.Context) {
 	}
 
 	result.URLID = urlID
+	result.BudgetViolations = splitViolations(violations)
 
 	// Get broken links
-	brokenQuery := "SELECT id, url, status_code, error_message, created_at FROM broken_links WHERE result_id = ?"
-	rows, err := database.DB.Query(brokenQuery, result.ID)
+	result.BrokenLinks, err = loadBrokenLinks(result.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
 			Error: "Failed to get broken links",
 		})
 		return
 	}
+
+	// Get form inventory
+	result.Forms, err = loadForms(result.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to get forms",
+		})
+		return
+	}
+
+	// Get request timings
+	result.Timings, err = loadTimings(result.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to get request timings",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func loadBrokenLinks(resultID int) ([]models.BrokenLink, error) {
+	brokenQuery := "SELECT id, url, status_code, error_message, kind, attempts, error_class, created_at FROM broken_links WHERE result_id = ?"
+	rows, err := database.DB.Query(brokenQuery, resultID)
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
 
 	var brokenLinks []models.BrokenLink
 	for rows.Next() {
 		var link models.BrokenLink
-		err := rows.Scan(&link.ID, &link.URL, &link.StatusCode, &link.ErrorMessage, &link.CreatedAt)
+		err := rows.Scan(&link.ID, &link.URL, &link.StatusCode, &link.ErrorMessage, &link.Kind, &link.Attempts, &link.ErrorClass, &link.CreatedAt)
 		if err != nil {
 			continue
 		}
-		link.ResultID = result.ID
+		link.ResultID = resultID
 		brokenLinks = append(brokenLinks, link)
 	}
+	return brokenLinks, nil
+}
 
-	result.BrokenLinks = brokenLinks
+func loadForms(resultID int) ([]models.Form, error) {
+	formsQuery := `
+		SELECT id, action, method, kind, confidence, fields, has_csrf_token, insecure_submit, created_at
+		FROM page_forms WHERE result_id = ?
+	`
+	rows, err := database.DB.Query(formsQuery, resultID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	c.JSON(http.StatusOK, result)
+	var forms []models.Form
+	for rows.Next() {
+		var form models.Form
+		var fields []byte
+		err := rows.Scan(&form.ID, &form.Action, &form.Method, &form.Kind, &form.Confidence,
+			&fields, &form.HasCSRFToken, &form.InsecureSubmit, &form.CreatedAt)
+		if err != nil {
+			continue
+		}
+		if err := json.Unmarshal(fields, &form.Fields); err != nil {
+			continue
+		}
+		form.ResultID = resultID
+		forms = append(forms, form)
+	}
+	return forms, nil
+}
+
+func loadTimings(resultID int) ([]models.RequestTiming, error) {
+	timingsQuery := `
+		SELECT id, url, method, status_code, dns_ms, connect_ms, tls_ms, ttfb_ms, total_ms, reused, created_at
+		FROM request_timings WHERE result_id = ?
+	`
+	rows, err := database.DB.Query(timingsQuery, resultID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var timings []models.RequestTiming
+	for rows.Next() {
+		var timing models.RequestTiming
+		err := rows.Scan(&timing.ID, &timing.URL, &timing.Method, &timing.StatusCode, &timing.DNSMs,
+			&timing.ConnectMs, &timing.TLSMs, &timing.TTFBMs, &timing.TotalMs, &timing.Reused, &timing.CreatedAt)
+		if err != nil {
+			continue
+		}
+		timing.ResultID = resultID
+		timings = append(timings, timing)
+	}
+	return timings, nil
 }
 
 func BulkDeleteURLs(c *gin.Context) {
@@ -321,16 +603,32 @@ func BulkDeleteURLs(c *gin.Context) {
 		return
 	}
 
+	// Look the URLs up first so the audit log can name them
+	urls, err := findBulkURLs(userID, req.IDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to get URLs",
+		})
+		return
+	}
+	if len(urls) == 0 {
+		c.JSON(http.StatusOK, models.SuccessResponse{
+			Message: "URLs deleted successfully",
+			Data:    map[string]int64{"deleted_count": 0},
+		})
+		return
+	}
+
 	// Build query with placeholders
-	query := "DELETE FROM urls WHERE user_id = ? AND id IN ("
-	args := []interface{}{userID}
+	query := "DELETE FROM urls WHERE id IN ("
+	args := []interface{}{}
 
-	for i, id := range req.IDs {
+	for i, url := range urls {
 		if i > 0 {
 			query += ","
 		}
 		query += "?"
-		args = append(args, id)
+		args = append(args, url.ID)
 	}
 	query += ")"
 
@@ -341,6 +639,8 @@ func BulkDeleteURLs(c *gin.Context) {
 		})
 		return
 	}
+	cancelCrawls(urls)
+	auditURLs(c, audit.URLBulkDelete, urls)
 
 	rowsAffected, _ := result.RowsAffected()
 	c.JSON(http.StatusOK, models.SuccessResponse{
@@ -368,10 +668,80 @@ func BulkRerunURLs(c *gin.Context) {
 	}
 
 	// Get URLs to rerun
-	query := "SELECT id, url FROM urls WHERE user_id = ? AND id IN ("
+	urls, err := findBulkURLs(userID, req.IDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to get URLs",
+		})
+		return
+	}
+
+	if len(urls) > 0 && !startCrawls(c, userID, urls) {
+		return
+	}
+	auditURLs(c, audit.URLBulkRerun, urls)
+
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Message: "URLs rerun started",
+		Data:    map[string]int{"rerun_count": len(urls)},
+	})
+}
+
+// startCrawls marks the URLs running and starts crawling them in the
+// background, unless that would take the user over their crawl quotas. It
+// writes the error response and returns false when no crawl was started.
+func startCrawls(c *gin.Context, userID int, urls []models.URL) bool {
+	ids := make([]int, len(urls))
+	for i, url := range urls {
+		ids[i] = url.ID
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to update URL status",
+		})
+		return false
+	}
+	defer tx.Rollback()
+
+	if err := quota.ReserveCrawls(tx, userID, ids); err != nil {
+		writeQuotaError(c, err, "Failed to check crawl quota")
+		return false
+	}
+
+	query := "UPDATE urls SET status = 'running', started_by = ? WHERE id IN (?" + strings.Repeat(",?", len(ids)-1) + ")"
+	args := []interface{}{userID}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	if _, err := tx.Exec(query, args...); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to update URL status",
+		})
+		return false
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to update URL status",
+		})
+		return false
+	}
+
+	// Start crawling in background
+	for _, url := range urls {
+		go crawler.CrawlURL(url.ID, url.URL)
+	}
+	return true
+}
+
+// findBulkURLs returns the URLs among ids in which the user may manage
+// crawls.
+func findBulkURLs(userID int, ids []int) ([]models.URL, error) {
+	query := "SELECT u.id, u.workspace_id, u.url FROM urls u WHERE" + inWorkspacesWith(authz.ManageCrawls) + " AND u.id IN ("
 	args := []interface{}{userID}
 
-	for i, id := range req.IDs {
+	for i, id := range ids {
 		if i > 0 {
 			query += ","
 		}
@@ -382,36 +752,18 @@ func BulkRerunURLs(c *gin.Context) {
 
 	rows, err := database.DB.Query(query, args...)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "Failed to get URLs",
-		})
-		return
+		return nil, err
 	}
 	defer rows.Close()
 
 	var urls []models.URL
 	for rows.Next() {
 		var url models.URL
-		err := rows.Scan(&url.ID, &url.URL)
+		err := rows.Scan(&url.ID, &url.WorkspaceID, &url.URL)
 		if err != nil {
 			continue
 		}
 		urls = append(urls, url)
 	}
-
-	// Update status to running and start crawling
-	for _, url := range urls {
-		_, err = database.DB.Exec("UPDATE urls SET status = 'running' WHERE id = ?", url.ID)
-		if err != nil {
-			continue
-		}
-
-		// Start crawling in background
-		go crawler.CrawlURL(url.ID, url.URL)
-	}
-
-	c.JSON(http.StatusOK, models.SuccessResponse{
-		Message: "URLs rerun started",
-		Data:    map[string]int{"rerun_count": len(urls)},
-	})
+	return urls, rows.Err()
 }
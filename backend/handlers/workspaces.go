@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"webcrawler/audit"
+	"webcrawler/authz"
+	"webcrawler/database"
+	"webcrawler/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const personalWorkspaceName = "Personal"
+
+// createPersonalWorkspace gives a new user their personal organization and
+// its workspace.
+func createPersonalWorkspace(tx *sql.Tx, userID int, username string) error {
+	result, err := tx.Exec("INSERT INTO organizations (name, personal_user_id) VALUES (?, ?)", username, userID)
+	if err != nil {
+		return err
+	}
+	orgID, _ := result.LastInsertId()
+
+	if _, err := tx.Exec("INSERT INTO organization_members (organization_id, user_id, role) VALUES (?, ?, ?)", orgID, userID, authz.RoleAdmin); err != nil {
+		return err
+	}
+	_, err = tx.Exec("INSERT INTO workspaces (organization_id, name) VALUES (?, ?)", orgID, personalWorkspaceName)
+	return err
+}
+
+func personalWorkspaceID(userID int) (int, error) {
+	var id int
+	query := `
+		SELECT w.id FROM workspaces w
+		JOIN organizations o ON o.id = w.organization_id
+		WHERE o.personal_user_id = ?
+		ORDER BY w.id
+		LIMIT 1
+	`
+	err := database.DB.QueryRow(query, userID).Scan(&id)
+	return id, err
+}
+
+// resolveWorkspace returns the requested workspace, or the user's personal
+// workspace when none is requested, and writes the error response unless
+// the user's role there has the permission.
+func resolveWorkspace(c *gin.Context, requested int, permission authz.Permission) (int, bool) {
+	userID := c.GetInt("user_id")
+
+	if requested == 0 {
+		id, err := personalWorkspaceID(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error: "Failed to get workspace",
+			})
+			return 0, false
+		}
+		return id, true
+	}
+
+	role, err := authz.Lookup().WorkspaceRole(userID, requested)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to get workspace",
+		})
+		return 0, false
+	}
+	if role == "" {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "Workspace not found",
+		})
+		return 0, false
+	}
+	if !role.Can(permission) {
+		c.JSON(http.StatusForbidden, models.ErrorResponse{
+			Error: authz.DeniedMessage,
+		})
+		return 0, false
+	}
+	return requested, true
+}
+
+// GetWorkspaces lists the workspaces of every organization the user belongs
+// to, personal workspace first.
+func GetWorkspaces(c *gin.Context) {
+	userID := c.GetInt("user_id")
+
+	query := `
+		SELECT w.id, o.id, o.name, w.name, o.personal_user_id IS NOT NULL, m.role, w.created_at
+		FROM workspaces w
+		JOIN organizations o ON o.id = w.organization_id
+		JOIN organization_members m ON m.organization_id = o.id
+		WHERE m.user_id = ?
+		ORDER BY o.personal_user_id IS NULL, o.name, w.name
+	`
+	rows, err := database.DB.Query(query, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to get workspaces",
+		})
+		return
+	}
+	defer rows.Close()
+
+	workspaces := []models.Workspace{}
+	for rows.Next() {
+		var ws models.Workspace
+		err := rows.Scan(&ws.ID, &ws.OrganizationID, &ws.OrganizationName, &ws.Name, &ws.Personal, &ws.Role, &ws.CreatedAt)
+		if err != nil {
+			continue
+		}
+		workspaces = append(workspaces, ws)
+	}
+
+	c.JSON(http.StatusOK, workspaces)
+}
+
+// CreateWorkspace adds a workspace to an organization.
+func CreateWorkspace(c *gin.Context) {
+	orgID, _ := strconv.Atoi(c.Param("id"))
+
+	var req models.CreateWorkspaceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: err.Error(),
+		})
+		return
+	}
+
+	result, err := database.DB.Exec("INSERT INTO workspaces (organization_id, name) VALUES (?, ?)", orgID, req.Name)
+	if err != nil {
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error: "A workspace with that name already exists",
+		})
+		return
+	}
+
+	id, _ := result.LastInsertId()
+	audit.Record(c, audit.Event{
+		Action:         audit.WorkspaceCreate,
+		TargetType:     audit.TargetWorkspace,
+		TargetIDs:      []int{int(id)},
+		WorkspaceID:    int(id),
+		OrganizationID: orgID,
+		Details:        map[string]interface{}{"name": req.Name},
+	})
+
+	c.JSON(http.StatusCreated, models.SuccessResponse{
+		Message: "Workspace created",
+		Data: models.Workspace{
+			ID:             int(id),
+			OrganizationID: orgID,
+			Name:           req.Name,
+			Role:           string(authz.RoleAdmin),
+		},
+	})
+}
+
+// DeleteWorkspace deletes a workspace with all of its URLs. An organization
+// keeps at least one workspace.
+func DeleteWorkspace(c *gin.Context) {
+	orgID, _ := strconv.Atoi(c.Param("id"))
+	workspaceID, err := strconv.Atoi(c.Param("workspaceId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error: "Invalid workspace ID",
+		})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to delete workspace",
+		})
+		return
+	}
+	defer tx.Rollback()
+
+	var count int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM workspaces WHERE organization_id = ?", orgID).Scan(&count); err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to delete workspace",
+		})
+		return
+	}
+	if count <= 1 {
+		c.JSON(http.StatusConflict, models.ErrorResponse{
+			Error: "An organization needs at least one workspace",
+		})
+		return
+	}
+
+	var name string
+	err = tx.QueryRow("SELECT name FROM workspaces WHERE id = ? AND organization_id = ?", workspaceID, orgID).Scan(&name)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, models.ErrorResponse{
+			Error: "Workspace not found",
+		})
+		return
+	}
+	var urls []models.URL
+	if err == nil {
+		urls, err = lockURLs(tx, "w.id = ?", workspaceID)
+	}
+	if err == nil {
+		_, err = tx.Exec("DELETE FROM workspaces WHERE id = ? AND organization_id = ?", workspaceID, orgID)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to delete workspace",
+		})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:         audit.WorkspaceDelete,
+		TargetType:     audit.TargetWorkspace,
+		TargetIDs:      []int{workspaceID},
+		WorkspaceID:    workspaceID,
+		OrganizationID: orgID,
+		Details:        map[string]interface{}{"name": name},
+	})
+	cancelCrawls(urls)
+	auditURLs(c, audit.URLDelete, urls)
+
+	c.JSON(http.StatusOK, models.SuccessResponse{
+		Message: "Workspace deleted",
+	})
+}
@@ -0,0 +1,87 @@
+// Package mailer sends transactional email such as verification and password
+// reset links. The transport is chosen with MAIL_DRIVER.
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+var (
+	mailer Mailer = logMailer{}
+	from          = "Web Crawler <no-reply@localhost>"
+)
+
+// Init selects the mailer from the environment:
+//
+//	MAIL_DRIVER=smtp  send through MAIL_SMTP_HOST:MAIL_SMTP_PORT (e.g. MailHog)
+//	MAIL_DRIVER=file  write .eml files to MAIL_DIR
+//	MAIL_DRIVER=log   print messages to the server log (default)
+func Init() {
+	if value := os.Getenv("MAIL_FROM"); value != "" {
+		from = value
+	}
+
+	switch driver := os.Getenv("MAIL_DRIVER"); driver {
+	case "smtp":
+		mailer = newSMTPMailer()
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "mail"
+		}
+		mailer = fileMailer{dir: dir}
+	case "", "log":
+		mailer = logMailer{}
+	default:
+		log.Printf("Unknown MAIL_DRIVER %q, logging mail instead", driver)
+		mailer = logMailer{}
+	}
+}
+
+// Use replaces the mailer, e.g. with a fake in tests.
+func Use(m Mailer) {
+	mailer = m
+}
+
+// Send delivers a message with the configured mailer.
+func Send(to, subject, body string) error {
+	return mailer.Send(Message{To: to, Subject: subject, Body: body})
+}
+
+// render formats a message in RFC 5322 form.
+func render(msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// headerSafe rejects values that would let a caller inject extra headers.
+func headerSafe(msg Message) error {
+	if strings.ContainsAny(msg.To, "\r\n") || strings.ContainsAny(msg.Subject, "\r\n") {
+		return fmt.Errorf("invalid characters in mail header")
+	}
+	return nil
+}
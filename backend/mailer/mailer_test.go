@@ -0,0 +1,104 @@
+package mailer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type recorder struct {
+	sent []Message
+}
+
+func (r *recorder) Send(msg Message) error {
+	r.sent = append(r.sent, msg)
+	return nil
+}
+
+func TestUse(t *testing.T) {
+	saved := mailer
+	defer Use(saved)
+
+	r := &recorder{}
+	Use(r)
+	if err := Send("alice@example.com", "Verify your email", "Open the link"); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.sent) != 1 || r.sent[0] != (Message{To: "alice@example.com", Subject: "Verify your email", Body: "Open the link"}) {
+		t.Errorf("sent %+v", r.sent)
+	}
+}
+
+func TestInit(t *testing.T) {
+	defer func(saved Mailer, savedFrom string) { mailer, from = saved, savedFrom }(mailer, from)
+
+	tests := []struct {
+		driver string
+		want   Mailer
+	}{
+		{"", logMailer{}},
+		{"log", logMailer{}},
+		{"file", fileMailer{dir: "mail"}},
+		{"smtp", smtpMailer{addr: "localhost:1025"}},
+		{"carrier-pigeon", logMailer{}},
+	}
+	for _, tt := range tests {
+		t.Setenv("MAIL_DRIVER", tt.driver)
+		Init()
+		if mailer != tt.want {
+			t.Errorf("MAIL_DRIVER=%q: got %#v, want %#v", tt.driver, mailer, tt.want)
+		}
+	}
+
+	t.Setenv("MAIL_FROM", "Crawler <crawler@example.com>")
+	Init()
+	if from != "Crawler <crawler@example.com>" {
+		t.Errorf("from = %q", from)
+	}
+}
+
+func TestHeaderInjection(t *testing.T) {
+	dir := t.TempDir()
+	for _, msg := range []Message{
+		{To: "alice@example.com\r\nBcc: mallory@example.com", Subject: "Hi"},
+		{To: "alice@example.com", Subject: "Hi\nBcc: mallory@example.com"},
+	} {
+		for _, m := range []Mailer{logMailer{}, fileMailer{dir: dir}, smtpMailer{addr: "localhost:0"}} {
+			if err := m.Send(msg); err == nil {
+				t.Errorf("%T sent %q", m, msg)
+			}
+		}
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Errorf("%d files written", len(files))
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	m := fileMailer{dir: filepath.Join(dir, "mail")}
+	if err := m.Send(Message{To: "alice@example.com", Subject: "Reset your password", Body: "Line one\nLine two"}); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "mail", "*-alice_at_example.com.eml"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("files: %v, %v", files, err)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := string(data)
+	for _, want := range []string{
+		"From: " + from + "\r\n",
+		"To: alice@example.com\r\n",
+		"Subject: Reset your password\r\n",
+		"\r\n\r\nLine one\r\nLine two",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("message lacks %q:\n%s", want, text)
+		}
+	}
+}
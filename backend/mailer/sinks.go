@@ -0,0 +1,78 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// smtpMailer sends through an SMTP server. Authentication is only used when
+// MAIL_SMTP_USERNAME is set, which local stand-ins like MailHog do not need.
+type smtpMailer struct {
+	addr string
+	auth smtp.Auth
+}
+
+func newSMTPMailer() smtpMailer {
+	host := os.Getenv("MAIL_SMTP_HOST")
+	if host == "" {
+		host = "localhost"
+	}
+	port := os.Getenv("MAIL_SMTP_PORT")
+	if port == "" {
+		port = "1025"
+	}
+
+	m := smtpMailer{addr: net.JoinHostPort(host, port)}
+	if username := os.Getenv("MAIL_SMTP_USERNAME"); username != "" {
+		m.auth = smtp.PlainAuth("", username, os.Getenv("MAIL_SMTP_PASSWORD"), host)
+	}
+	return m
+}
+
+func (m smtpMailer) Send(msg Message) error {
+	if err := headerSafe(msg); err != nil {
+		return err
+	}
+
+	sender, err := mail.ParseAddress(from)
+	if err != nil {
+		return fmt.Errorf("invalid MAIL_FROM: %v", err)
+	}
+	return smtp.SendMail(m.addr, m.auth, sender.Address, []string{msg.To}, render(msg))
+}
+
+// logMailer prints messages to the server log, for development.
+type logMailer struct{}
+
+func (logMailer) Send(msg Message) error {
+	if err := headerSafe(msg); err != nil {
+		return err
+	}
+	log.Printf("Mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// fileMailer writes each message to its own .eml file, for development.
+type fileMailer struct {
+	dir string
+}
+
+func (m fileMailer) Send(msg Message) error {
+	if err := headerSafe(msg); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(m.dir, 0o750); err != nil {
+		return err
+	}
+
+	recipient := strings.NewReplacer("@", "_at_", "/", "_", "\\", "_").Replace(msg.To)
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405.000000000"), recipient)
+	return os.WriteFile(filepath.Join(m.dir, name), render(msg), 0o640)
+}
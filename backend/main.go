@@ -4,10 +4,17 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strings"
 
+	"webcrawler/authz"
+	"webcrawler/crawler"
 	"webcrawler/database"
 	"webcrawler/handlers"
+	"webcrawler/mailer"
 	"webcrawler/middleware"
+	"webcrawler/oidc"
+	"webcrawler/secrets"
+	"webcrawler/tokens"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -23,14 +30,66 @@ func main() {
 	// Initialize database
 	database.InitDB()
 
+	// Load the key for crawl profile secrets
+	secrets.Init()
+
+	// Initialize crawler configuration
+	crawler.Init()
+
+	// Crawls cut short by the last shutdown are no longer running
+	crawler.ResetInterrupted()
+
+	// Encrypt crawl profile secrets stored in plaintext by older versions
+	crawler.SealStoredProfiles()
+
+	// Initialize single sign-on
+	oidc.Init()
+
+	// Initialize outgoing mail
+	mailer.Init()
+
+	// Create or promote the administrator named in the environment
+	handlers.BootstrapAdmin()
+
 	// Initialize Gin router
+	r := setupRouter(middleware.AuthMiddleware())
+
+	// Start server
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+
+	log.Printf("Server starting on port %s", port)
+	if err := r.Run(":" + port); err != nil {
+		log.Fatal("Failed to start server:", err)
+	}
+}
+
+// setupRouter registers every route. authenticate identifies the caller on
+// the protected routes.
+func setupRouter(authenticate gin.HandlerFunc) *gin.Engine {
 	r := gin.Default()
 
+	// Only believe X-Forwarded-For from our own proxies; login throttling
+	// keys on the client IP
+	trustedProxies := []string{"127.0.0.1", "::1", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16"}
+	if value := os.Getenv("TRUSTED_PROXIES"); value != "" {
+		trustedProxies = strings.Split(value, ",")
+	}
+	if err := r.SetTrustedProxies(trustedProxies); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
+
+	// Tag every request for the logs and the audit trail
+	r.Use(middleware.RequestID())
+
 	// CORS configuration
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:5173", "http://localhost:5174", "http://localhost:3000"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "X-API-Key", "X-Request-ID"},
+		ExposeHeaders:    []string{"X-Request-ID", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", "Retry-After"},
 		AllowCredentials: true,
 	}))
 
@@ -42,41 +101,142 @@ func main() {
 	// API routes
 	api := r.Group("/api")
 
+	// Limit requests per client. Logins are limited by IP; everything else
+	// after authentication, by user or API key
+	limit := middleware.RateLimit()
+
 	// Auth routes
-	auth := api.Group("/auth")
+	auth := api.Group("/auth", limit)
 	{
 		auth.POST("/login", handlers.Login)
 		auth.POST("/register", handlers.Register)
+		auth.POST("/refresh", handlers.RefreshToken)
+
+		// Account recovery and email verification
+		auth.POST("/forgot-password", handlers.ForgotPassword)
+		auth.POST("/reset-password", handlers.ResetPassword)
+		auth.POST("/verify-email", handlers.VerifyEmail)
+
+		// Single sign-on
+		auth.GET("/oidc", handlers.GetSSOConfig)
+		auth.GET("/oidc/login", handlers.SSOLogin)
+		auth.GET("/oidc/callback", handlers.SSOCallback)
+		auth.POST("/oidc/exchange", handlers.SSOExchange)
+
+		// Second login step for users with two-factor authentication
+		auth.POST("/2fa/login", handlers.LoginTwoFactor)
 	}
 
 	// Protected routes
 	protected := api.Group("/")
-	protected.Use(middleware.AuthMiddleware())
+	protected.Use(authenticate, limit)
 	{
+		// Sessions
+		session := middleware.RequireSession()
+		protected.POST("/auth/logout", session, handlers.Logout)
+		protected.POST("/auth/logout-all", session, handlers.LogoutAll)
+		protected.POST("/auth/resend-verification", session, handlers.ResendVerification)
+
+		// Two-factor authentication
+		twoFactor := protected.Group("/auth/2fa", session)
+		{
+			twoFactor.GET("", handlers.GetTwoFactorStatus)
+			twoFactor.POST("/enroll", handlers.EnrollTwoFactor)
+			twoFactor.POST("/verify", handlers.VerifyTwoFactor)
+			twoFactor.POST("/disable", handlers.DisableTwoFactor)
+			twoFactor.POST("/recovery-codes", handlers.RegenerateRecoveryCodes)
+		}
+
+		// Account
+		me := protected.Group("/me", session)
+		{
+			me.GET("", handlers.GetMe)
+			me.PUT("", handlers.UpdateMe)
+			me.DELETE("", handlers.DeleteMe)
+			me.PUT("/password", handlers.ChangePassword)
+			me.GET("/export", handlers.ExportMe)
+			me.GET("/quota", handlers.GetQuota)
+		}
+
+		// API keys
+		keys := protected.Group("/keys", session)
+		{
+			keys.GET("", handlers.GetAPIKeys)
+			keys.POST("", handlers.CreateAPIKey)
+			keys.DELETE("/:id", handlers.RevokeAPIKey)
+		}
+
+		readURLs := middleware.RequireScope(tokens.ScopeURLsRead)
+		writeURLs := middleware.RequireScope(tokens.ScopeURLsWrite)
+		verified := middleware.RequireVerifiedEmail()
+
+		// Workspace roles
+		viewURL := middleware.Authorize(authz.ViewURLs, authz.URLParam("id"))
+		manageURL := middleware.Authorize(authz.ManageCrawls, authz.URLParam("id"))
+		viewAnyWorkspace := middleware.Authorize(authz.ViewURLs, authz.AnyWorkspace)
+		manageAnyWorkspace := middleware.Authorize(authz.ManageCrawls, authz.AnyWorkspace)
+
 		urls := protected.Group("/urls")
 		{
-			urls.GET("", handlers.GetURLs)
-			urls.POST("", handlers.CreateURL)
-			urls.GET("/:id", handlers.GetURL)
-			urls.PUT("/:id/start", handlers.StartCrawling)
-			urls.PUT("/:id/stop", handlers.StopCrawling)
-			urls.DELETE("/:id", handlers.DeleteURL)
-			urls.GET("/:id/results", handlers.GetResults)
+			urls.GET("", readURLs, middleware.Authorize(authz.ViewURLs, authz.WorkspaceQuery("workspace_id")), handlers.GetURLs)
+			urls.POST("", writeURLs, manageAnyWorkspace, handlers.CreateURL)
+			urls.GET("/:id", readURLs, viewURL, handlers.GetURL)
+			urls.PUT("/:id/start", writeURLs, verified, manageURL, handlers.StartCrawling)
+			urls.PUT("/:id/stop", writeURLs, manageURL, handlers.StopCrawling)
+			urls.DELETE("/:id", writeURLs, manageURL, handlers.DeleteURL)
+			urls.GET("/:id/results", readURLs, viewURL, handlers.GetResults)
 		}
 
+		protected.GET("/workspaces", readURLs, viewAnyWorkspace, handlers.GetWorkspaces)
+
+		// Organizations, their members and workspaces
+		orgs := protected.Group("/orgs", session)
+		{
+			viewOrg := middleware.Authorize(authz.ViewOrg, authz.OrgParam("id"))
+			manageOrg := middleware.Authorize(authz.ManageOrg, authz.OrgParam("id"))
+
+			orgs.GET("", handlers.GetOrganizations)
+			orgs.POST("", handlers.CreateOrganization)
+			orgs.DELETE("/:id", manageOrg, handlers.DeleteOrganization)
+			orgs.POST("/:id/leave", viewOrg, handlers.LeaveOrganization)
+			orgs.GET("/:id/members", viewOrg, handlers.GetMembers)
+			orgs.PUT("/:id/members/:userId", manageOrg, handlers.UpdateMember)
+			orgs.DELETE("/:id/members/:userId", manageOrg, handlers.RemoveMember)
+			orgs.GET("/:id/invites", manageOrg, handlers.GetInvites)
+			orgs.POST("/:id/invites", manageOrg, handlers.CreateInvite)
+			orgs.DELETE("/:id/invites/:inviteId", manageOrg, handlers.RevokeInvite)
+			orgs.POST("/:id/workspaces", manageOrg, handlers.CreateWorkspace)
+			orgs.DELETE("/:id/workspaces/:workspaceId", manageOrg, handlers.DeleteWorkspace)
+		}
+		protected.POST("/invites/accept", session, handlers.AcceptInvite)
+
+		// Audit log
+		protected.GET("/audit", session, handlers.GetAuditEvents)
+
+		// Default crawl profile
+		protected.GET("/settings/crawl-profile", middleware.RequireScope(tokens.ScopeSettingsRead), handlers.GetCrawlProfile)
+		protected.PUT("/settings/crawl-profile", middleware.RequireScope(tokens.ScopeSettingsWrite), handlers.UpdateCrawlProfile)
+
 		// Bulk actions
-		protected.POST("/bulk/delete", handlers.BulkDeleteURLs)
-		protected.POST("/bulk/rerun", handlers.BulkRerunURLs)
-	}
+		protected.POST("/bulk/delete", writeURLs, manageAnyWorkspace, handlers.BulkDeleteURLs)
+		protected.POST("/bulk/rerun", writeURLs, verified, manageAnyWorkspace, handlers.BulkRerunURLs)
 
-	// Start server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+		// Administration
+		admin := protected.Group("/admin", middleware.RequireAdmin())
+		{
+			admin.GET("/login-attempts", handlers.GetLoginAttempts)
+			admin.GET("/users", handlers.GetUsers)
+			admin.POST("/users/:id/unlock", handlers.UnlockUser)
+			admin.POST("/users/:id/disable", handlers.DisableUser)
+			admin.POST("/users/:id/enable", handlers.EnableUser)
+			admin.PUT("/users/:id/plan", handlers.UpdateUserPlan)
+			admin.GET("/usage", handlers.GetUsage)
+			admin.GET("/crawls", handlers.GetCrawlQueue)
+			admin.POST("/crawls/:id/cancel", handlers.CancelCrawl)
+			admin.GET("/limits", handlers.GetCrawlerLimits)
+			admin.PUT("/limits", handlers.UpdateCrawlerLimits)
+		}
 	}
 
-	log.Printf("Server starting on port %s", port)
-	if err := r.Run(":" + port); err != nil {
-		log.Fatal("Failed to start server:", err)
-	}
+	return r
 }
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"webcrawler/authz"
+	"webcrawler/database"
+	"webcrawler/tokens"
+
+	"github.com/gin-gonic/gin"
+)
+
+// access is what a route requires of the caller.
+type access struct {
+	// roles may use the route; nil when the route does not check roles
+	roles []authz.Role
+	// systemAdmin routes are for system administrators only
+	systemAdmin bool
+}
+
+var (
+	open     = access{}
+	viewers  = access{roles: []authz.Role{authz.RoleViewer, authz.RoleEditor, authz.RoleAdmin}}
+	editors  = access{roles: []authz.Role{authz.RoleEditor, authz.RoleAdmin}}
+	admins   = access{roles: []authz.Role{authz.RoleAdmin}}
+	sysAdmin = access{systemAdmin: true}
+)
+
+// routes lists every route with the access it requires. A route missing
+// from here fails the test, so new routes must decide their permissions.
+var routes = map[string]access{
+	"GET /health": open,
+
+	"POST /api/auth/login":               open,
+	"POST /api/auth/register":            open,
+	"POST /api/auth/refresh":             open,
+	"POST /api/auth/forgot-password":     open,
+	"POST /api/auth/reset-password":      open,
+	"POST /api/auth/verify-email":        open,
+	"GET /api/auth/oidc":                 open,
+	"GET /api/auth/oidc/login":           open,
+	"GET /api/auth/oidc/callback":        open,
+	"POST /api/auth/oidc/exchange":       open,
+	"POST /api/auth/2fa/login":           open,
+	"POST /api/auth/logout":              open,
+	"POST /api/auth/logout-all":          open,
+	"POST /api/auth/resend-verification": open,
+
+	"GET /api/auth/2fa":                 open,
+	"POST /api/auth/2fa/enroll":         open,
+	"POST /api/auth/2fa/verify":         open,
+	"POST /api/auth/2fa/disable":        open,
+	"POST /api/auth/2fa/recovery-codes": open,
+
+	"GET /api/me":          open,
+	"PUT /api/me":          open,
+	"DELETE /api/me":       open,
+	"PUT /api/me/password": open,
+	"GET /api/me/export":   open,
+	"GET /api/me/quota":    open,
+
+	"GET /api/keys":        open,
+	"POST /api/keys":       open,
+	"DELETE /api/keys/:id": open,
+
+	"GET /api/urls":             viewers,
+	"POST /api/urls":            editors,
+	"GET /api/urls/:id":         viewers,
+	"PUT /api/urls/:id/start":   editors,
+	"PUT /api/urls/:id/stop":    editors,
+	"DELETE /api/urls/:id":      editors,
+	"GET /api/urls/:id/results": viewers,
+	"GET /api/workspaces":       viewers,
+	"POST /api/bulk/delete":     editors,
+	"POST /api/bulk/rerun":      editors,
+
+	"GET /api/orgs":                                open,
+	"POST /api/orgs":                               open,
+	"DELETE /api/orgs/:id":                         admins,
+	"POST /api/orgs/:id/leave":                     viewers,
+	"GET /api/orgs/:id/members":                    viewers,
+	"PUT /api/orgs/:id/members/:userId":            admins,
+	"DELETE /api/orgs/:id/members/:userId":         admins,
+	"GET /api/orgs/:id/invites":                    admins,
+	"POST /api/orgs/:id/invites":                   admins,
+	"DELETE /api/orgs/:id/invites/:inviteId":       admins,
+	"POST /api/orgs/:id/workspaces":                admins,
+	"DELETE /api/orgs/:id/workspaces/:workspaceId": admins,
+	"POST /api/invites/accept":                     open,
+	"GET /api/audit":                               open,
+	"GET /api/settings/crawl-profile":              open,
+	"PUT /api/settings/crawl-profile":              open,
+	"GET /api/admin/login-attempts":                sysAdmin,
+	"GET /api/admin/users":                         sysAdmin,
+	"POST /api/admin/users/:id/unlock":             sysAdmin,
+	"POST /api/admin/users/:id/disable":            sysAdmin,
+	"POST /api/admin/users/:id/enable":             sysAdmin,
+	"PUT /api/admin/users/:id/plan":                sysAdmin,
+	"GET /api/admin/usage":                         sysAdmin,
+	"GET /api/admin/crawls":                        sysAdmin,
+	"POST /api/admin/crawls/:id/cancel":            sysAdmin,
+	"GET /api/admin/limits":                        sysAdmin,
+	"PUT /api/admin/limits":                        sysAdmin,
+}
+
+// fakeStore gives the user the same role everywhere.
+type fakeStore struct {
+	role        authz.Role
+	systemAdmin bool
+}
+
+func (s fakeStore) OrgRole(userID, orgID int) (authz.Role, error)             { return s.role, nil }
+func (s fakeStore) WorkspaceRole(userID, workspaceID int) (authz.Role, error) { return s.role, nil }
+func (s fakeStore) URLRole(userID, urlID int) (authz.Role, error)             { return s.role, nil }
+func (s fakeStore) HighestRole(userID int) (authz.Role, error)                { return s.role, nil }
+func (s fakeStore) IsSystemAdmin(userID int) (bool, error)                    { return s.systemAdmin, nil }
+
+// offlineDriver fails every query, so handlers that get past the
+// permission checks stop at their first database call.
+type offlineDriver struct{}
+
+func (offlineDriver) Open(name string) (driver.Conn, error) {
+	return nil, errors.New("database offline")
+}
+
+var paramPattern = regexp.MustCompile(`:[A-Za-z]+`)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Setenv("REQUIRE_EMAIL_VERIFICATION", "false")
+	os.Setenv("RATE_LIMIT", "false")
+
+	sql.Register("offline", offlineDriver{})
+	db, _ := sql.Open("offline", "")
+	database.DB = db
+
+	os.Exit(m.Run())
+}
+
+func newTestRouter() *gin.Engine {
+	return setupRouter(func(c *gin.Context) {
+		c.Set("user_id", 1)
+		c.Set("username", "tester")
+		c.Set("token_claims", &tokens.Claims{UserID: 1, Username: "tester"})
+		c.Next()
+	})
+}
+
+func request(r *gin.Engine, method, path string) *httptest.ResponseRecorder {
+	path = paramPattern.ReplaceAllString(path, "1")
+	req := httptest.NewRequest(method, path, strings.NewReader("{}"))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func denied(w *httptest.ResponseRecorder) bool {
+	return w.Code == http.StatusForbidden && strings.Contains(w.Body.String(), authz.DeniedMessage)
+}
+
+func TestEveryRouteHasAccessRule(t *testing.T) {
+	registered := map[string]bool{}
+	for _, route := range newTestRouter().Routes() {
+		key := route.Method + " " + route.Path
+		registered[key] = true
+		if _, ok := routes[key]; !ok {
+			t.Errorf("route %s has no access rule", key)
+		}
+	}
+	for key := range routes {
+		if !registered[key] {
+			t.Errorf("access rule for %s matches no route", key)
+		}
+	}
+}
+
+func TestRouteRoles(t *testing.T) {
+	defer authz.Use(authz.Lookup())
+	r := newTestRouter()
+
+	for _, route := range r.Routes() {
+		rule, ok := routes[route.Method+" "+route.Path]
+		if !ok || rule.systemAdmin {
+			continue
+		}
+
+		for _, role := range authz.Roles {
+			authz.Use(fakeStore{role: role})
+			w := request(r, route.Method, route.Path)
+
+			allowed := rule.roles == nil
+			for _, granted := range rule.roles {
+				allowed = allowed || granted == role
+			}
+			if allowed && denied(w) {
+				t.Errorf("%s %s: %s was denied", route.Method, route.Path, role)
+			}
+			if !allowed && !denied(w) {
+				t.Errorf("%s %s: %s got %d, want %d", route.Method, route.Path, role, w.Code, http.StatusForbidden)
+			}
+		}
+	}
+}
+
+func TestRouteNonMember(t *testing.T) {
+	defer authz.Use(authz.Lookup())
+	authz.Use(fakeStore{})
+	r := newTestRouter()
+
+	for _, route := range r.Routes() {
+		rule, ok := routes[route.Method+" "+route.Path]
+		if !ok || rule.roles == nil {
+			continue
+		}
+
+		w := request(r, route.Method, route.Path)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s %s: non-member got %d, want %d", route.Method, route.Path, w.Code, http.StatusNotFound)
+		}
+	}
+}
+
+func TestRouteSystemAdmin(t *testing.T) {
+	defer authz.Use(authz.Lookup())
+	r := newTestRouter()
+
+	for _, route := range r.Routes() {
+		rule, ok := routes[route.Method+" "+route.Path]
+		if !ok || !rule.systemAdmin {
+			continue
+		}
+
+		for _, role := range authz.Roles {
+			for _, systemAdmin := range []bool{false, true} {
+				authz.Use(fakeStore{role: role, systemAdmin: systemAdmin})
+				w := request(r, route.Method, route.Path)
+
+				if systemAdmin && w.Code == http.StatusForbidden {
+					t.Errorf("%s %s: system admin with role %s got 403: %s", route.Method, route.Path, role, w.Body.String())
+				}
+				if !systemAdmin && w.Code != http.StatusForbidden {
+					t.Errorf("%s %s: %s without system admin got %d, want %d", route.Method, route.Path, role, w.Code, http.StatusForbidden)
+				}
+			}
+		}
+	}
+}
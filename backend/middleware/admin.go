@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"net/http"
+
+	"webcrawler/authz"
+	"webcrawler/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireAdmin limits a route to administrators. Like RequireSession it
+// refuses API keys.
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("token_claims"); !ok {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Error: "This endpoint requires a login session",
+			})
+			c.Abort()
+			return
+		}
+
+		isAdmin, err := authz.Lookup().IsSystemAdmin(c.GetInt("user_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error: "Failed to check permissions",
+			})
+			c.Abort()
+			return
+		}
+		if !isAdmin {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Error: "Administrator access required",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
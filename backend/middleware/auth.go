@@ -2,17 +2,21 @@ package middleware
 
 import (
 	"net/http"
-	"os"
 	"strings"
 
 	"webcrawler/models"
+	"webcrawler/tokens"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 )
 
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if key := c.GetHeader("X-API-Key"); key != "" {
+			authenticateAPIKey(c, key)
+			return
+		}
+
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
@@ -34,16 +38,15 @@ func AuthMiddleware() gin.HandlerFunc {
 		// Extract the token
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
-		// Parse and validate the token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			// Make sure the token method is HMAC
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.ErrSignatureInvalid
-			}
-			return []byte(os.Getenv("JWT_SECRET")), nil
-		})
+		// API keys may also be sent as bearer tokens
+		if strings.HasPrefix(tokenString, tokens.APIKeyPrefix) {
+			authenticateAPIKey(c, tokenString)
+			return
+		}
 
-		if err != nil || !token.Valid {
+		// Parse and validate the token
+		claims, err := tokens.ParseAccessToken(tokenString)
+		if err != nil {
 			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
 				Error: "Invalid token",
 			})
@@ -51,17 +54,80 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// Extract claims
-		if claims, ok := token.Claims.(jwt.MapClaims); ok {
-			userID := int(claims["user_id"].(float64))
-			username := claims["username"].(string)
-
-			// Set user info in context
-			c.Set("user_id", userID)
-			c.Set("username", username)
-		} else {
+		// Reject tokens revoked by logout
+		revoked, err := tokens.IsRevoked(claims)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error: "Failed to check token",
+			})
+			c.Abort()
+			return
+		}
+		if revoked {
 			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
-				Error: "Invalid token claims",
+				Error: "Token has been revoked",
+			})
+			c.Abort()
+			return
+		}
+
+		// Set user info in context
+		c.Set("user_id", claims.UserID)
+		c.Set("username", claims.Username)
+		c.Set("token_claims", claims)
+
+		c.Next()
+	}
+}
+
+func authenticateAPIKey(c *gin.Context, key string) {
+	identity, err := tokens.AuthenticateAPIKey(key)
+	if err == tokens.ErrInvalidAPIKey {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
+			Error: "Invalid API key",
+		})
+		c.Abort()
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+			Error: "Failed to check API key",
+		})
+		c.Abort()
+		return
+	}
+
+	// Set user info in context
+	c.Set("user_id", identity.UserID)
+	c.Set("username", identity.Username)
+	c.Set("api_key", identity)
+
+	c.Next()
+}
+
+// RequireScope limits a route to sessions and API keys granted the scope.
+// Logged-in users have every scope.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if identity, ok := c.Get("api_key"); ok && !identity.(*tokens.APIKeyIdentity).HasScope(scope) {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Error: "API key is missing scope " + scope,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireSession limits a route to logged-in users, e.g. managing API keys
+// or sessions, which API keys may not do.
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("token_claims"); !ok {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Error: "This endpoint requires a login session",
 			})
 			c.Abort()
 			return
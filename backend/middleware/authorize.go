@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"webcrawler/authz"
+	"webcrawler/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Authorize limits a route to users whose role for the target resource has
+// the permission. Resources the user cannot see at all are reported as
+// missing. The role is stored in the context as "role".
+func Authorize(permission authz.Permission, target authz.Target) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, err := target.Role(c, c.GetInt("user_id"))
+		if errors.Is(err, authz.ErrInvalidID) {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{
+				Error: "Invalid " + target.Noun + " ID",
+			})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error: "Failed to check permissions",
+			})
+			c.Abort()
+			return
+		}
+		if role == "" {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{
+				Error: target.Noun + " not found",
+			})
+			c.Abort()
+			return
+		}
+		if !role.Can(permission) {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Error: authz.DeniedMessage,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Set("role", role)
+		c.Next()
+	}
+}
@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"webcrawler/models"
+	"webcrawler/tokens"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bucket holds the tokens left for one client. It refills continuously and
+// each request takes one token.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type rateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	limit     int     // requests per minute, as advertised
+	rate      float64 // tokens per second
+	burst     float64
+	lastPrune time.Time
+}
+
+// RateLimit limits each client to RATE_LIMIT_PER_MINUTE requests a minute,
+// with bursts of up to RATE_LIMIT_BURST. Clients are told apart by API key,
+// then by logged-in user, then by IP address, so it must run after
+// authentication to count users separately. Every response carries the
+// X-RateLimit-* headers; refused requests also get Retry-After. Set
+// RATE_LIMIT=false to turn limiting off.
+//
+// Buckets live in memory, so each server process counts separately.
+func RateLimit() gin.HandlerFunc {
+	if os.Getenv("RATE_LIMIT") == "false" {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+
+	perMinute := envInt("RATE_LIMIT_PER_MINUTE", 120)
+	limiter := &rateLimiter{
+		buckets: make(map[string]*bucket),
+		limit:   perMinute,
+		rate:    float64(perMinute) / 60,
+		burst:   float64(envInt("RATE_LIMIT_BURST", 60)),
+	}
+
+	return func(c *gin.Context) {
+		remaining, wait, ok := limiter.take(clientKey(c), time.Now())
+
+		c.Header("X-RateLimit-Limit", strconv.Itoa(limiter.limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(int(remaining)))
+		c.Header("X-RateLimit-Reset", strconv.Itoa(limiter.secondsUntilFull(remaining)))
+
+		if !ok {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, models.ErrorResponse{
+				Error: "Too many requests, please slow down",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// clientKey names the bucket a request draws from.
+func clientKey(c *gin.Context) string {
+	if identity, ok := c.Get("api_key"); ok {
+		return "key:" + strconv.Itoa(identity.(*tokens.APIKeyIdentity).KeyID)
+	}
+	if userID := c.GetInt("user_id"); userID != 0 {
+		return "user:" + strconv.Itoa(userID)
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// take draws a token from the client's bucket. It returns the tokens left
+// and, when the bucket is empty, how long until the next token.
+func (l *rateLimiter) take(key string, now time.Time) (remaining float64, wait time.Duration, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.prune(now)
+
+	b, found := l.buckets[key]
+	if !found {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait = time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return b.tokens, wait, false
+	}
+	b.tokens--
+	return b.tokens, 0, true
+}
+
+// prune drops buckets that have refilled completely, about once a minute.
+func (l *rateLimiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < time.Minute {
+		return
+	}
+	l.lastPrune = now
+
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func (l *rateLimiter) secondsUntilFull(remaining float64) int {
+	return int(math.Ceil((l.burst - remaining) / l.rate))
+}
+
+func envInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		log.Printf("Invalid value for %s: %q, using %d", key, value, fallback)
+		return fallback
+	}
+	return n
+}
@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTake(t *testing.T) {
+	// 60 a minute is one token a second, with bursts of 3
+	l := &rateLimiter{buckets: make(map[string]*bucket), rate: 1, burst: 3}
+	start := time.Now()
+
+	for i, want := range []float64{2, 1, 0} {
+		remaining, _, ok := l.take("a", start)
+		if !ok || remaining != want {
+			t.Fatalf("request %d: got (%v, %v), want (%v, true)", i+1, remaining, ok, want)
+		}
+	}
+
+	_, wait, ok := l.take("a", start.Add(250*time.Millisecond))
+	if ok {
+		t.Fatal("request beyond the burst allowed")
+	}
+	if wait != 750*time.Millisecond {
+		t.Errorf("wait %v, want 750ms", wait)
+	}
+
+	// Other clients have their own bucket
+	if _, _, ok := l.take("b", start); !ok {
+		t.Error("second client refused")
+	}
+
+	// One token has refilled after a second
+	if _, _, ok := l.take("a", start.Add(time.Second)); !ok {
+		t.Error("refilled token refused")
+	}
+	if _, _, ok := l.take("a", start.Add(time.Second)); ok {
+		t.Error("request allowed before the next token")
+	}
+
+	// Buckets never fill beyond the burst
+	remaining, _, _ := l.take("a", start.Add(time.Hour))
+	if remaining != 2 {
+		t.Errorf("remaining %v after a long pause, want 2", remaining)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	l := &rateLimiter{buckets: make(map[string]*bucket), rate: 1, burst: 3}
+	start := time.Now()
+	l.take("idle", start)
+	l.take("busy", start)
+
+	// After a minute the idle bucket is full again and dropped
+	for i := 0; i < 3; i++ {
+		l.take("busy", start.Add(time.Minute))
+	}
+	if _, found := l.buckets["idle"]; found {
+		t.Error("full bucket kept")
+	}
+	if _, found := l.buckets["busy"]; !found {
+		t.Error("bucket in use dropped")
+	}
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("RATE_LIMIT", "")
+	t.Setenv("RATE_LIMIT_PER_MINUTE", "30")
+	t.Setenv("RATE_LIMIT_BURST", "2")
+
+	router := gin.New()
+	router.Use(RateLimit())
+	router.GET("/", func(c *gin.Context) {})
+
+	var codes []int
+	var last *httptest.ResponseRecorder
+	for i := 0; i < 3; i++ {
+		last = httptest.NewRecorder()
+		router.ServeHTTP(last, httptest.NewRequest(http.MethodGet, "/", nil))
+		codes = append(codes, last.Code)
+	}
+
+	if codes[0] != http.StatusOK || codes[1] != http.StatusOK || codes[2] != http.StatusTooManyRequests {
+		t.Errorf("status codes %v", codes)
+	}
+	if got := last.Header().Get("X-RateLimit-Limit"); got != "30" {
+		t.Errorf("X-RateLimit-Limit %q, want the per-minute limit 30", got)
+	}
+	if got := last.Header().Get("X-RateLimit-Remaining"); got != "0" {
+		t.Errorf("X-RateLimit-Remaining %q, want 0", got)
+	}
+	if got := last.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After %q, want 2", got)
+	}
+}
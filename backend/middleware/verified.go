@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+	"os"
+
+	"webcrawler/database"
+	"webcrawler/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireVerifiedEmail limits a route to users who confirmed their email
+// address. Set REQUIRE_EMAIL_VERIFICATION=false to turn the check off.
+func RequireVerifiedEmail() gin.HandlerFunc {
+	enabled := os.Getenv("REQUIRE_EMAIL_VERIFICATION") != "false"
+
+	return func(c *gin.Context) {
+		if !enabled {
+			c.Next()
+			return
+		}
+
+		var verified bool
+		query := "SELECT email_verified_at IS NOT NULL FROM users WHERE id = ?"
+		if err := database.DB.QueryRow(query, c.GetInt("user_id")).Scan(&verified); err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
+				Error: "Failed to check email verification",
+			})
+			c.Abort()
+			return
+		}
+		if !verified {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{
+				Error: "Please verify your email address before crawling",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
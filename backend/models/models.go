@@ -14,33 +14,97 @@ type User struct {
 }
 
 type URL struct {
-	ID        int          `json:"id"`
-	UserID    int          `json:"user_id"`
-	URL       string       `json:"url"`
-	Status    string       `json:"status"`
-	CreatedAt time.Time    `json:"created_at"`
-	UpdatedAt time.Time    `json:"updated_at"`
-	Result    *CrawlResult `json:"result,omitempty"`
+	ID          int           `json:"id"`
+	UserID      int           `json:"user_id"`
+	WorkspaceID int           `json:"workspace_id"`
+	URL         string        `json:"url"`
+	Status      string        `json:"status"`
+	Profile     *CrawlProfile `json:"profile,omitempty"`
+	CreatedAt   time.Time     `json:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+	Result      *CrawlResult  `json:"result,omitempty"`
+}
+
+// CrawlProfile controls how the crawler fetches a URL. Zero values fall back
+// to the default profile of the user running the crawl and then to the
+// crawler defaults.
+type CrawlProfile struct {
+	UserAgent    string            `json:"user_agent,omitempty" binding:"max=512"`
+	Headers      map[string]string `json:"headers,omitempty"`
+	Cookies      []Cookie          `json:"cookies,omitempty" binding:"dive"`
+	BasicAuth    *BasicAuth        `json:"basic_auth,omitempty"`
+	Login        *FormLogin        `json:"login,omitempty"`
+	Proxy        *ProxySettings    `json:"proxy,omitempty"`
+	PageTimeout  int               `json:"page_timeout,omitempty" binding:"min=0,max=300"`
+	LinkTimeout  int               `json:"link_timeout,omitempty" binding:"min=0,max=120"`
+	MaxRedirects *int              `json:"max_redirects,omitempty" binding:"omitempty,min=0,max=20"`
+}
+
+type Cookie struct {
+	Name  string `json:"name" binding:"required"`
+	Value string `json:"value"`
+}
+
+type BasicAuth struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password,omitempty"`
+}
+
+// ProxySettings route a crawl through its own proxies instead of the global
+// ones. Requests rotate across URLs; Direct bypasses proxies entirely.
+type ProxySettings struct {
+	URLs     []string `json:"urls,omitempty" binding:"dive,url"`
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+	NoProxy  []string `json:"no_proxy,omitempty"`
+	Direct   bool     `json:"direct,omitempty"`
+}
+
+// FormLogin describes how to sign in through a site's login form before
+// crawling. Field names are detected from the form when left empty.
+type FormLogin struct {
+	LoginURL      string `json:"login_url" binding:"required,url"`
+	Username      string `json:"username" binding:"required"`
+	Password      string `json:"password,omitempty"`
+	UsernameField string `json:"username_field,omitempty"`
+	PasswordField string `json:"password_field,omitempty"`
+	SuccessText   string `json:"success_text,omitempty"`
 }
 
 type CrawlResult struct {
-	ID                int          `json:"id"`
-	URLID             int          `json:"url_id"`
-	Title             string       `json:"title"`
-	HTMLVersion       string       `json:"html_version"`
-	H1Count           int          `json:"h1_count"`
-	H2Count           int          `json:"h2_count"`
-	H3Count           int          `json:"h3_count"`
-	H4Count           int          `json:"h4_count"`
-	H5Count           int          `json:"h5_count"`
-	H6Count           int          `json:"h6_count"`
-	InternalLinks     int          `json:"internal_links"`
-	ExternalLinks     int          `json:"external_links"`
-	InaccessibleLinks int          `json:"inaccessible_links"`
-	HasLoginForm      bool         `json:"has_login_form"`
-	CreatedAt         time.Time    `json:"created_at"`
-	UpdatedAt         time.Time    `json:"updated_at"`
-	BrokenLinks       []BrokenLink `json:"broken_links,omitempty"`
+	ID                int             `json:"id"`
+	URLID             int             `json:"url_id"`
+	Title             string          `json:"title"`
+	HTMLVersion       string          `json:"html_version"`
+	H1Count           int             `json:"h1_count"`
+	H2Count           int             `json:"h2_count"`
+	H3Count           int             `json:"h3_count"`
+	H4Count           int             `json:"h4_count"`
+	H5Count           int             `json:"h5_count"`
+	H6Count           int             `json:"h6_count"`
+	InternalLinks     int             `json:"internal_links"`
+	ExternalLinks     int             `json:"external_links"`
+	InaccessibleLinks int             `json:"inaccessible_links"`
+	HasLoginForm      bool            `json:"has_login_form"`
+	Outcome           string          `json:"outcome"`
+	ContentType       string          `json:"content_type"`
+	ContentLength     int64           `json:"content_length"`
+	Truncated         bool            `json:"truncated"`
+	Encoding          string          `json:"encoding"`
+	TTFBMs            int             `json:"ttfb_ms"`
+	DownloadMs        int             `json:"download_ms"`
+	HTMLBytes         int64           `json:"html_bytes"`
+	HTMLTransferBytes int64           `json:"html_transfer_bytes"`
+	Compression       string          `json:"compression"`
+	SubresourceCount  int             `json:"subresource_count"`
+	SubresourceBytes  int64           `json:"subresource_bytes"`
+	OverBudget        bool            `json:"over_budget"`
+	BudgetViolations  []string        `json:"budget_violations"`
+	CreatedAt         time.Time       `json:"created_at"`
+	UpdatedAt         time.Time       `json:"updated_at"`
+	BrokenLinks       []BrokenLink    `json:"broken_links,omitempty"`
+	Forms             []Form          `json:"forms,omitempty"`
+	Timings           []RequestTiming `json:"timings,omitempty"`
 }
 
 type BrokenLink struct {
@@ -49,9 +113,51 @@ type BrokenLink struct {
 	URL          string    `json:"url"`
 	StatusCode   int       `json:"status_code"`
 	ErrorMessage string    `json:"error_message"`
+	Kind         string    `json:"kind"`
+	Attempts     int       `json:"attempts"`
+	ErrorClass   string    `json:"error_class"`
 	CreatedAt    time.Time `json:"created_at"`
 }
 
+// Form is one form found on a crawled page, classified by the crawler as
+// login, signup, search, newsletter, payment or other.
+type Form struct {
+	ID             int         `json:"id"`
+	ResultID       int         `json:"result_id"`
+	Action         string      `json:"action"`
+	Method         string      `json:"method"`
+	Kind           string      `json:"kind"`
+	Confidence     float64     `json:"confidence"`
+	Fields         []FormField `json:"fields"`
+	HasCSRFToken   bool        `json:"has_csrf_token"`
+	InsecureSubmit bool        `json:"insecure_submit"`
+	CreatedAt      time.Time   `json:"created_at"`
+}
+
+// RequestTiming breaks down one HTTP request made during a crawl, in
+// milliseconds. Phases skipped on a reused connection are zero.
+type RequestTiming struct {
+	ID         int       `json:"id"`
+	ResultID   int       `json:"result_id"`
+	URL        string    `json:"url"`
+	Method     string    `json:"method"`
+	StatusCode int       `json:"status_code"`
+	DNSMs      int       `json:"dns_ms"`
+	ConnectMs  int       `json:"connect_ms"`
+	TLSMs      int       `json:"tls_ms"`
+	TTFBMs     int       `json:"ttfb_ms"`
+	TotalMs    int       `json:"total_ms"`
+	Reused     bool      `json:"reused"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type FormField struct {
+	Name         string `json:"name"`
+	Type         string `json:"type"`
+	Autocomplete string `json:"autocomplete,omitempty"`
+	Required     bool   `json:"required"`
+}
+
 type LoginRequest struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
@@ -60,11 +166,15 @@ type LoginRequest struct {
 type RegisterRequest struct {
 	Username string `json:"username" binding:"required"`
 	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=6"`
+	Password string `json:"password" binding:"required"`
 }
 
+// URLRequest adds a URL to a workspace, the user's personal workspace when
+// WorkspaceID is not set.
 type URLRequest struct {
-	URL string `json:"url" binding:"required,url"`
+	URL         string        `json:"url" binding:"required,url"`
+	WorkspaceID int           `json:"workspace_id"`
+	Profile     *CrawlProfile `json:"profile"`
 }
 
 type BulkRequest struct {
@@ -72,14 +182,329 @@ type BulkRequest struct {
 }
 
 type AuthResponse struct {
-	Token string `json:"token"`
-	User  User   `json:"user"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	User         User   `json:"user"`
+}
+
+// TwoFactorChallengeResponse is returned by Login instead of tokens when the
+// user has two-factor authentication enabled.
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+	ExpiresIn         int    `json:"expires_in"`
+}
+
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type TwoFactorStatus struct {
+	Enabled                bool `json:"enabled"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+}
+
+type TwoFactorEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type EmailTokenRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type LoginAttempt struct {
+	ID        int       `json:"id"`
+	Username  string    `json:"username"`
+	UserID    *int      `json:"user_id,omitempty"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Success   bool      `json:"success"`
+	Reason    string    `json:"reason"`
+	Cleared   bool      `json:"cleared"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AdminUser is a user as listed for system administrators.
+type AdminUser struct {
+	ID            int        `json:"id"`
+	Username      string     `json:"username"`
+	Email         string     `json:"email"`
+	EmailVerified bool       `json:"email_verified"`
+	IsAdmin       bool       `json:"is_admin"`
+	TOTPEnabled   bool       `json:"totp_enabled"`
+	Plan          string     `json:"plan"`
+	DisabledAt    *time.Time `json:"disabled_at,omitempty"`
+	LastLoginAt   *time.Time `json:"last_login_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// UserUsage sums up what a user has stored and crawled. URLs count those the
+// user added, in any workspace.
+type UserUsage struct {
+	UserID        int    `json:"user_id"`
+	Username      string `json:"username"`
+	URLs          int    `json:"urls"`
+	Running       int    `json:"running"`
+	Completed     int    `json:"completed"`
+	Failed        int    `json:"failed"`
+	APIKeys       int    `json:"api_keys"`
+	Organizations int    `json:"organizations"`
+}
+
+// ActiveCrawl is a crawl waiting for a slot or running on this server.
+type ActiveCrawl struct {
+	URLID     int        `json:"url_id"`
+	URL       string     `json:"url"`
+	State     string     `json:"state"`
+	QueuedAt  time.Time  `json:"queued_at"`
+	StartedAt *time.Time `json:"started_at,omitempty"`
+}
+
+// CrawlQueue is the state of the crawl queue. Statuses counts URLs by their
+// stored status across all users.
+type CrawlQueue struct {
+	MaxConcurrentCrawls int            `json:"max_concurrent_crawls"`
+	Running             int            `json:"running"`
+	Waiting             int            `json:"waiting"`
+	Crawls              []ActiveCrawl  `json:"crawls"`
+	Statuses            map[string]int `json:"statuses"`
+}
+
+// CrawlerLimits are the crawler settings administrators can change while the
+// server runs. They reset to the environment's values on restart.
+type CrawlerLimits struct {
+	MaxConcurrentCrawls int   `json:"max_concurrent_crawls"`
+	MaxBodyBytes        int64 `json:"max_body_bytes"`
+	RetryAttempts       int   `json:"retry_attempts"`
+}
+
+// UpdateCrawlerLimitsRequest changes the limits that are set.
+type UpdateCrawlerLimitsRequest struct {
+	MaxConcurrentCrawls *int   `json:"max_concurrent_crawls" binding:"omitempty,min=1,max=1000"`
+	MaxBodyBytes        *int64 `json:"max_body_bytes" binding:"omitempty,min=1024"`
+	RetryAttempts       *int   `json:"retry_attempts" binding:"omitempty,min=1,max=10"`
+}
+
+// Quota is a user's plan limits next to what they use of them. A limit of
+// 0 means unlimited. Crawls are counted over the last 24 hours.
+type Quota struct {
+	Plan                string `json:"plan"`
+	MaxURLs             int    `json:"max_urls"`
+	MaxCrawlsPerDay     int    `json:"max_crawls_per_day"`
+	MaxConcurrentCrawls int    `json:"max_concurrent_crawls"`
+	URLs                int    `json:"urls"`
+	CrawlsToday         int    `json:"crawls_today"`
+	RunningCrawls       int    `json:"running_crawls"`
+}
+
+// UpdatePlanRequest moves a user to another plan.
+type UpdatePlanRequest struct {
+	Plan string `json:"plan" binding:"required"`
+}
+
+// AuditEvent is an action recorded in the audit log. ActorID is missing for
+// failed logins to unknown usernames.
+type AuditEvent struct {
+	ID             int64                  `json:"id"`
+	ActorID        *int                   `json:"actor_id,omitempty"`
+	Actor          string                 `json:"actor"`
+	APIKeyID       *int                   `json:"api_key_id,omitempty"`
+	Action         string                 `json:"action"`
+	TargetType     string                 `json:"target_type,omitempty"`
+	TargetIDs      []int                  `json:"target_ids,omitempty"`
+	WorkspaceID    *int                   `json:"workspace_id,omitempty"`
+	OrganizationID *int                   `json:"organization_id,omitempty"`
+	Details        map[string]interface{} `json:"details,omitempty"`
+	IP             string                 `json:"ip"`
+	UserAgent      string                 `json:"user_agent"`
+	RequestID      string                 `json:"request_id"`
+	CreatedAt      time.Time              `json:"created_at"`
+}
+
+// Profile is the current user's account as returned by /api/me.
+type Profile struct {
+	ID               int       `json:"id"`
+	Username         string    `json:"username"`
+	Email            string    `json:"email"`
+	EmailVerified    bool      `json:"email_verified"`
+	TwoFactorEnabled bool      `json:"two_factor_enabled"`
+	HasPassword      bool      `json:"has_password"`
+	SSOLinked        bool      `json:"sso_linked"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// UpdateProfileRequest changes the fields that are set. Changing the email
+// address requires the current password, if the account has one.
+type UpdateProfileRequest struct {
+	Username        *string `json:"username" binding:"omitempty,min=1,max=50"`
+	Email           *string `json:"email" binding:"omitempty,email,max=100"`
+	CurrentPassword string  `json:"current_password"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// DeleteAccountRequest confirms deletion with the password, or with the
+// username for accounts that only sign in through SSO. Code is required when
+// two-factor authentication is enabled.
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+	Username string `json:"username"`
+	Code     string `json:"code"`
+}
+
+// AccountExport is everything stored about a user, as downloaded from
+// /api/me/export. Stored crawl credentials are left out.
+type AccountExport struct {
+	ExportedAt    time.Time      `json:"exported_at"`
+	Profile       Profile        `json:"profile"`
+	CrawlProfile  *CrawlProfile  `json:"crawl_profile,omitempty"`
+	URLs          []URL          `json:"urls"`
+	APIKeys       []APIKey       `json:"api_keys"`
+	LoginAttempts []LoginAttempt `json:"login_attempts"`
+}
+
+// Organization is an organization the current user belongs to, with their
+// role in it. Personal organizations have a single member and cannot invite
+// others.
+type Organization struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Personal  bool      `json:"personal"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Workspace struct {
+	ID               int       `json:"id"`
+	OrganizationID   int       `json:"organization_id"`
+	OrganizationName string    `json:"organization_name"`
+	Name             string    `json:"name"`
+	Personal         bool      `json:"personal"`
+	Role             string    `json:"role"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+type Member struct {
+	UserID    int       `json:"user_id"`
+	Username  string    `json:"username"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Invite struct {
+	ID        int       `json:"id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	InvitedBy string    `json:"invited_by,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type CreateOrganizationRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+type CreateWorkspaceRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+type InviteRequest struct {
+	Email string `json:"email" binding:"required,email,max=100"`
+	Role  string `json:"role" binding:"omitempty,oneof=viewer editor admin"`
+}
+
+type UpdateMemberRequest struct {
+	Role string `json:"role" binding:"required,oneof=viewer editor admin"`
+}
+
+type AcceptInviteRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type SSOConfigResponse struct {
+	Enabled bool `json:"enabled"`
+}
+
+type SSOExchangeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type APIKey struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type APIKeyRequest struct {
+	Name      string     `json:"name" binding:"required,max=100"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1,dive,oneof=urls:read urls:write settings:read settings:write"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// CreatedAPIKeyResponse carries the plaintext key, which is only returned
+// when the key is created.
+type CreatedAPIKeyResponse struct {
+	APIKey
+	Key string `json:"key"`
 }
 
 type ErrorResponse struct {
 	Error string `json:"error"`
 }
 
+// LastAdminResponse lists the organizations a user must hand off to another
+// admin before deleting their account.
+type LastAdminResponse struct {
+	Error         string         `json:"error"`
+	Organizations []Organization `json:"organizations"`
+}
+
+type DuplicateURLResponse struct {
+	Error      string `json:"error"`
+	ExistingID int    `json:"existing_id"`
+}
+
+// QuotaExceededResponse names the quota a request would go over.
+type QuotaExceededResponse struct {
+	Error string `json:"error"`
+	Quota string `json:"quota"`
+	Limit int    `json:"limit"`
+	Used  int    `json:"used"`
+}
+
 type SuccessResponse struct {
 	Message string      `json:"message"`
 	Data    interface{} `json:"data,omitempty"`
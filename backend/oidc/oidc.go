@@ -0,0 +1,334 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Config holds the identity provider settings loaded from the environment.
+type Config struct {
+	// Issuer is the provider's issuer URL; discovery is loaded from
+	// {Issuer}/.well-known/openid-configuration.
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+
+	// RedirectURL is the backend callback registered with the provider.
+	RedirectURL string
+
+	// FrontendURL receives the browser after the callback, with a one-time
+	// code or an error in the fragment.
+	FrontendURL string
+
+	Scopes        []string
+	UsernameClaim string
+
+	// AutoProvision creates local users on first login.
+	AutoProvision bool
+}
+
+var config Config
+
+// discoveryTTL is how long provider metadata and keys are cached.
+const discoveryTTL = time.Hour
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// Init loads the OIDC configuration from the environment.
+func Init() {
+	config = Config{
+		Issuer:        strings.TrimRight(os.Getenv("OIDC_ISSUER"), "/"),
+		ClientID:      os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret:  os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:   os.Getenv("OIDC_REDIRECT_URL"),
+		FrontendURL:   getEnv("OIDC_FRONTEND_URL", "http://localhost:5173/auth/callback"),
+		Scopes:        strings.Fields(getEnv("OIDC_SCOPES", "openid email profile")),
+		UsernameClaim: getEnv("OIDC_USERNAME_CLAIM", "preferred_username"),
+		AutoProvision: getEnv("OIDC_AUTO_PROVISION", "true") == "true",
+	}
+}
+
+// Enabled reports whether single sign-on is configured.
+func Enabled() bool {
+	return config.Issuer != "" && config.ClientID != "" && config.RedirectURL != ""
+}
+
+// Settings returns the loaded configuration.
+func Settings() Config {
+	return config
+}
+
+// Provider is the subset of the discovery document used for the
+// authorization code flow.
+type Provider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+var (
+	mu        sync.Mutex
+	provider  *Provider
+	loadedAt  time.Time
+	keys      map[string]interface{}
+	keysAt    time.Time
+	errNoKeys = errors.New("no signing key found for ID token")
+)
+
+// Discover returns the provider metadata, fetching it when the cache is
+// empty or stale.
+func Discover() (*Provider, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if provider != nil && time.Since(loadedAt) < discoveryTTL {
+		return provider, nil
+	}
+
+	var p Provider
+	if err := getJSON(config.Issuer+"/.well-known/openid-configuration", &p); err != nil {
+		return nil, fmt.Errorf("failed to load OIDC discovery document: %v", err)
+	}
+	if strings.TrimRight(p.Issuer, "/") != config.Issuer {
+		return nil, fmt.Errorf("discovery document issuer %q does not match %q", p.Issuer, config.Issuer)
+	}
+	if p.AuthorizationEndpoint == "" || p.TokenEndpoint == "" || p.JWKSURI == "" {
+		return nil, errors.New("discovery document is missing endpoints")
+	}
+
+	provider, loadedAt = &p, time.Now()
+	keys = nil
+	return provider, nil
+}
+
+// NewVerifier returns a random PKCE code verifier.
+func NewVerifier() string {
+	return RandomString(32)
+}
+
+// RandomString returns n random bytes, base64url encoded.
+func RandomString(n int) string {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// AuthCodeURL builds the authorization request with an S256 PKCE challenge.
+func (p *Provider) AuthCodeURL(state, nonce, verifier string) string {
+	challenge := sha256.Sum256([]byte(verifier))
+
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {config.ClientID},
+		"redirect_uri":          {config.RedirectURL},
+		"scope":                 {strings.Join(config.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(p.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return p.AuthorizationEndpoint + separator + params.Encode()
+}
+
+// Exchange redeems an authorization code and returns the raw ID token.
+func (p *Provider) Exchange(code, verifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {config.RedirectURL},
+		"client_id":     {config.ClientID},
+		"code_verifier": {verifier},
+	}
+
+	req, err := http.NewRequest(http.MethodPost, p.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(config.ClientID), url.QueryEscape(config.ClientSecret))
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return "", fmt.Errorf("invalid token response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || body.Error != "" {
+		return "", fmt.Errorf("token endpoint returned %s: %s %s", resp.Status, body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return "", errors.New("token response has no id_token")
+	}
+	return body.IDToken, nil
+}
+
+// Claims are the ID token claims used to find or create the local user.
+type Claims struct {
+	Nonce             string      `json:"nonce"`
+	AuthorizedParty   string      `json:"azp"`
+	Email             string      `json:"email"`
+	EmailVerified     interface{} `json:"email_verified"`
+	PreferredUsername string      `json:"preferred_username"`
+	Name              string      `json:"name"`
+	jwt.RegisteredClaims
+
+	raw map[string]interface{}
+}
+
+// IsEmailVerified accepts both boolean and string email_verified claims,
+// since providers differ.
+func (c *Claims) IsEmailVerified() bool {
+	switch v := c.EmailVerified.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+// Username returns the configured username claim, falling back to the local
+// part of the email address.
+func (c *Claims) Username() string {
+	if value, ok := c.raw[config.UsernameClaim].(string); ok && value != "" {
+		return value
+	}
+	if at := strings.Index(c.Email, "@"); at > 0 {
+		return c.Email[:at]
+	}
+	return c.PreferredUsername
+}
+
+// Verify checks an ID token's signature against the provider's JWKS and
+// validates its issuer, audience, expiry and nonce.
+func (p *Provider) Verify(idToken, nonce string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, p.keyFor,
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithIssuer(p.Issuer),
+		jwt.WithAudience(config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %v", err)
+	}
+
+	if claims.Nonce != nonce {
+		return nil, errors.New("invalid ID token: nonce mismatch")
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != config.ClientID {
+		return nil, errors.New("invalid ID token: unexpected authorized party")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("invalid ID token: missing subject")
+	}
+
+	// Keep every claim so the username claim can be configured freely
+	parts := strings.Split(idToken, ".")
+	if payload, err := base64.RawURLEncoding.DecodeString(parts[1]); err == nil {
+		json.Unmarshal(payload, &claims.raw)
+	}
+
+	return claims, nil
+}
+
+// keyFor finds the verification key for a token, reloading the JWKS once
+// when the key ID is unknown in case the provider rotated its keys.
+func (p *Provider) keyFor(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if key := lookupKey(kid); key != nil && time.Since(keysAt) < discoveryTTL {
+		return key, nil
+	}
+	// Avoid hammering the provider with tokens signed by unknown keys
+	if keys != nil && time.Since(keysAt) < 10*time.Second {
+		return nil, errNoKeys
+	}
+
+	loaded, err := fetchKeys(p.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+	keys, keysAt = loaded, time.Now()
+
+	if key := lookupKey(kid); key != nil {
+		return key, nil
+	}
+	return nil, errNoKeys
+}
+
+// lookupKey returns the key with the given ID, or the only key when the
+// token does not name one.
+func lookupKey(kid string) interface{} {
+	if kid != "" {
+		return keys[kid]
+	}
+	if len(keys) == 1 {
+		for _, key := range keys {
+			return key
+		}
+	}
+	return nil
+}
+
+func getJSON(target string, v interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s from %s", resp.Status, target)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
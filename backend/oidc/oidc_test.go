@@ -0,0 +1,309 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testClientID = "crawler"
+
+// mockProvider is a local identity provider serving discovery, JWKS and a
+// token endpoint that checks PKCE.
+type mockProvider struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	keys      map[string]*rsa.PrivateKey
+	jwksLoads int
+	// challenges maps issued codes to their PKCE challenge
+	challenges map[string]string
+	idToken    string
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+	m := &mockProvider{
+		keys:       map[string]*rsa.PrivateKey{},
+		challenges: map[string]string{},
+	}
+	m.addKey(t, "key-1")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Provider{
+			Issuer:                m.URL,
+			AuthorizationEndpoint: m.URL + "/authorize",
+			TokenEndpoint:         m.URL + "/token",
+			JWKSURI:               m.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.jwksLoads++
+
+		set := struct {
+			Keys []jwk `json:"keys"`
+		}{}
+		for kid, key := range m.keys {
+			set.Keys = append(set.Keys, jwk{
+				Kid: kid,
+				Kty: "RSA",
+				Use: "sig",
+				N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		json.NewEncoder(w).Encode(set)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		m.mu.Lock()
+		challenge, ok := m.challenges[r.PostForm.Get("code")]
+		m.mu.Unlock()
+
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": m.idToken})
+	})
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+
+	// Point the package at the mock and start from empty caches
+	config = Config{Issuer: m.URL, ClientID: testClientID, RedirectURL: "http://localhost/callback"}
+	mu.Lock()
+	provider, keys = nil, nil
+	mu.Unlock()
+	return m
+}
+
+func (m *mockProvider) addKey(t *testing.T, kid string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.mu.Lock()
+	m.keys[kid] = key
+	m.mu.Unlock()
+}
+
+// sign issues an ID token; change adjusts the default claims.
+func (m *mockProvider) sign(t *testing.T, kid string, change func(jwt.MapClaims)) string {
+	t.Helper()
+	claims := jwt.MapClaims{
+		"iss":            m.URL,
+		"sub":            "user-1",
+		"aud":            testClientID,
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          "nonce-1",
+		"email":          "user@example.com",
+		"email_verified": true,
+	}
+	if change != nil {
+		change(claims)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	m.mu.Lock()
+	key := m.keys[kid]
+	m.mu.Unlock()
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestDiscover(t *testing.T) {
+	m := newMockProvider(t)
+
+	p, err := Discover()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.TokenEndpoint != m.URL+"/token" || p.JWKSURI != m.URL+"/jwks" {
+		t.Errorf("unexpected endpoints: %+v", p)
+	}
+}
+
+func TestDiscoverRejectsIssuerMismatch(t *testing.T) {
+	newMockProvider(t)
+	config.Issuer = "https://other.example.com"
+
+	if _, err := Discover(); err == nil {
+		t.Error("discovery document for another issuer was accepted")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	m := newMockProvider(t)
+	p, err := Discover()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(jwt.MapClaims)
+		nonce  string
+		valid  bool
+	}{
+		{"valid", nil, "nonce-1", true},
+		{"wrong nonce", nil, "nonce-2", false},
+		{"missing nonce", func(c jwt.MapClaims) { delete(c, "nonce") }, "nonce-1", false},
+		{"wrong audience", func(c jwt.MapClaims) { c["aud"] = "someone-else" }, "nonce-1", false},
+		{"other authorized party", func(c jwt.MapClaims) {
+			c["aud"] = []string{testClientID, "someone-else"}
+			c["azp"] = "someone-else"
+		}, "nonce-1", false},
+		{"wrong issuer", func(c jwt.MapClaims) { c["iss"] = "https://other.example.com" }, "nonce-1", false},
+		{"expired", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, "nonce-1", false},
+		{"missing subject", func(c jwt.MapClaims) { delete(c, "sub") }, "nonce-1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := p.Verify(m.sign(t, "key-1", tt.change), tt.nonce)
+			if tt.valid && err != nil {
+				t.Fatalf("valid token rejected: %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Fatal("invalid token accepted")
+			}
+			if tt.valid && (claims.Subject != "user-1" || !claims.IsEmailVerified()) {
+				t.Errorf("unexpected claims: %+v", claims)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsUnknownSigner(t *testing.T) {
+	m := newMockProvider(t)
+	p, err := Discover()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Signed with a key the provider never published
+	stranger := newMockProvider(t)
+	token := stranger.sign(t, "key-1", func(c jwt.MapClaims) { c["iss"] = m.URL })
+	config.Issuer = m.URL
+	mu.Lock()
+	provider, keys = p, nil
+	mu.Unlock()
+
+	if _, err := p.Verify(token, "nonce-1"); err == nil {
+		t.Error("token signed by an unknown key was accepted")
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	m := newMockProvider(t)
+	p, err := Discover()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.Verify(m.sign(t, "key-1", nil), "nonce-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The provider rotates to a new key after the JWKS was cached
+	m.addKey(t, "key-2")
+	mu.Lock()
+	keysAt = time.Now().Add(-time.Minute)
+	mu.Unlock()
+
+	if _, err := p.Verify(m.sign(t, "key-2", nil), "nonce-1"); err != nil {
+		t.Fatalf("token signed with the rotated key rejected: %v", err)
+	}
+	if m.jwksLoads != 2 {
+		t.Errorf("JWKS loaded %d times, want 2", m.jwksLoads)
+	}
+
+	// Cached keys are used without another fetch
+	if _, err := p.Verify(m.sign(t, "key-1", nil), "nonce-1"); err != nil {
+		t.Fatal(err)
+	}
+	if m.jwksLoads != 2 {
+		t.Errorf("JWKS loaded %d times, want 2", m.jwksLoads)
+	}
+}
+
+func TestKeyReloadIsThrottled(t *testing.T) {
+	m := newMockProvider(t)
+	p, err := Discover()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Verify(m.sign(t, "key-1", nil), "nonce-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// An unknown key ID right after a fetch does not refetch
+	m.addKey(t, "key-2")
+	if _, err := p.Verify(m.sign(t, "key-2", nil), "nonce-1"); err == nil {
+		t.Error("token with an unknown key accepted without reloading")
+	}
+	if m.jwksLoads != 1 {
+		t.Errorf("JWKS loaded %d times, want 1", m.jwksLoads)
+	}
+}
+
+func TestPKCE(t *testing.T) {
+	m := newMockProvider(t)
+	p, err := Discover()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier := NewVerifier()
+	authURL, err := url.Parse(p.AuthCodeURL("state-1", "nonce-1", verifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := authURL.Query()
+	if !strings.HasPrefix(authURL.String(), m.URL+"/authorize?") {
+		t.Errorf("authorization URL %s", authURL)
+	}
+	if params.Get("code_challenge_method") != "S256" || params.Get("state") != "state-1" || params.Get("nonce") != "nonce-1" {
+		t.Errorf("unexpected authorization parameters: %v", params)
+	}
+	if params.Get("code_challenge") == verifier {
+		t.Error("verifier sent in the clear")
+	}
+
+	m.challenges["code-1"] = params.Get("code_challenge")
+	m.idToken = m.sign(t, "key-1", nil)
+
+	if _, err := p.Exchange("code-1", NewVerifier()); err == nil {
+		t.Error("exchange with the wrong verifier succeeded")
+	}
+	idToken, err := p.Exchange("code-1", verifier)
+	if err != nil {
+		t.Fatalf("exchange failed: %v", err)
+	}
+	if _, err := p.Verify(idToken, "nonce-1"); err != nil {
+		t.Error(err)
+	}
+}
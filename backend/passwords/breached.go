@@ -0,0 +1,153 @@
+package passwords
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Breached reports whether a password is in the local breached password
+// list, BREACHED_PASSWORDS_PATH. The list uses the Pwned Passwords format of
+// upper-case SHA-1 hashes with a count, "HASH:COUNT", and can be either:
+//
+//   - a directory of k-anonymity range files named by the first five hex
+//     characters of the hash (e.g. 5BAA6.txt), each holding "SUFFIX:COUNT"
+//     lines, as written by the Pwned Passwords downloader; or
+//   - a single file of "HASH:COUNT" lines sorted by hash.
+//
+// Without a configured list every password passes.
+func Breached(password string) (bool, error) {
+	path := os.Getenv("BREACHED_PASSWORDS_PATH")
+	if path == "" {
+		return false, nil
+	}
+
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	if info.IsDir() {
+		return inRangeFile(path, hash)
+	}
+	return inSortedFile(path, hash)
+}
+
+// inRangeFile looks the hash suffix up in the range file for its prefix.
+func inRangeFile(dir, hash string) (bool, error) {
+	prefix, suffix := hash[:5], hash[5:]
+
+	f, err := os.Open(filepath.Join(dir, prefix+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if found, _, _ := strings.Cut(line, ":"); strings.EqualFold(found, suffix) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// inSortedFile binary searches a file of sorted "HASH:COUNT" lines, so that
+// even the full multi-gigabyte list needs only a few dozen reads.
+func inSortedFile(path, hash string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	target := []byte(hash)
+	low, high := int64(0), info.Size()
+	for low < high {
+		mid := low + (high-low)/2
+
+		line, start, err := lineAt(f, mid)
+		if err != nil {
+			return false, err
+		}
+		if line == nil {
+			// mid fell inside the last line; search the lower half
+			high = mid
+			continue
+		}
+
+		found, _, _ := bytes.Cut(line, []byte(":"))
+		switch cmp := bytes.Compare(bytes.ToUpper(bytes.TrimSpace(found)), target); {
+		case cmp == 0:
+			return true, nil
+		case cmp < 0:
+			low = start + int64(len(line))
+		default:
+			high = mid
+		}
+	}
+
+	// The first line is never returned by lineAt for offsets past zero
+	line, _, err := readLine(f, 0)
+	if err != nil {
+		return false, err
+	}
+	found, _, _ := bytes.Cut(line, []byte(":"))
+	return bytes.Equal(bytes.ToUpper(bytes.TrimSpace(found)), target), nil
+}
+
+// lineAt returns the first line that starts after offset, and where it
+// starts. At offset zero that is the first line of the file.
+func lineAt(f *os.File, offset int64) ([]byte, int64, error) {
+	if offset == 0 {
+		return readLine(f, 0)
+	}
+
+	// Skip the rest of the line offset points into
+	buf := make([]byte, 128)
+	for {
+		n, err := f.ReadAt(buf, offset)
+		if i := bytes.IndexByte(buf[:n], '\n'); i >= 0 {
+			return readLine(f, offset+int64(i)+1)
+		}
+		offset += int64(n)
+		if err == io.EOF {
+			return nil, offset, nil
+		}
+		if err != nil {
+			return nil, offset, err
+		}
+	}
+}
+
+func readLine(f *os.File, start int64) ([]byte, int64, error) {
+	buf := make([]byte, 128)
+	n, err := f.ReadAt(buf, start)
+	if err != nil && err != io.EOF {
+		return nil, start, err
+	}
+	if n == 0 {
+		return nil, start, nil
+	}
+	if i := bytes.IndexByte(buf[:n], '\n'); i >= 0 {
+		return bytes.TrimRight(buf[:i], "\r"), start, nil
+	}
+	return bytes.TrimRight(buf[:n], "\r"), start, nil
+}
@@ -0,0 +1,139 @@
+package passwords
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// writeList writes a sorted "HASH:COUNT" file of the hashes.
+func writeList(t *testing.T, hashes []string, newline string, trailing bool) string {
+	t.Helper()
+	lines := make([]string, len(hashes))
+	for i, hash := range hashes {
+		lines[i] = fmt.Sprintf("%s:%d", hash, i+1)
+	}
+	content := strings.Join(lines, newline)
+	if trailing {
+		content += newline
+	}
+
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestInSortedFile(t *testing.T) {
+	var hashes []string
+	for i := 0; i < 200; i++ {
+		hashes = append(hashes, sha1Hex(fmt.Sprintf("password%d", i)))
+	}
+	sort.Strings(hashes)
+
+	// Absent hashes below, between and above the listed ones
+	absent := []string{strings.Repeat("0", 40), strings.Repeat("F", 40)}
+	for i := 200; len(absent) < 20; i++ {
+		hash := sha1Hex(fmt.Sprintf("password%d", i))
+		if hash > hashes[0] && hash < hashes[len(hashes)-1] {
+			absent = append(absent, hash)
+		}
+	}
+
+	files := []struct {
+		name     string
+		hashes   []string
+		newline  string
+		trailing bool
+	}{
+		{"trailing newline", hashes, "\n", true},
+		{"no trailing newline", hashes, "\n", false},
+		{"CRLF", hashes, "\r\n", true},
+		{"CRLF without trailing newline", hashes, "\r\n", false},
+		{"single line", hashes[:1], "\n", false},
+		{"two lines", hashes[:2], "\n", false},
+	}
+
+	for _, file := range files {
+		t.Run(file.name, func(t *testing.T) {
+			path := writeList(t, file.hashes, file.newline, file.trailing)
+
+			// Every line is found, including the first and last
+			for i, hash := range file.hashes {
+				for _, query := range []string{hash, strings.ToLower(hash)} {
+					found, err := inSortedFile(path, strings.ToUpper(query))
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !found {
+						t.Errorf("line %d (%s) not found", i+1, hash)
+					}
+				}
+			}
+			for _, hash := range absent {
+				if found, _ := inSortedFile(path, hash); found {
+					t.Errorf("absent hash %s found", hash)
+				}
+			}
+		})
+	}
+}
+
+func TestInSortedFileEmpty(t *testing.T) {
+	path := writeList(t, nil, "\n", false)
+	found, err := inSortedFile(path, sha1Hex("password"))
+	if err != nil || found {
+		t.Errorf("got (%v, %v) for an empty list", found, err)
+	}
+}
+
+func TestBreached(t *testing.T) {
+	pwned := sha1Hex("correct horse battery staple")
+
+	t.Run("no list", func(t *testing.T) {
+		t.Setenv("BREACHED_PASSWORDS_PATH", "")
+		if breached, err := Breached("correct horse battery staple"); breached || err != nil {
+			t.Errorf("got (%v, %v) without a list", breached, err)
+		}
+	})
+
+	t.Run("sorted file", func(t *testing.T) {
+		hashes := []string{sha1Hex("a"), sha1Hex("b"), pwned}
+		sort.Strings(hashes)
+		t.Setenv("BREACHED_PASSWORDS_PATH", writeList(t, hashes, "\n", true))
+
+		if breached, err := Breached("correct horse battery staple"); !breached || err != nil {
+			t.Errorf("got (%v, %v) for a listed password", breached, err)
+		}
+		if breached, _ := Breached("Tr0ub4dour&3x"); breached {
+			t.Error("unlisted password reported as breached")
+		}
+	})
+
+	t.Run("range directory", func(t *testing.T) {
+		dir := t.TempDir()
+		content := "0018A45C4D1DEF81644B54AB7F969B88D65:1\r\n" + strings.ToLower(pwned[5:]) + ":42\r\n"
+		if err := os.WriteFile(filepath.Join(dir, pwned[:5]+".txt"), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("BREACHED_PASSWORDS_PATH", dir)
+
+		if breached, err := Breached("correct horse battery staple"); !breached || err != nil {
+			t.Errorf("got (%v, %v) for a listed password", breached, err)
+		}
+		if breached, err := Breached("Tr0ub4dour&3x"); breached || err != nil {
+			t.Errorf("got (%v, %v) for a password without a range file", breached, err)
+		}
+	})
+}
@@ -0,0 +1,122 @@
+// Package passwords holds the rules new passwords must meet.
+package passwords
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	defaultMinLength = 10
+
+	// maxLength is bcrypt's input limit; longer passwords would be silently
+	// truncated.
+	maxLength = 72
+
+	// longEnough passwords need not mix character classes.
+	longEnough = 16
+)
+
+// ErrBreached is returned for passwords found in the breached password list.
+var ErrBreached = errors.New("this password has appeared in a data breach, please choose another")
+
+// MinLength is the shortest accepted password, PASSWORD_MIN_LENGTH.
+func MinLength() int {
+	value := os.Getenv("PASSWORD_MIN_LENGTH")
+	if value == "" {
+		return defaultMinLength
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 8 {
+		log.Printf("Invalid value for PASSWORD_MIN_LENGTH: %q, using %d", value, defaultMinLength)
+		return defaultMinLength
+	}
+	return n
+}
+
+// Validate checks a new password against the strength rules and the
+// breached password list. username and email are rejected as part of the
+// password.
+func Validate(password, username, email string) error {
+	if n := MinLength(); len([]rune(password)) < n {
+		return fmt.Errorf("password must be at least %d characters long", n)
+	}
+	if len(password) > maxLength {
+		return fmt.Errorf("password must be at most %d bytes long", maxLength)
+	}
+
+	lower := strings.ToLower(password)
+	for _, part := range personalParts(username, email) {
+		if strings.Contains(lower, part) {
+			return errors.New("password must not contain your username or email address")
+		}
+	}
+
+	if distinct(password) < 4 {
+		return errors.New("password has too many repeated characters")
+	}
+	if len([]rune(password)) < longEnough && classes(password) < 3 {
+		return fmt.Errorf("password must mix at least three of lowercase letters, uppercase letters, digits and symbols, or be at least %d characters long", longEnough)
+	}
+
+	breached, err := Breached(password)
+	if err != nil {
+		// An unreadable list should not block sign-ups
+		log.Printf("Breached password check failed: %v", err)
+	}
+	if breached {
+		return ErrBreached
+	}
+	return nil
+}
+
+// personalParts are the lower-cased username and email local part, when
+// long enough to matter.
+func personalParts(username, email string) []string {
+	var parts []string
+	for _, part := range []string{username, strings.SplitN(email, "@", 2)[0]} {
+		if part = strings.ToLower(part); len(part) >= 3 {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+func distinct(password string) int {
+	seen := make(map[rune]bool)
+	for _, r := range password {
+		seen[r] = true
+	}
+	return len(seen)
+}
+
+// classes counts the character classes used: lowercase, uppercase, digits
+// and everything else.
+func classes(password string) int {
+	var lower, upper, digit, other bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+
+	count := 0
+	for _, used := range []bool{lower, upper, digit, other} {
+		if used {
+			count++
+		}
+	}
+	return count
+}
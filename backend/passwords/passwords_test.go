@@ -0,0 +1,63 @@
+package passwords
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	t.Setenv("PASSWORD_MIN_LENGTH", "")
+	t.Setenv("BREACHED_PASSWORDS_PATH", "")
+
+	tests := []struct {
+		name     string
+		password string
+		valid    bool
+	}{
+		{"mixed classes", "Blue-Kettle7", true},
+		{"long passphrase", "correct horse battery", true},
+		{"too short", "Ab1!xyz", false},
+		{"too long", strings.Repeat("aB3!", 19), false},
+		{"contains username", "xAliceSmith1!", false},
+		{"contains email name", "Hi-a.smith-99", false},
+		{"repeated characters", "aaaaAAAA1111", false},
+		{"two classes", "kettlehouse12", false},
+		{"multibyte length", "Пароль-ключ1", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.password, "alicesmith", "a.smith@example.com")
+			if tt.valid && err != nil {
+				t.Errorf("rejected: %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("accepted")
+			}
+		})
+	}
+}
+
+func TestValidateMinLength(t *testing.T) {
+	t.Setenv("BREACHED_PASSWORDS_PATH", "")
+
+	t.Setenv("PASSWORD_MIN_LENGTH", "14")
+	if err := Validate("Blue-Kettle7", "", ""); err == nil {
+		t.Error("password below PASSWORD_MIN_LENGTH accepted")
+	}
+
+	// Values below 8 fall back to the default
+	t.Setenv("PASSWORD_MIN_LENGTH", "4")
+	if MinLength() != defaultMinLength {
+		t.Errorf("MinLength() = %d, want %d", MinLength(), defaultMinLength)
+	}
+}
+
+func TestValidateBreached(t *testing.T) {
+	t.Setenv("PASSWORD_MIN_LENGTH", "")
+	t.Setenv("BREACHED_PASSWORDS_PATH", writeList(t, []string{sha1Hex("Blue-Kettle7")}, "\n", true))
+
+	if err := Validate("Blue-Kettle7", "", ""); err != ErrBreached {
+		t.Errorf("got %v, want ErrBreached", err)
+	}
+}
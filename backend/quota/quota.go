@@ -0,0 +1,182 @@
+// Package quota enforces the limits of each user's plan: how many URLs they
+// may store, how many crawls they may start a day and how many may run at
+// once.
+package quota
+
+import (
+	"database/sql"
+	"fmt"
+
+	"webcrawler/database"
+	"webcrawler/models"
+)
+
+// Plans
+const (
+	PlanFree      = "free"
+	PlanPro       = "pro"
+	PlanUnlimited = "unlimited"
+)
+
+// Quotas, as named in ExceededError.
+const (
+	URLs             = "urls"
+	CrawlsPerDay     = "crawls_per_day"
+	ConcurrentCrawls = "concurrent_crawls"
+)
+
+// Plan holds a plan's limits. A limit of 0 means unlimited.
+type Plan struct {
+	Name                string
+	MaxURLs             int
+	MaxCrawlsPerDay     int
+	MaxConcurrentCrawls int
+}
+
+// Plans lists the plans users can be on.
+var Plans = map[string]Plan{
+	PlanFree:      {Name: PlanFree, MaxURLs: 100, MaxCrawlsPerDay: 200, MaxConcurrentCrawls: 3},
+	PlanPro:       {Name: PlanPro, MaxURLs: 5000, MaxCrawlsPerDay: 5000, MaxConcurrentCrawls: 20},
+	PlanUnlimited: {Name: PlanUnlimited},
+}
+
+// ExceededError is returned when a request would take a user over one of
+// their plan's limits.
+type ExceededError struct {
+	Quota string
+	Limit int
+	Used  int
+}
+
+func (e *ExceededError) Error() string {
+	switch e.Quota {
+	case URLs:
+		return fmt.Sprintf("Your plan allows %d stored URLs", e.Limit)
+	case CrawlsPerDay:
+		return fmt.Sprintf("Your plan allows %d crawls a day", e.Limit)
+	default:
+		return fmt.Sprintf("Your plan allows %d crawls at once", e.Limit)
+	}
+}
+
+// check fails when adding to used goes over limit.
+func check(quota string, limit, used, adding int) error {
+	if limit > 0 && used+adding > limit {
+		return &ExceededError{Quota: quota, Limit: limit, Used: used}
+	}
+	return nil
+}
+
+// queryer is a *sql.DB or a *sql.Tx.
+type queryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// planOf returns the user's plan, locking the user's row when lock is set.
+// Users on a plan that no longer exists get the free plan.
+func planOf(q queryer, userID int, lock bool) (Plan, error) {
+	query := "SELECT plan FROM users WHERE id = ?"
+	if lock {
+		query += " FOR UPDATE"
+	}
+
+	var name string
+	if err := q.QueryRow(query, userID).Scan(&name); err != nil {
+		return Plan{}, err
+	}
+	if plan, ok := Plans[name]; ok {
+		return plan, nil
+	}
+	return Plans[PlanFree], nil
+}
+
+// CheckURLs fails when storing adding more URLs would take the user over
+// their plan's URL limit. URLs count against whoever added them, in any
+// workspace. It locks the user's row until tx ends, so run it in the
+// transaction that inserts the URLs.
+func CheckURLs(tx *sql.Tx, userID, adding int) error {
+	plan, err := planOf(tx, userID, true)
+	if err != nil || plan.MaxURLs == 0 {
+		return err
+	}
+
+	var used int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM urls WHERE user_id = ?", userID).Scan(&used); err != nil {
+		return err
+	}
+	return check(URLs, plan.MaxURLs, used, adding)
+}
+
+// ReserveCrawls checks that the user may start crawls of the URLs and counts
+// them against the daily limit. It locks the user's row until tx ends, so
+// run it in the transaction that marks the URLs running and started by the
+// user. Rerunning a URL that is already running replaces its crawl, so such
+// URLs do not count twice towards the concurrent limit.
+func ReserveCrawls(tx *sql.Tx, userID int, urlIDs []int) error {
+	plan, err := planOf(tx, userID, true)
+	if err != nil {
+		return err
+	}
+
+	if plan.MaxCrawlsPerDay > 0 {
+		var used int
+		err := tx.QueryRow("SELECT COUNT(*) FROM crawl_starts WHERE user_id = ? AND created_at > NOW() - INTERVAL 1 DAY", userID).Scan(&used)
+		if err != nil {
+			return err
+		}
+		if err := check(CrawlsPerDay, plan.MaxCrawlsPerDay, used, len(urlIDs)); err != nil {
+			return err
+		}
+	}
+
+	if plan.MaxConcurrentCrawls > 0 {
+		query := "SELECT COUNT(*) FROM urls WHERE started_by = ? AND status = 'running' AND id NOT IN ("
+		args := []interface{}{userID}
+		for i, id := range urlIDs {
+			if i > 0 {
+				query += ","
+			}
+			query += "?"
+			args = append(args, id)
+		}
+		query += ")"
+
+		var running int
+		if err := tx.QueryRow(query, args...).Scan(&running); err != nil {
+			return err
+		}
+		if err := check(ConcurrentCrawls, plan.MaxConcurrentCrawls, running, len(urlIDs)); err != nil {
+			return err
+		}
+	}
+
+	for _, id := range urlIDs {
+		if _, err := tx.Exec("INSERT INTO crawl_starts (user_id, url_id) VALUES (?, ?)", userID, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Usage returns the user's plan limits and what they use of them.
+func Usage(userID int) (models.Quota, error) {
+	plan, err := planOf(database.DB, userID, false)
+	if err != nil {
+		return models.Quota{}, err
+	}
+
+	usage := models.Quota{
+		Plan:                plan.Name,
+		MaxURLs:             plan.MaxURLs,
+		MaxCrawlsPerDay:     plan.MaxCrawlsPerDay,
+		MaxConcurrentCrawls: plan.MaxConcurrentCrawls,
+	}
+	query := `
+		SELECT
+			(SELECT COUNT(*) FROM urls WHERE user_id = ?),
+			(SELECT COUNT(*) FROM crawl_starts WHERE user_id = ? AND created_at > NOW() - INTERVAL 1 DAY),
+			(SELECT COUNT(*) FROM urls WHERE started_by = ? AND status = 'running')
+	`
+	err = database.DB.QueryRow(query, userID, userID, userID).Scan(&usage.URLs, &usage.CrawlsToday, &usage.RunningCrawls)
+	return usage, err
+}
@@ -0,0 +1,48 @@
+package quota
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name                string
+		limit, used, adding int
+		exceeded            bool
+	}{
+		{"unlimited", 0, 1000, 50, false},
+		{"below limit", 100, 10, 1, false},
+		{"reaching limit", 100, 99, 1, false},
+		{"over limit", 100, 100, 1, true},
+		{"batch over limit", 100, 95, 10, true},
+		{"already over", 100, 120, 0, true},
+		{"nothing added at limit", 100, 100, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := check(URLs, tt.limit, tt.used, tt.adding)
+			var exceeded *ExceededError
+			if got := errors.As(err, &exceeded); got != tt.exceeded {
+				t.Fatalf("got %v, exceeded %v", err, tt.exceeded)
+			}
+			if tt.exceeded && (exceeded.Limit != tt.limit || exceeded.Used != tt.used || exceeded.Quota != URLs) {
+				t.Errorf("unexpected error %+v", exceeded)
+			}
+		})
+	}
+}
+
+func TestExceededErrorMessage(t *testing.T) {
+	tests := map[string]string{
+		URLs:             "Your plan allows 5 stored URLs",
+		CrawlsPerDay:     "Your plan allows 5 crawls a day",
+		ConcurrentCrawls: "Your plan allows 5 crawls at once",
+	}
+	for quota, want := range tests {
+		if got := (&ExceededError{Quota: quota, Limit: 5}).Error(); got != want {
+			t.Errorf("%s: %q, want %q", quota, got, want)
+		}
+	}
+}
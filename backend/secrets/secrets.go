@@ -0,0 +1,124 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// prefix marks values produced by Encrypt so older plaintext values can
+// still be read.
+const prefix = "enc:v1:"
+
+var (
+	keyOnce sync.Once
+	aead    cipher.AEAD
+	keyErr  error
+)
+
+// Init loads the credentials key and stops the server when none is
+// configured, rather than failing on the first crawl profile saved.
+func Init() {
+	keyOnce.Do(loadKey)
+	if keyErr != nil {
+		log.Fatal("Invalid credentials key configuration: ", keyErr)
+	}
+}
+
+func loadKey() {
+	aead, keyErr = newAEAD()
+}
+
+// newAEAD builds the cipher from CREDENTIALS_KEY (32 bytes, base64 encoded).
+// Without it the key is derived from JWT_SECRET so existing setups keep
+// working. With neither set a fixed, publicly known key would protect
+// nothing, so that is only allowed in development mode (GIN_MODE=debug).
+func newAEAD() (cipher.AEAD, error) {
+	var key []byte
+
+	if encoded := os.Getenv("CREDENTIALS_KEY"); encoded != "" {
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(decoded) != 32 {
+			return nil, errors.New("CREDENTIALS_KEY must be 32 bytes, base64 encoded")
+		}
+		key = decoded
+	} else if jwtSecret := os.Getenv("JWT_SECRET"); jwtSecret != "" {
+		log.Println("CREDENTIALS_KEY not set, deriving credentials key from JWT_SECRET")
+		sum := sha256.Sum256([]byte("credentials:" + jwtSecret))
+		key = sum[:]
+	} else if os.Getenv("GIN_MODE") == "debug" {
+		log.Println("WARNING: CREDENTIALS_KEY and JWT_SECRET are not set, crawl profile secrets are encrypted with a development key")
+		sum := sha256.Sum256([]byte("credentials:"))
+		key = sum[:]
+	} else {
+		return nil, errors.New("set CREDENTIALS_KEY or JWT_SECRET to encrypt crawl profile secrets")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypt seals a secret with AES-GCM. Empty strings are returned unchanged.
+func Encrypt(plaintext string) (string, error) {
+	if plaintext == "" {
+		return plaintext, nil
+	}
+
+	keyOnce.Do(loadKey)
+	if keyErr != nil {
+		return "", keyErr
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return prefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// IsEncrypted reports whether value was produced by Encrypt.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// Decrypt opens a value produced by Encrypt. Values without the encryption
+// prefix are returned as-is.
+func Decrypt(value string) (string, error) {
+	encoded, ok := strings.CutPrefix(value, prefix)
+	if !ok {
+		return value, nil
+	}
+
+	keyOnce.Do(loadKey)
+	if keyErr != nil {
+		return "", keyErr
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted value: %v", err)
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", errors.New("invalid encrypted value")
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value: %v", err)
+	}
+	return string(plaintext), nil
+}
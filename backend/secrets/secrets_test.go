@@ -0,0 +1,75 @@
+package secrets
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestNewAEAD(t *testing.T) {
+	validKey := base64.StdEncoding.EncodeToString(make([]byte, 32))
+
+	tests := []struct {
+		name        string
+		credentials string
+		jwtSecret   string
+		ginMode     string
+		ok          bool
+	}{
+		{"credentials key", validKey, "", "release", true},
+		{"derived from JWT secret", "", "jwt-secret", "release", true},
+		{"development mode", "", "", "debug", true},
+		{"no key", "", "", "", false},
+		{"no key in release mode", "", "", "release", false},
+		{"short credentials key", base64.StdEncoding.EncodeToString(make([]byte, 16)), "jwt-secret", "", false},
+		{"malformed credentials key", "not base64!", "jwt-secret", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CREDENTIALS_KEY", tt.credentials)
+			t.Setenv("JWT_SECRET", tt.jwtSecret)
+			t.Setenv("GIN_MODE", tt.ginMode)
+
+			_, err := newAEAD()
+			if tt.ok && err != nil {
+				t.Errorf("rejected: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Error("accepted")
+			}
+		})
+	}
+}
+
+func TestEncrypt(t *testing.T) {
+	t.Setenv("CREDENTIALS_KEY", base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32))))
+
+	sealed, err := Encrypt("hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncrypted(sealed) || strings.Contains(sealed, "hunter2") {
+		t.Errorf("sealed value %q", sealed)
+	}
+	if again, _ := Encrypt("hunter2"); again == sealed {
+		t.Error("the same secret sealed twice gives the same value")
+	}
+
+	opened, err := Decrypt(sealed)
+	if err != nil || opened != "hunter2" {
+		t.Errorf("got (%q, %v)", opened, err)
+	}
+
+	// Values stored before encryption are read as they are
+	if opened, err := Decrypt("plaintext"); err != nil || opened != "plaintext" {
+		t.Errorf("got (%q, %v)", opened, err)
+	}
+	if empty, _ := Encrypt(""); empty != "" {
+		t.Errorf("empty secret sealed as %q", empty)
+	}
+
+	if _, err := Decrypt(sealed[:len(sealed)-4] + "AAAA"); err == nil {
+		t.Error("tampered value opened")
+	}
+}
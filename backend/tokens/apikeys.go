@@ -0,0 +1,102 @@
+package tokens
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"webcrawler/database"
+)
+
+// APIKeyPrefix starts every API key so keys can be told apart from JWTs.
+const APIKeyPrefix = "wc_"
+
+// API key scopes.
+const (
+	ScopeURLsRead      = "urls:read"
+	ScopeURLsWrite     = "urls:write"
+	ScopeSettingsRead  = "settings:read"
+	ScopeSettingsWrite = "settings:write"
+)
+
+// ErrInvalidAPIKey is returned for unknown, revoked or expired API keys.
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// APIKeyIdentity is the user and scopes an API key authenticates as.
+type APIKeyIdentity struct {
+	KeyID    int
+	UserID   int
+	Username string
+	Scopes   []string
+}
+
+// HasScope reports whether the key was granted a scope.
+func (k *APIKeyIdentity) HasScope(scope string) bool {
+	for _, granted := range k.Scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// NewAPIKey generates a key and returns it with its display prefix and the
+// hash to store. The key itself is only shown once.
+func NewAPIKey() (key, displayPrefix, hash string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", "", err
+	}
+	key = APIKeyPrefix + base64.RawURLEncoding.EncodeToString(buf)
+	return key, key[:len(APIKeyPrefix)+8], Hash(key), nil
+}
+
+// AuthenticateAPIKey looks up an API key and records that it was used. Keys
+// of disabled accounts are invalid.
+func AuthenticateAPIKey(key string) (*APIKeyIdentity, error) {
+	var identity APIKeyIdentity
+	var scopes string
+	var expiresAt sql.NullTime
+	query := `
+		SELECT k.id, k.user_id, u.username, k.scopes, k.expires_at
+		FROM api_keys k
+		JOIN users u ON u.id = k.user_id
+		WHERE k.key_hash = ? AND k.revoked_at IS NULL AND u.disabled_at IS NULL
+	`
+	err := database.DB.QueryRow(query, Hash(key)).Scan(
+		&identity.KeyID, &identity.UserID, &identity.Username, &scopes, &expiresAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if expiresAt.Valid && time.Now().After(expiresAt.Time) {
+		return nil, ErrInvalidAPIKey
+	}
+	identity.Scopes = SplitScopes(scopes)
+
+	// Only touch last_used_at about once a minute per key
+	_, err = database.DB.Exec(
+		"UPDATE api_keys SET last_used_at = NOW() WHERE id = ? AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL 1 MINUTE)",
+		identity.KeyID,
+	)
+	if err != nil {
+		log.Printf("Failed to record API key use: %v", err)
+	}
+
+	return &identity, nil
+}
+
+// SplitScopes parses the comma-separated scopes column.
+func SplitScopes(value string) []string {
+	if value == "" {
+		return []string{}
+	}
+	return strings.Split(value, ",")
+}
@@ -0,0 +1,61 @@
+package tokens
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	store := useTokenStore(t, 1, 2)
+
+	newKey := func(userID int, scopes string) (string, *apiKeyRow) {
+		key, prefix, hash, err := NewAPIKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(key, prefix) || !strings.HasPrefix(prefix, APIKeyPrefix) {
+			t.Fatalf("key %q does not start with %q", key, prefix)
+		}
+		store.nextID++
+		row := &apiKeyRow{id: store.nextID, userID: userID, scopes: scopes}
+		store.apiKeys[hash] = row
+		return key, row
+	}
+
+	key, row := newKey(1, "urls:read,settings:read")
+	identity, err := AuthenticateAPIKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.UserID != 1 || identity.KeyID != row.id || !reflect.DeepEqual(identity.Scopes, []string{ScopeURLsRead, ScopeSettingsRead}) {
+		t.Errorf("got %+v", identity)
+	}
+	if !identity.HasScope(ScopeURLsRead) || identity.HasScope(ScopeURLsWrite) {
+		t.Errorf("scopes %v", identity.Scopes)
+	}
+	if row.used != 1 {
+		t.Errorf("use recorded %d times", row.used)
+	}
+
+	revoked, revokedRow := newKey(1, "urls:read")
+	revokedRow.revoked = true
+	expired, expiredRow := newKey(1, "urls:read")
+	past := time.Now().Add(-time.Minute)
+	expiredRow.expiresAt = &past
+	disabled, _ := newKey(2, "urls:read")
+	store.users[2].disabled = true
+
+	for name, key := range map[string]string{
+		"revoked":          revoked,
+		"expired":          expired,
+		"disabled account": disabled,
+		"unknown":          APIKeyPrefix + "unknown",
+	} {
+		if _, err := AuthenticateAPIKey(key); !errors.Is(err, ErrInvalidAPIKey) {
+			t.Errorf("%s key: got %v, want ErrInvalidAPIKey", name, err)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package tokens
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"webcrawler/database"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ChallengeTTL is how long a user has to enter their second factor after
+// the password was accepted.
+const ChallengeTTL = 5 * time.Minute
+
+// challengeAudience keeps challenge tokens apart from access tokens.
+const challengeAudience = "2fa-challenge"
+
+// ErrInvalidChallenge is returned for unknown, expired or used challenge
+// tokens.
+var ErrInvalidChallenge = errors.New("invalid or expired challenge token")
+
+type challengeClaims struct {
+	Generation int `json:"gen,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// IssueChallengeToken signs a token proving that the user passed the first
+// login step. It carries no user_id claim, so the auth middleware rejects it.
+func IssueChallengeToken(userID int) (string, error) {
+	var generation int
+	if err := database.DB.QueryRow("SELECT token_generation FROM users WHERE id = ?", userID).Scan(&generation); err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := challengeClaims{
+		Generation: generation,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        randomID(),
+			Subject:   strconv.Itoa(userID),
+			Audience:  jwt.ClaimStrings{challengeAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ChallengeTTL)),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(secret())
+}
+
+// ParseChallengeToken validates a challenge token and returns the user ID
+// and token claims.
+func ParseChallengeToken(tokenString string) (int, *Claims, error) {
+	parsed := &challengeClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, parsed, func(token *jwt.Token) (interface{}, error) {
+		return secret(), nil
+	}, jwt.WithValidMethods([]string{"HS256"}), jwt.WithAudience(challengeAudience), jwt.WithExpirationRequired())
+	if err != nil {
+		return 0, nil, ErrInvalidChallenge
+	}
+
+	userID, err := strconv.Atoi(parsed.Subject)
+	if err != nil || userID == 0 {
+		return 0, nil, ErrInvalidChallenge
+	}
+
+	// Challenge tokens share the revocation list with access tokens so that
+	// each one is accepted once
+	claims := &Claims{UserID: userID, Generation: parsed.Generation, RegisteredClaims: parsed.RegisteredClaims}
+	revoked, err := IsRevoked(claims)
+	if err != nil {
+		return 0, nil, err
+	}
+	if revoked {
+		return 0, nil, ErrInvalidChallenge
+	}
+	return userID, claims, nil
+}
@@ -0,0 +1,143 @@
+package tokens
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"webcrawler/database"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Purposes of the tokens sent in emails. A token is only accepted for the
+// purpose it was issued for.
+const (
+	PurposeVerifyEmail   = "verify-email"
+	PurposeResetPassword = "reset-password"
+)
+
+// Lifetimes of emailed tokens.
+const (
+	VerifyEmailTTL   = 24 * time.Hour
+	ResetPasswordTTL = time.Hour
+)
+
+// ErrInvalidEmailToken is returned for tampered, expired, superseded or
+// already used email tokens.
+var ErrInvalidEmailToken = errors.New("invalid or expired link")
+
+// IssueEmailToken signs a single-use token for an email link. Earlier unused
+// tokens of the same user and purpose stop working.
+func IssueEmailToken(userID int, email, purpose string, ttl time.Duration) (string, error) {
+	if _, err := database.DB.Exec("DELETE FROM email_tokens WHERE expires_at < NOW()"); err != nil {
+		log.Printf("Failed to prune email tokens: %v", err)
+	}
+
+	now := time.Now()
+	claims := jwt.RegisteredClaims{
+		ID:        randomID(),
+		Subject:   strconv.Itoa(userID),
+		Audience:  jwt.ClaimStrings{purpose},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		"UPDATE email_tokens SET used_at = NOW() WHERE user_id = ? AND purpose = ? AND used_at IS NULL",
+		userID, purpose,
+	)
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.Exec(
+		"INSERT INTO email_tokens (jti, user_id, purpose, email, expires_at) VALUES (?, ?, ?, ?, ?)",
+		claims.ID, userID, purpose, email, claims.ExpiresAt.Time,
+	)
+	if err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(secret())
+}
+
+// PeekEmailToken checks an email token without using it up, e.g. to
+// validate the rest of a request first. It returns the user and the email
+// address the token was sent to.
+func PeekEmailToken(tokenString, purpose string) (int, string, error) {
+	claims, err := parseEmailToken(tokenString, purpose)
+	if err != nil {
+		return 0, "", err
+	}
+
+	var userID int
+	var email string
+	err = database.DB.QueryRow(
+		"SELECT user_id, email FROM email_tokens WHERE jti = ? AND purpose = ? AND used_at IS NULL AND expires_at > NOW()",
+		claims.ID, purpose,
+	).Scan(&userID, &email)
+	if err == sql.ErrNoRows {
+		return 0, "", ErrInvalidEmailToken
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	if strconv.Itoa(userID) != claims.Subject {
+		return 0, "", ErrInvalidEmailToken
+	}
+	return userID, email, nil
+}
+
+// ConsumeEmailToken checks an email token and marks it used. It returns the
+// user and the email address the token was sent to.
+func ConsumeEmailToken(tokenString, purpose string) (int, string, error) {
+	claims, err := parseEmailToken(tokenString, purpose)
+	if err != nil {
+		return 0, "", err
+	}
+
+	result, err := database.DB.Exec(
+		"UPDATE email_tokens SET used_at = NOW() WHERE jti = ? AND purpose = ? AND used_at IS NULL AND expires_at > NOW()",
+		claims.ID, purpose,
+	)
+	if err != nil {
+		return 0, "", err
+	}
+	if rows, _ := result.RowsAffected(); rows != 1 {
+		return 0, "", ErrInvalidEmailToken
+	}
+
+	var userID int
+	var email string
+	err = database.DB.QueryRow("SELECT user_id, email FROM email_tokens WHERE jti = ?", claims.ID).Scan(&userID, &email)
+	if err != nil {
+		return 0, "", err
+	}
+	if strconv.Itoa(userID) != claims.Subject {
+		return 0, "", ErrInvalidEmailToken
+	}
+	return userID, email, nil
+}
+
+func parseEmailToken(tokenString, purpose string) (*jwt.RegisteredClaims, error) {
+	claims := &jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return secret(), nil
+	}, jwt.WithValidMethods([]string{"HS256"}), jwt.WithAudience(purpose), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, ErrInvalidEmailToken
+	}
+	return claims, nil
+}
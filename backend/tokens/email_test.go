@@ -0,0 +1,91 @@
+package tokens
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEmailTokenIsSingleUse(t *testing.T) {
+	useTokenStore(t, 1)
+
+	token, err := IssueEmailToken(1, "alice@example.com", PurposeResetPassword, ResetPasswordTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Peeking leaves the token usable
+	for range 2 {
+		if userID, email, err := PeekEmailToken(token, PurposeResetPassword); err != nil || userID != 1 || email != "alice@example.com" {
+			t.Fatalf("peek: got (%d, %q, %v)", userID, email, err)
+		}
+	}
+	if userID, email, err := ConsumeEmailToken(token, PurposeResetPassword); err != nil || userID != 1 || email != "alice@example.com" {
+		t.Fatalf("consume: got (%d, %q, %v)", userID, email, err)
+	}
+	if _, _, err := ConsumeEmailToken(token, PurposeResetPassword); !errors.Is(err, ErrInvalidEmailToken) {
+		t.Errorf("second use: got %v, want ErrInvalidEmailToken", err)
+	}
+	if _, _, err := PeekEmailToken(token, PurposeResetPassword); !errors.Is(err, ErrInvalidEmailToken) {
+		t.Errorf("peek after use: got %v, want ErrInvalidEmailToken", err)
+	}
+}
+
+func TestEmailTokenSuperseded(t *testing.T) {
+	useTokenStore(t, 1)
+
+	first, err := IssueEmailToken(1, "alice@example.com", PurposeVerifyEmail, VerifyEmailTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reset, err := IssueEmailToken(1, "alice@example.com", PurposeResetPassword, ResetPasswordTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := IssueEmailToken(1, "alice@new.example", PurposeVerifyEmail, VerifyEmailTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := ConsumeEmailToken(first, PurposeVerifyEmail); !errors.Is(err, ErrInvalidEmailToken) {
+		t.Errorf("superseded token: got %v, want ErrInvalidEmailToken", err)
+	}
+	if _, email, err := ConsumeEmailToken(second, PurposeVerifyEmail); err != nil || email != "alice@new.example" {
+		t.Errorf("latest token: got (%q, %v)", email, err)
+	}
+	// Tokens for another purpose are not superseded
+	if _, _, err := ConsumeEmailToken(reset, PurposeResetPassword); err != nil {
+		t.Errorf("reset token: %v", err)
+	}
+}
+
+func TestEmailTokenPurposeAndExpiry(t *testing.T) {
+	store := useTokenStore(t, 1)
+
+	token, err := IssueEmailToken(1, "alice@example.com", PurposeVerifyEmail, VerifyEmailTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ConsumeEmailToken(token, PurposeResetPassword); !errors.Is(err, ErrInvalidEmailToken) {
+		t.Errorf("other purpose: got %v, want ErrInvalidEmailToken", err)
+	}
+	if _, _, err := ConsumeEmailToken(token+"x", PurposeVerifyEmail); !errors.Is(err, ErrInvalidEmailToken) {
+		t.Errorf("tampered token: got %v, want ErrInvalidEmailToken", err)
+	}
+
+	// The stored expiry counts even while the signed one has not passed
+	for _, row := range store.email {
+		row.expiresAt = time.Now().Add(-time.Second)
+	}
+	if _, _, err := ConsumeEmailToken(token, PurposeVerifyEmail); !errors.Is(err, ErrInvalidEmailToken) {
+		t.Errorf("expired token: got %v, want ErrInvalidEmailToken", err)
+	}
+
+	expired, err := IssueEmailToken(1, "alice@example.com", PurposeVerifyEmail, -time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := PeekEmailToken(expired, PurposeVerifyEmail); !errors.Is(err, ErrInvalidEmailToken) {
+		t.Errorf("token past its signed expiry: got %v, want ErrInvalidEmailToken", err)
+	}
+}
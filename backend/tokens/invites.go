@@ -0,0 +1,21 @@
+package tokens
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"time"
+)
+
+// InviteTTL is how long an organization invitation can be accepted.
+const InviteTTL = 7 * 24 * time.Hour
+
+// NewInviteToken generates the token mailed with an invitation and the hash
+// to store for it.
+func NewInviteToken() (token, hash string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(buf)
+	return token, Hash(token), nil
+}
@@ -0,0 +1,305 @@
+package tokens
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"webcrawler/database"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	defaultAccessTTLMinutes = 15
+	defaultRefreshTTLDays   = 30
+)
+
+var (
+	// ErrInvalidRefreshToken is returned for unknown or expired refresh tokens.
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+	// ErrRefreshTokenReused is returned when an already rotated refresh token
+	// is presented again. The whole session is revoked since the token has
+	// probably leaked.
+	ErrRefreshTokenReused = errors.New("refresh token has already been used")
+
+	// ErrSessionRevoked is returned when an access token is requested for a
+	// session that was revoked in the meantime.
+	ErrSessionRevoked = errors.New("session has been revoked")
+)
+
+// Claims are the claims carried by access tokens.
+type Claims struct {
+	UserID    int    `json:"user_id"`
+	Username  string `json:"username"`
+	SessionID string `json:"sid,omitempty"`
+	// Generation is the user's token generation at issue time. Logging out
+	// all sessions increments it, which revokes every older token.
+	Generation int `json:"gen,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// AccessTTL is the lifetime of access tokens, ACCESS_TOKEN_TTL_MINUTES.
+func AccessTTL() time.Duration {
+	return time.Duration(envInt("ACCESS_TOKEN_TTL_MINUTES", defaultAccessTTLMinutes)) * time.Minute
+}
+
+// RefreshTTL is the lifetime of refresh tokens, REFRESH_TOKEN_TTL_DAYS.
+func RefreshTTL() time.Duration {
+	return time.Duration(envInt("REFRESH_TOKEN_TTL_DAYS", defaultRefreshTTLDays)) * 24 * time.Hour
+}
+
+// IssueAccessToken signs a short-lived access token for a login session.
+func IssueAccessToken(userID int, username, sessionID string) (string, error) {
+	// Reading the generation together with the session's refresh tokens
+	// makes sure a concurrent RevokeAllSessions either revokes this token
+	// or prevents it from being issued
+	var generation int
+	var live bool
+	query := `
+		SELECT u.token_generation,
+			EXISTS(SELECT 1 FROM refresh_tokens WHERE session_id = ? AND user_id = u.id AND revoked_at IS NULL)
+		FROM users u
+		WHERE u.id = ?
+	`
+	err := database.DB.QueryRow(query, sessionID, userID).Scan(&generation, &live)
+	if err == sql.ErrNoRows || err == nil && !live {
+		return "", ErrSessionRevoked
+	}
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := Claims{
+		UserID:     userID,
+		Username:   username,
+		SessionID:  sessionID,
+		Generation: generation,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        randomID(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTTL())),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(secret())
+}
+
+// ParseAccessToken validates an access token's signature and expiry.
+func ParseAccessToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		// Make sure the token method is HMAC
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return secret(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid || claims.UserID == 0 {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+	return claims, nil
+}
+
+// IsRevoked reports whether an access token was revoked by logout, by
+// logging out all sessions, or because its user no longer exists.
+func IsRevoked(claims *Claims) (bool, error) {
+	var revokedAt sql.NullTime
+	var generation int
+	var listed bool
+	query := `
+		SELECT u.sessions_revoked_at, u.token_generation, EXISTS(SELECT 1 FROM revoked_tokens WHERE jti = ?)
+		FROM users u
+		WHERE u.id = ?
+	`
+	err := database.DB.QueryRow(query, claims.ID, claims.UserID).Scan(&revokedAt, &generation, &listed)
+	if err == sql.ErrNoRows {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if listed || claims.Generation < generation {
+		return true, nil
+	}
+	// Tokens issued before generations were introduced carry none
+	if claims.Generation == 0 && revokedAt.Valid && claims.IssuedAt != nil && !claims.IssuedAt.After(revokedAt.Time) {
+		return true, nil
+	}
+	return false, nil
+}
+
+// RevokeAccessToken adds an access token to the revocation list until it
+// expires.
+func RevokeAccessToken(claims *Claims) error {
+	// Entries are only needed until the token would have expired anyway
+	if _, err := database.DB.Exec("DELETE FROM revoked_tokens WHERE expires_at < NOW()"); err != nil {
+		log.Printf("Failed to prune revoked tokens: %v", err)
+	}
+
+	expiresAt := time.Now().Add(AccessTTL())
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time
+	}
+	_, err := database.DB.Exec("INSERT IGNORE INTO revoked_tokens (jti, expires_at) VALUES (?, ?)", claims.ID, expiresAt)
+	return err
+}
+
+// StartSession creates a login session and returns its ID and first refresh
+// token.
+func StartSession(userID int) (string, string, error) {
+	sessionID := randomID()
+	refreshToken, err := storeRefreshToken(database.DB, userID, sessionID)
+	if err != nil {
+		return "", "", err
+	}
+	return sessionID, refreshToken, nil
+}
+
+// Rotate exchanges a refresh token for a new one in the same session. Each
+// refresh token can be used once; presenting a used token revokes the
+// session.
+func Rotate(refreshToken string) (userID int, sessionID string, newToken string, err error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, "", "", err
+	}
+	defer tx.Rollback()
+
+	var id int
+	var expiresAt time.Time
+	var revokedAt sql.NullTime
+	query := `
+		SELECT id, user_id, session_id, expires_at, revoked_at
+		FROM refresh_tokens
+		WHERE token_hash = ?
+		FOR UPDATE
+	`
+	err = tx.QueryRow(query, Hash(refreshToken)).Scan(&id, &userID, &sessionID, &expiresAt, &revokedAt)
+	if err == sql.ErrNoRows {
+		return 0, "", "", ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return 0, "", "", err
+	}
+
+	if revokedAt.Valid {
+		if _, err := tx.Exec("UPDATE refresh_tokens SET revoked_at = NOW() WHERE session_id = ? AND revoked_at IS NULL", sessionID); err != nil {
+			return 0, "", "", err
+		}
+		if err := tx.Commit(); err != nil {
+			return 0, "", "", err
+		}
+		return 0, "", "", ErrRefreshTokenReused
+	}
+	if time.Now().After(expiresAt) {
+		return 0, "", "", ErrInvalidRefreshToken
+	}
+
+	if _, err := tx.Exec("UPDATE refresh_tokens SET revoked_at = NOW() WHERE id = ?", id); err != nil {
+		return 0, "", "", err
+	}
+	newToken, err = storeRefreshToken(tx, userID, sessionID)
+	if err != nil {
+		return 0, "", "", err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, "", "", err
+	}
+	return userID, sessionID, newToken, nil
+}
+
+// RevokeSession revokes the refresh tokens of one login session.
+func RevokeSession(userID int, sessionID string) error {
+	_, err := database.DB.Exec(
+		"UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = ? AND session_id = ? AND revoked_at IS NULL",
+		userID, sessionID,
+	)
+	return err
+}
+
+// RevokeAllSessions revokes every refresh token of a user and every access
+// token issued so far.
+func RevokeAllSessions(userID int) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE users SET sessions_revoked_at = NOW(), token_generation = token_generation + 1 WHERE id = ?", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = ? AND revoked_at IS NULL", userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func storeRefreshToken(db execer, userID int, sessionID string) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+
+	_, err := db.Exec(
+		"INSERT INTO refresh_tokens (user_id, session_id, token_hash, expires_at) VALUES (?, ?, ?, ?)",
+		userID, sessionID, Hash(token), time.Now().Add(RefreshTTL()),
+	)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Hash returns the SHA-256 hex digest under which a token is stored.
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}
+
+func secret() []byte {
+	return []byte(os.Getenv("JWT_SECRET"))
+}
+
+func envInt(key string, fallback int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		log.Printf("Invalid value for %s: %q, using %d", key, value, fallback)
+		return fallback
+	}
+	return n
+}
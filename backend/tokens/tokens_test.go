@@ -0,0 +1,495 @@
+package tokens
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"webcrawler/database"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type userRow struct {
+	generation int
+	revokedAt  *time.Time
+	disabled   bool
+}
+
+type refreshRow struct {
+	id        int
+	userID    int
+	sessionID string
+	expiresAt time.Time
+	revokedAt *time.Time
+}
+
+type apiKeyRow struct {
+	id        int
+	userID    int
+	scopes    string
+	expiresAt *time.Time
+	revoked   bool
+	used      int
+}
+
+type emailRow struct {
+	userID    int
+	purpose   string
+	email     string
+	expiresAt time.Time
+	used      bool
+}
+
+// tokenStore stands in for the users, refresh_tokens, revoked_tokens,
+// email_tokens and api_keys rows the package reads and updates. Transactions are applied
+// immediately and cannot be rolled back.
+type tokenStore struct {
+	mu      sync.Mutex
+	users   map[int]*userRow
+	refresh map[string]*refreshRow
+	revoked map[string]time.Time
+	email   map[string]*emailRow
+	apiKeys map[string]*apiKeyRow
+	nextID  int
+}
+
+func (s *tokenStore) Connect(context.Context) (driver.Conn, error) { return s, nil }
+func (s *tokenStore) Driver() driver.Driver                        { return nil }
+
+func (s *tokenStore) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements not supported")
+}
+func (s *tokenStore) Close() error              { return nil }
+func (s *tokenStore) Begin() (driver.Tx, error) { return s, nil }
+func (s *tokenStore) Commit() error             { return nil }
+func (s *tokenStore) Rollback() error           { return nil }
+
+func (s *tokenStore) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	query = strings.Join(strings.Fields(query), " ")
+
+	switch {
+	case strings.HasPrefix(query, "SELECT u.token_generation, EXISTS(SELECT 1 FROM refresh_tokens"):
+		sessionID, userID := args[0].Value.(string), int(args[1].Value.(int64))
+		user, ok := s.users[userID]
+		if !ok {
+			return &fakeRows{}, nil
+		}
+		live := false
+		for _, row := range s.refresh {
+			if row.sessionID == sessionID && row.userID == userID && row.revokedAt == nil {
+				live = true
+			}
+		}
+		return &fakeRows{values: [][]driver.Value{{int64(user.generation), live}}}, nil
+
+	case strings.HasPrefix(query, "SELECT u.sessions_revoked_at, u.token_generation"):
+		jti, userID := args[0].Value.(string), int(args[1].Value.(int64))
+		user, ok := s.users[userID]
+		if !ok {
+			return &fakeRows{}, nil
+		}
+		var revokedAt driver.Value
+		if user.revokedAt != nil {
+			revokedAt = *user.revokedAt
+		}
+		_, listed := s.revoked[jti]
+		return &fakeRows{values: [][]driver.Value{{revokedAt, int64(user.generation), listed}}}, nil
+
+	case strings.HasPrefix(query, "SELECT token_generation FROM users"):
+		user, ok := s.users[int(args[0].Value.(int64))]
+		if !ok {
+			return &fakeRows{}, nil
+		}
+		return &fakeRows{values: [][]driver.Value{{int64(user.generation)}}}, nil
+
+	case strings.HasPrefix(query, "SELECT id, user_id, session_id, expires_at, revoked_at FROM refresh_tokens"):
+		row, ok := s.refresh[args[0].Value.(string)]
+		if !ok {
+			return &fakeRows{}, nil
+		}
+		var revokedAt driver.Value
+		if row.revokedAt != nil {
+			revokedAt = *row.revokedAt
+		}
+		return &fakeRows{values: [][]driver.Value{{int64(row.id), int64(row.userID), row.sessionID, row.expiresAt, revokedAt}}}, nil
+
+	case strings.HasPrefix(query, "SELECT k.id, k.user_id, u.username, k.scopes, k.expires_at FROM api_keys k"):
+		row, ok := s.apiKeys[args[0].Value.(string)]
+		if !ok || row.revoked || s.users[row.userID] == nil || s.users[row.userID].disabled {
+			return &fakeRows{}, nil
+		}
+		var expiresAt driver.Value
+		if row.expiresAt != nil {
+			expiresAt = *row.expiresAt
+		}
+		return &fakeRows{values: [][]driver.Value{{int64(row.id), int64(row.userID), "alice", row.scopes, expiresAt}}}, nil
+
+	case strings.HasPrefix(query, "SELECT user_id, email FROM email_tokens"):
+		row, ok := s.email[args[0].Value.(string)]
+		if !ok || strings.Contains(query, "used_at IS NULL") && (row.used || row.purpose != args[1].Value.(string) || !row.expiresAt.After(time.Now())) {
+			return &fakeRows{}, nil
+		}
+		return &fakeRows{values: [][]driver.Value{{int64(row.userID), row.email}}}, nil
+	}
+	return nil, errors.New("unexpected query: " + query)
+}
+
+func (s *tokenStore) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+
+	var affected int64
+	switch {
+	case strings.HasPrefix(query, "INSERT INTO refresh_tokens"):
+		s.nextID++
+		s.refresh[args[2].Value.(string)] = &refreshRow{
+			id:        s.nextID,
+			userID:    int(args[0].Value.(int64)),
+			sessionID: args[1].Value.(string),
+			expiresAt: args[3].Value.(time.Time),
+		}
+		affected = 1
+
+	case strings.HasPrefix(query, "UPDATE refresh_tokens SET revoked_at = NOW() WHERE id = ?"):
+		for _, row := range s.refresh {
+			if row.id == int(args[0].Value.(int64)) {
+				row.revokedAt = &now
+				affected++
+			}
+		}
+
+	case strings.HasPrefix(query, "UPDATE refresh_tokens SET revoked_at = NOW() WHERE session_id = ?"):
+		for _, row := range s.refresh {
+			if row.sessionID == args[0].Value.(string) && row.revokedAt == nil {
+				row.revokedAt = &now
+				affected++
+			}
+		}
+
+	case strings.HasPrefix(query, "UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = ?"):
+		userID := int(args[0].Value.(int64))
+		for _, row := range s.refresh {
+			if row.userID == userID && row.revokedAt == nil && (len(args) == 1 || row.sessionID == args[1].Value.(string)) {
+				row.revokedAt = &now
+				affected++
+			}
+		}
+
+	case strings.HasPrefix(query, "UPDATE users SET sessions_revoked_at = NOW(), token_generation = token_generation + 1"):
+		if user, ok := s.users[int(args[0].Value.(int64))]; ok {
+			user.revokedAt = &now
+			user.generation++
+			affected = 1
+		}
+
+	case strings.HasPrefix(query, "DELETE FROM revoked_tokens"):
+		for jti, expiresAt := range s.revoked {
+			if expiresAt.Before(now) {
+				delete(s.revoked, jti)
+				affected++
+			}
+		}
+
+	case strings.HasPrefix(query, "INSERT IGNORE INTO revoked_tokens"):
+		jti := args[0].Value.(string)
+		if _, ok := s.revoked[jti]; !ok {
+			s.revoked[jti] = args[1].Value.(time.Time)
+			affected = 1
+		}
+
+	case strings.HasPrefix(query, "DELETE FROM email_tokens"):
+		for jti, row := range s.email {
+			if row.expiresAt.Before(now) {
+				delete(s.email, jti)
+				affected++
+			}
+		}
+
+	case strings.HasPrefix(query, "UPDATE email_tokens SET used_at = NOW() WHERE user_id = ?"):
+		for _, row := range s.email {
+			if row.userID == int(args[0].Value.(int64)) && row.purpose == args[1].Value.(string) && !row.used {
+				row.used = true
+				affected++
+			}
+		}
+
+	case strings.HasPrefix(query, "UPDATE email_tokens SET used_at = NOW() WHERE jti = ?"):
+		row, ok := s.email[args[0].Value.(string)]
+		if ok && row.purpose == args[1].Value.(string) && !row.used && row.expiresAt.After(now) {
+			row.used = true
+			affected = 1
+		}
+
+	case strings.HasPrefix(query, "UPDATE api_keys SET last_used_at"):
+		for _, row := range s.apiKeys {
+			if row.id == int(args[0].Value.(int64)) {
+				row.used++
+				affected = 1
+			}
+		}
+
+	case strings.HasPrefix(query, "INSERT INTO email_tokens"):
+		s.email[args[0].Value.(string)] = &emailRow{
+			userID:    int(args[1].Value.(int64)),
+			purpose:   args[2].Value.(string),
+			email:     args[3].Value.(string),
+			expiresAt: args[4].Value.(time.Time),
+		}
+		affected = 1
+
+	default:
+		return nil, errors.New("unexpected statement: " + query)
+	}
+	return driver.RowsAffected(affected), nil
+}
+
+type fakeRows struct {
+	values [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	if len(r.values) == 0 {
+		return nil
+	}
+	return make([]string, len(r.values[0]))
+}
+func (r *fakeRows) Close() error { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+// useTokenStore points the database at an empty store with the given users.
+func useTokenStore(t *testing.T, userIDs ...int) *tokenStore {
+	t.Helper()
+	t.Setenv("JWT_SECRET", "test-secret")
+	store := &tokenStore{
+		users:   map[int]*userRow{},
+		refresh: map[string]*refreshRow{},
+		revoked: map[string]time.Time{},
+		email:   map[string]*emailRow{},
+		apiKeys: map[string]*apiKeyRow{},
+	}
+	for _, id := range userIDs {
+		store.users[id] = &userRow{}
+	}
+
+	saved := database.DB
+	database.DB = sql.OpenDB(store)
+	t.Cleanup(func() {
+		database.DB.Close()
+		database.DB = saved
+	})
+	return store
+}
+
+// login starts a session for the user and returns its access token claims
+// and refresh token.
+func login(t *testing.T, userID int) (*Claims, string) {
+	t.Helper()
+	sessionID, refreshToken, err := StartSession(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := accessClaims(t, userID, sessionID)
+	return claims, refreshToken
+}
+
+func accessClaims(t *testing.T, userID int, sessionID string) *Claims {
+	t.Helper()
+	accessToken, err := IssueAccessToken(userID, "alice", sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := ParseAccessToken(accessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return claims
+}
+
+func assertRevoked(t *testing.T, name string, claims *Claims, want bool) {
+	t.Helper()
+	revoked, err := IsRevoked(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked != want {
+		t.Errorf("%s: revoked = %v, want %v", name, revoked, want)
+	}
+}
+
+func TestRevokeAllSessions(t *testing.T) {
+	useTokenStore(t, 1, 2)
+
+	first, _ := login(t, 1)
+	second, _ := login(t, 1)
+	other, _ := login(t, 2)
+	if err := RevokeAllSessions(1); err != nil {
+		t.Fatal(err)
+	}
+
+	// The tokens were issued within the second of the revocation
+	assertRevoked(t, "first session", first, true)
+	assertRevoked(t, "second session", second, true)
+	assertRevoked(t, "other user", other, false)
+
+	// A session started right after, as on a password change, stays valid
+	fresh, _ := login(t, 1)
+	assertRevoked(t, "new session", fresh, false)
+}
+
+func TestNoAccessTokenForRevokedSession(t *testing.T) {
+	useTokenStore(t, 1)
+
+	sessionID, refreshToken, err := StartSession(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, _, err = Rotate(refreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Logging out everywhere between the rotation and issuing the access
+	// token must not let one through
+	if err := RevokeAllSessions(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := IssueAccessToken(1, "alice", sessionID); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("got %v, want ErrSessionRevoked", err)
+	}
+}
+
+func TestRevokeAccessToken(t *testing.T) {
+	useTokenStore(t, 1)
+
+	claims, _ := login(t, 1)
+	other, _ := login(t, 1)
+	if err := RevokeAccessToken(claims); err != nil {
+		t.Fatal(err)
+	}
+	assertRevoked(t, "revoked token", claims, true)
+	assertRevoked(t, "other token", other, false)
+}
+
+func TestRevokedForDeletedUser(t *testing.T) {
+	store := useTokenStore(t, 1)
+
+	claims, _ := login(t, 1)
+	delete(store.users, 1)
+	assertRevoked(t, "deleted user", claims, true)
+}
+
+func TestLegacyTokenRevocation(t *testing.T) {
+	store := useTokenStore(t, 1)
+
+	// Tokens without a generation fall back to the revocation time
+	revokedAt := time.Now().Truncate(time.Second)
+	store.users[1].revokedAt = &revokedAt
+	for name, tt := range map[string]struct {
+		issuedAt time.Time
+		want     bool
+	}{
+		"before":      {revokedAt.Add(-time.Minute), true},
+		"same second": {revokedAt, true},
+		"after":       {revokedAt.Add(time.Second), false},
+	} {
+		claims := &Claims{UserID: 1, RegisteredClaims: jwt.RegisteredClaims{
+			ID:       randomID(),
+			IssuedAt: jwt.NewNumericDate(tt.issuedAt),
+		}}
+		assertRevoked(t, name, claims, tt.want)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	useTokenStore(t, 1)
+
+	sessionID, refreshToken, err := StartSession(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID, rotatedSession, next, err := Rotate(refreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userID != 1 || rotatedSession != sessionID || next == refreshToken {
+		t.Fatalf("got (%d, %s, %s)", userID, rotatedSession, next)
+	}
+
+	// Replaying the old token revokes the whole session
+	if _, _, _, err := Rotate(refreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("replay: got %v, want ErrRefreshTokenReused", err)
+	}
+	if _, _, _, err := Rotate(next); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Errorf("after replay: got %v, want ErrRefreshTokenReused", err)
+	}
+	if _, _, _, err := Rotate("unknown"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("unknown token: got %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+func TestRotateExpired(t *testing.T) {
+	store := useTokenStore(t, 1)
+
+	_, refreshToken, err := StartSession(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.refresh[Hash(refreshToken)].expiresAt = time.Now().Add(-time.Second)
+	if _, _, _, err := Rotate(refreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("got %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+func TestParseAccessToken(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+
+	sign := func(claims Claims, method jwt.SigningMethod, key interface{}) string {
+		token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	now := time.Now()
+	valid := Claims{UserID: 1, RegisteredClaims: jwt.RegisteredClaims{
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+	}}
+	expired := valid
+	expired.ExpiresAt = jwt.NewNumericDate(now.Add(-time.Second))
+	anonymous := valid
+	anonymous.UserID = 0
+
+	if _, err := ParseAccessToken(sign(valid, jwt.SigningMethodHS256, secret())); err != nil {
+		t.Errorf("valid token: %v", err)
+	}
+	for name, token := range map[string]string{
+		"expired":   sign(expired, jwt.SigningMethodHS256, secret()),
+		"no user":   sign(anonymous, jwt.SigningMethodHS256, secret()),
+		"wrong key": sign(valid, jwt.SigningMethodHS256, []byte("other-secret")),
+		"unsigned":  sign(valid, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType),
+		"not a jwt": "not-a-token",
+		"empty":     "",
+	} {
+		if _, err := ParseAccessToken(token); err == nil {
+			t.Errorf("%s token accepted", name)
+		}
+	}
+}
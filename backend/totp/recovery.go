@@ -0,0 +1,36 @@
+package totp
+
+import (
+	"crypto/rand"
+	"strings"
+)
+
+// RecoveryCodeCount is how many recovery codes are issued at a time.
+const RecoveryCodeCount = 10
+
+// recoveryAlphabet leaves out characters that are easily confused.
+const recoveryAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// NewRecoveryCodes returns a fresh set of single-use recovery codes in the
+// form xxxxx-xxxxx.
+func NewRecoveryCodes() ([]string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		buf := make([]byte, 10)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		for j, b := range buf {
+			buf[j] = recoveryAlphabet[int(b)%len(recoveryAlphabet)]
+		}
+		codes[i] = string(buf[:5]) + "-" + string(buf[5:])
+	}
+	return codes, nil
+}
+
+// NormalizeRecoveryCode strips the separators and case a user may have
+// typed so the code can be compared with its stored hash.
+func NormalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
@@ -0,0 +1,54 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewRecoveryCodes(t *testing.T) {
+	codes, err := NewRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != RecoveryCodeCount {
+		t.Fatalf("%d codes, want %d", len(codes), RecoveryCodeCount)
+	}
+
+	seen := map[string]bool{}
+	for _, code := range codes {
+		first, second, ok := strings.Cut(code, "-")
+		if !ok || len(first) != 5 || len(second) != 5 {
+			t.Errorf("code %q not in the form xxxxx-xxxxx", code)
+		}
+		for _, r := range first + second {
+			if !strings.ContainsRune(recoveryAlphabet, r) {
+				t.Errorf("code %q uses %q", code, r)
+			}
+		}
+		if IsCode(code) {
+			t.Errorf("code %q mistaken for a TOTP code", code)
+		}
+		if seen[code] {
+			t.Errorf("code %q issued twice", code)
+		}
+		seen[code] = true
+	}
+}
+
+func TestNormalizeRecoveryCode(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"abcde-fghjk", "abcdefghjk"},
+		{"ABCDE-FGHJK", "abcdefghjk"},
+		{"abcdefghjk", "abcdefghjk"},
+		{"abcde fghjk", "abcdefghjk"},
+		{" abc-de fg-hjk ", "abcdefghjk"},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeRecoveryCode(tt.in); got != tt.want {
+			t.Errorf("NormalizeRecoveryCode(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
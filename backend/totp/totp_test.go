@@ -0,0 +1,138 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key of the RFC 6238 test vectors,
+// "12345678901234567890", base32 encoded.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	// RFC 6238 appendix B, truncated to six digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.code {
+			t.Errorf("code at %d = %s, want %s", tt.unix, got, tt.code)
+		}
+	}
+
+	// Secrets are accepted in lower case too
+	if got, _ := Code("gezdgnbvgy3tqojqgezdgnbvgy3tqojq", Step(time.Unix(59, 0))); got != "287082" {
+		t.Errorf("lower-case secret gave %s", got)
+	}
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Error("invalid secret accepted")
+	}
+}
+
+func TestValidateSkew(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+
+	tests := []struct {
+		name  string
+		step  int64
+		valid bool
+	}{
+		{"current step", current, true},
+		{"previous step", current - 1, true},
+		{"next step", current + 1, true},
+		{"two steps behind", current - 2, false},
+		{"two steps ahead", current + 2, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _ := Code(rfcSecret, tt.step)
+			step, ok := Validate(rfcSecret, code, now, -1)
+			if ok != tt.valid {
+				t.Fatalf("valid = %v, want %v", ok, tt.valid)
+			}
+			if ok && step != tt.step {
+				t.Errorf("matched step %d, want %d", step, tt.step)
+			}
+		})
+	}
+}
+
+func TestValidateInput(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+
+	tests := []struct {
+		code  string
+		valid bool
+	}{
+		{"050471", true},
+		{"050 471", true},
+		{" 050471 ", true},
+		{"050472", false},
+		{"50471", false},
+		{"0504710", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if _, ok := Validate(rfcSecret, tt.code, now, -1); ok != tt.valid {
+			t.Errorf("Validate(%q) = %v, want %v", tt.code, ok, tt.valid)
+		}
+	}
+}
+
+func TestValidateRejectsReplay(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+	code, _ := Code(rfcSecret, current)
+
+	step, ok := Validate(rfcSecret, code, now, -1)
+	if !ok {
+		t.Fatal("fresh code rejected")
+	}
+
+	// Once its step is recorded the code is spent, and so are older ones
+	if _, ok := Validate(rfcSecret, code, now, step); ok {
+		t.Error("code accepted twice")
+	}
+	previous, _ := Code(rfcSecret, current-1)
+	if _, ok := Validate(rfcSecret, previous, now, step); ok {
+		t.Error("code older than the last used one accepted")
+	}
+
+	// The next code is still good within the skew window
+	next, _ := Code(rfcSecret, current+1)
+	if got, ok := Validate(rfcSecret, next, now, step); !ok || got != current+1 {
+		t.Errorf("next code: got (%d, %v)", got, ok)
+	}
+}
+
+func TestIsCode(t *testing.T) {
+	tests := map[string]bool{
+		"123456":      true,
+		"123 456":     true,
+		"12345":       false,
+		"12345a":      false,
+		"abcde-fghjk": false,
+		"１２３４５６":      false,
+	}
+	for input, want := range tests {
+		if got := IsCode(input); got != want {
+			t.Errorf("IsCode(%q) = %v, want %v", input, got, want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package urlnorm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// Canonicalize returns the canonical form of an absolute http(s) URL so that
+// trivially different spellings of the same address compare equal.
+func Canonicalize(rawURL string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", err
+	}
+
+	if err := CanonicalizeURL(u); err != nil {
+		return "", err
+	}
+
+	return u.String(), nil
+}
+
+// CanonicalizeURL normalizes u in place:
+//   - lowercase scheme and host, IDN hosts converted to punycode
+//   - default ports (:80 for http, :443 for https) removed
+//   - empty path becomes "/", trailing slash removed from other paths
+//   - fragment stripped
+//   - query parameters sorted by key, as written
+func CanonicalizeURL(u *url.URL) error {
+	u.Scheme = strings.ToLower(u.Scheme)
+	if _, ok := defaultPorts[u.Scheme]; !ok {
+		return fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+
+	hostname := strings.TrimSuffix(u.Hostname(), ".")
+	if hostname == "" {
+		return fmt.Errorf("missing host")
+	}
+
+	// IP literals are left as-is, everything else goes through IDNA
+	if net.ParseIP(hostname) == nil {
+		ascii, err := idna.Lookup.ToASCII(hostname)
+		if err != nil {
+			return fmt.Errorf("invalid host %q: %v", hostname, err)
+		}
+		hostname = ascii
+	}
+	hostname = strings.ToLower(hostname)
+
+	port := u.Port()
+	if port == defaultPorts[u.Scheme] {
+		port = ""
+	}
+
+	if port != "" || strings.Contains(hostname, ":") {
+		u.Host = net.JoinHostPort(hostname, port)
+		if port == "" {
+			// IPv6 literal without a port
+			u.Host = strings.TrimSuffix(u.Host, ":")
+		}
+	} else {
+		u.Host = hostname
+	}
+
+	if u.Path == "" {
+		u.Path = "/"
+	} else if len(u.Path) > 1 {
+		u.Path = strings.TrimRight(u.Path, "/")
+		if u.Path == "" {
+			u.Path = "/"
+		}
+	}
+	u.RawPath = ""
+
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	u.RawQuery = sortQuery(u.RawQuery)
+	u.ForceQuery = false
+
+	return nil
+}
+
+// sortQuery orders the query's pairs by key, keeping the order of repeated
+// keys. Pairs are compared and kept exactly as written: decoding them would
+// merge queries the server may tell apart, such as "a" and "a=", or drop
+// pairs containing ';'.
+func sortQuery(rawQuery string) string {
+	var pairs []string
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair != "" {
+			pairs = append(pairs, pair)
+		}
+	}
+
+	key := func(pair string) string {
+		k, _, _ := strings.Cut(pair, "=")
+		return k
+	}
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return key(pairs[i]) < key(pairs[j])
+	})
+	return strings.Join(pairs, "&")
+}
+
+// Hash returns a fixed-length key for a canonical URL, suitable for a unique index.
+func Hash(canonicalURL string) string {
+	sum := sha256.Sum256([]byte(canonicalURL))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,107 @@
+package urlnorm
+
+import "testing"
+
+func TestCanonicalize(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		// Scheme and host case
+		{"HTTP://Example.COM/Path", "http://example.com/Path"},
+		{"  https://example.com/  ", "https://example.com/"},
+		{"https://example.com./", "https://example.com/"},
+
+		// Internationalized domain names
+		{"https://bücher.example/", "https://xn--bcher-kva.example/"},
+		{"https://BÜCHER.example/", "https://xn--bcher-kva.example/"},
+		{"https://xn--bcher-kva.example/", "https://xn--bcher-kva.example/"},
+
+		// Default ports
+		{"http://example.com:80/", "http://example.com/"},
+		{"https://example.com:443/", "https://example.com/"},
+		{"http://example.com:443/", "http://example.com:443/"},
+		{"https://example.com:8443/", "https://example.com:8443/"},
+		{"http://[::1]:80/", "http://[::1]/"},
+		{"http://[::1]:8080/", "http://[::1]:8080/"},
+		{"http://192.0.2.1:80/a", "http://192.0.2.1/a"},
+
+		// Paths
+		{"https://example.com", "https://example.com/"},
+		{"https://example.com/docs/", "https://example.com/docs"},
+		{"https://example.com/docs//", "https://example.com/docs"},
+		{"https://example.com/a%20b", "https://example.com/a%20b"},
+
+		// Fragments
+		{"https://example.com/page#section", "https://example.com/page"},
+		{"https://example.com/#", "https://example.com/"},
+
+		// Query parameters
+		{"https://example.com/?b=2&a=1", "https://example.com/?a=1&b=2"},
+		{"https://example.com/?a=2&a=1", "https://example.com/?a=2&a=1"},
+		{"https://example.com/?q=a+b", "https://example.com/?q=a+b"},
+		{"https://example.com/?q=a%20b", "https://example.com/?q=a%20b"},
+		{"https://example.com/?", "https://example.com/"},
+		{"https://example.com/?b=1&&a=2&", "https://example.com/?a=2&b=1"},
+
+		// Query pairs are kept as written
+		{"https://example.com/?b=1;c=2&a=3", "https://example.com/?a=3&b=1;c=2"},
+		{"https://example.com/?a", "https://example.com/?a"},
+		{"https://example.com/?a=", "https://example.com/?a="},
+		{"https://example.com/?path=%2Fdocs&x=%E2%9C%93", "https://example.com/?path=%2Fdocs&x=%E2%9C%93"},
+		{"https://example.com/?q=%41", "https://example.com/?q=%41"},
+	}
+
+	for _, tt := range tests {
+		got, err := Canonicalize(tt.in)
+		if err != nil {
+			t.Errorf("Canonicalize(%q): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Canonicalize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCanonicalizeRejects(t *testing.T) {
+	for _, in := range []string{
+		"ftp://example.com/",
+		"mailto:user@example.com",
+		"/relative/path",
+		"https:///path",
+		"https://exa mple.com/",
+	} {
+		if got, err := Canonicalize(in); err == nil {
+			t.Errorf("Canonicalize(%q) = %q, want an error", in, got)
+		}
+	}
+}
+
+func TestCanonicalizeKeepsDistinctQueries(t *testing.T) {
+	for _, pair := range [][2]string{
+		{"https://example.com/?a", "https://example.com/?a="},
+		{"https://example.com/?a=1;b=2", "https://example.com/"},
+		{"https://example.com/?path=%2F", "https://example.com/?path=/"},
+		{"https://example.com/?q=a%2Bb", "https://example.com/?q=a+b"},
+	} {
+		a, _ := Canonicalize(pair[0])
+		b, _ := Canonicalize(pair[1])
+		if a == b {
+			t.Errorf("%s and %s both canonicalize to %s", pair[0], pair[1], a)
+		}
+	}
+}
+
+func TestHash(t *testing.T) {
+	a, _ := Canonicalize("https://Example.com:443/docs/?b=2&a=1#top")
+	b, _ := Canonicalize("https://example.com/docs?a=1&b=2")
+	if Hash(a) != Hash(b) {
+		t.Errorf("equivalent URLs hash differently: %s, %s", a, b)
+	}
+	if len(Hash(a)) != 64 {
+		t.Errorf("hash length %d, want 64", len(Hash(a)))
+	}
+	if Hash(a) == Hash("https://example.com/other") {
+		t.Error("different URLs hash the same")
+	}
+}
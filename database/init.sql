@@ -9,22 +9,91 @@ CREATE TABLE IF NOT EXISTS users (
     username VARCHAR(255) UNIQUE NOT NULL,
     email VARCHAR(255) UNIQUE NOT NULL,
     password_hash VARCHAR(255) NOT NULL,
+    crawl_profile JSON,
+    sessions_revoked_at TIMESTAMP NULL,
+    token_generation INT NOT NULL DEFAULT 0,
+    oidc_issuer VARCHAR(255) NULL,
+    oidc_subject VARCHAR(255) NULL,
+    totp_secret VARCHAR(255) NULL,
+    totp_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    totp_last_step BIGINT NULL,
+    email_verified_at TIMESTAMP NULL DEFAULT NULL,
+    is_admin BOOLEAN NOT NULL DEFAULT FALSE,
+    disabled_at TIMESTAMP NULL DEFAULT NULL,
+    plan VARCHAR(20) NOT NULL DEFAULT 'free',
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE KEY uniq_oidc_identity (oidc_issuer, oidc_subject)
 );
 
--- URLs table
-CREATE TABLE IF NOT EXISTS urls (
+-- Organizations group users who share workspaces. Every user also has a
+-- personal organization, which is deleted with them
+CREATE TABLE IF NOT EXISTS organizations (
     id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    personal_user_id INT NULL UNIQUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (personal_user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS organization_members (
+    organization_id INT NOT NULL,
     user_id INT NOT NULL,
+    role ENUM('admin', 'editor', 'viewer') NOT NULL DEFAULT 'editor',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (organization_id, user_id),
+    FOREIGN KEY (organization_id) REFERENCES organizations(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    INDEX idx_user_id (user_id)
+);
+
+-- Pending invitations to join an organization, accepted by email link
+CREATE TABLE IF NOT EXISTS organization_invites (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    organization_id INT NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    role ENUM('admin', 'editor', 'viewer') NOT NULL DEFAULT 'editor',
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    invited_by INT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    accepted_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (organization_id) REFERENCES organizations(id) ON DELETE CASCADE,
+    FOREIGN KEY (invited_by) REFERENCES users(id) ON DELETE SET NULL,
+    INDEX idx_org_email (organization_id, email)
+);
+
+-- Workspaces hold the URLs; every member of the organization can use them
+CREATE TABLE IF NOT EXISTS workspaces (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    organization_id INT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (organization_id) REFERENCES organizations(id) ON DELETE CASCADE,
+    UNIQUE KEY uniq_org_name (organization_id, name)
+);
+
+-- URLs table. user_id is whoever added the URL; shared URLs outlive them
+CREATE TABLE IF NOT EXISTS urls (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NULL,
+    workspace_id INT NOT NULL,
     url TEXT NOT NULL,
+    url_hash CHAR(64),
+    crawl_profile JSON,
     status ENUM('queued', 'running', 'completed', 'failed') DEFAULT 'queued',
+    started_by INT NULL,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
-    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT fk_urls_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL,
+    CONSTRAINT fk_urls_workspace FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE,
     INDEX idx_user_id (user_id),
     INDEX idx_status (status),
-    INDEX idx_created_at (created_at)
+    INDEX idx_started_by (started_by, status),
+    INDEX idx_created_at (created_at),
+    UNIQUE KEY uniq_workspace_url (workspace_id, url_hash)
 );
 
 -- Crawl results table
@@ -43,6 +112,20 @@ CREATE TABLE IF NOT EXISTS crawl_results (
     external_links INT DEFAULT 0,
     inaccessible_links INT DEFAULT 0,
     has_login_form BOOLEAN DEFAULT FALSE,
+    outcome VARCHAR(20) NOT NULL DEFAULT 'html',
+    content_type VARCHAR(255) NOT NULL DEFAULT '',
+    content_length BIGINT NOT NULL DEFAULT 0,
+    truncated BOOLEAN NOT NULL DEFAULT FALSE,
+    encoding VARCHAR(50) NOT NULL DEFAULT '',
+    ttfb_ms INT NOT NULL DEFAULT 0,
+    download_ms INT NOT NULL DEFAULT 0,
+    html_bytes BIGINT NOT NULL DEFAULT 0,
+    html_transfer_bytes BIGINT NOT NULL DEFAULT 0,
+    compression VARCHAR(20) NOT NULL DEFAULT '',
+    subresource_count INT NOT NULL DEFAULT 0,
+    subresource_bytes BIGINT NOT NULL DEFAULT 0,
+    over_budget BOOLEAN NOT NULL DEFAULT FALSE,
+    budget_violations VARCHAR(255) NOT NULL DEFAULT '',
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
     FOREIGN KEY (url_id) REFERENCES urls(id) ON DELETE CASCADE,
@@ -56,7 +139,169 @@ CREATE TABLE IF NOT EXISTS broken_links (
     url TEXT NOT NULL,
     status_code INT,
     error_message TEXT,
+    kind VARCHAR(20) NOT NULL DEFAULT 'broken',
+    attempts INT NOT NULL DEFAULT 1,
+    error_class VARCHAR(30) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (result_id) REFERENCES crawl_results(id) ON DELETE CASCADE,
+    INDEX idx_result_id (result_id)
+);
+
+-- Forms found on crawled pages
+CREATE TABLE IF NOT EXISTS page_forms (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    result_id INT NOT NULL,
+    action TEXT NOT NULL,
+    method VARCHAR(10) NOT NULL,
+    kind VARCHAR(20) NOT NULL,
+    confidence DECIMAL(3,2) NOT NULL DEFAULT 0,
+    fields JSON NOT NULL,
+    has_csrf_token BOOLEAN NOT NULL DEFAULT FALSE,
+    insecure_submit BOOLEAN NOT NULL DEFAULT FALSE,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY (result_id) REFERENCES crawl_results(id) ON DELETE CASCADE,
     INDEX idx_result_id (result_id)
 );
+
+-- Per-request timings recorded during crawls
+CREATE TABLE IF NOT EXISTS request_timings (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    result_id INT NOT NULL,
+    url TEXT NOT NULL,
+    method VARCHAR(10) NOT NULL,
+    status_code INT NOT NULL DEFAULT 0,
+    dns_ms INT NOT NULL DEFAULT 0,
+    connect_ms INT NOT NULL DEFAULT 0,
+    tls_ms INT NOT NULL DEFAULT 0,
+    ttfb_ms INT NOT NULL DEFAULT 0,
+    total_ms INT NOT NULL DEFAULT 0,
+    reused BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (result_id) REFERENCES crawl_results(id) ON DELETE CASCADE,
+    INDEX idx_result_id (result_id)
+);
+
+-- Refresh tokens, one rotation chain per login session
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    session_id CHAR(32) NOT NULL,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    INDEX idx_session_id (session_id)
+);
+
+-- Access tokens revoked before they expire
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    jti CHAR(32) PRIMARY KEY,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_expires_at (expires_at)
+);
+
+-- Personal API keys for scripts and CI
+CREATE TABLE IF NOT EXISTS api_keys (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    prefix VARCHAR(20) NOT NULL,
+    key_hash CHAR(64) NOT NULL UNIQUE,
+    scopes VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMP NULL,
+    last_used_at TIMESTAMP NULL,
+    revoked_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    INDEX idx_user_id (user_id)
+);
+
+-- Pending single sign-on logins: the PKCE state until the provider calls
+-- back, then a one-time code the frontend exchanges for tokens
+CREATE TABLE IF NOT EXISTS oidc_logins (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    state VARCHAR(64) NULL UNIQUE,
+    nonce VARCHAR(64) NOT NULL,
+    code_verifier VARCHAR(128) NOT NULL,
+    user_id INT NULL,
+    exchange_hash CHAR(64) NULL UNIQUE,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- One-time recovery codes for users with two-factor authentication
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    code_hash CHAR(64) NOT NULL,
+    used_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    UNIQUE KEY uniq_user_code (user_id, code_hash)
+);
+
+-- Single-use tokens sent in verification and password reset emails
+CREATE TABLE IF NOT EXISTS email_tokens (
+    jti CHAR(32) PRIMARY KEY,
+    user_id INT NOT NULL,
+    purpose VARCHAR(30) NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    INDEX idx_user_purpose (user_id, purpose)
+);
+
+-- Login attempts, for throttling password guessing and auditing failed
+-- logins. Failures are cleared, not deleted, by a successful login
+CREATE TABLE IF NOT EXISTS login_attempts (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    username VARCHAR(255) NOT NULL,
+    user_id INT NULL,
+    ip VARCHAR(45) NOT NULL,
+    user_agent VARCHAR(255) NOT NULL DEFAULT '',
+    success BOOLEAN NOT NULL,
+    reason VARCHAR(30) NOT NULL,
+    cleared BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL,
+    INDEX idx_username_created (username, created_at),
+    INDEX idx_ip_created (ip, created_at)
+);
+
+-- Audit events are append-only: nothing updates or deletes them. They have
+-- no foreign keys so they outlive the users and URLs they name
+CREATE TABLE IF NOT EXISTS audit_events (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    actor_id INT NULL,
+    actor VARCHAR(255) NOT NULL DEFAULT '',
+    api_key_id INT NULL,
+    action VARCHAR(50) NOT NULL,
+    target_type VARCHAR(30) NOT NULL DEFAULT '',
+    target_ids JSON NULL,
+    workspace_id INT NULL,
+    organization_id INT NULL,
+    details JSON NULL,
+    ip VARCHAR(45) NOT NULL DEFAULT '',
+    user_agent VARCHAR(255) NOT NULL DEFAULT '',
+    request_id VARCHAR(64) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_audit_actor (actor_id, id),
+    INDEX idx_audit_workspace (workspace_id, id),
+    INDEX idx_audit_organization (organization_id, id),
+    INDEX idx_audit_action (action, id)
+);
+
+-- Crawls started by each user, for the daily crawl quota
+CREATE TABLE IF NOT EXISTS crawl_starts (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    url_id INT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    INDEX idx_user_created (user_id, created_at)
+);
@@ -4,6 +4,11 @@ import { useAuth } from './hooks/useAuth';
 import { ToastProvider } from './contexts/ToastContext.tsx';
 import { Login } from './pages/Login';
 import { Register } from './pages/Register';
+import { AuthCallback } from './pages/AuthCallback';
+import { ForgotPassword } from './pages/ForgotPassword';
+import { ResetPassword } from './pages/ResetPassword';
+import { VerifyEmail } from './pages/VerifyEmail';
+import { AcceptInvite } from './pages/AcceptInvite';
 import { Dashboard } from './pages/Dashboard';
 import { URLDetails } from './pages/URLDetails';
 import { Layout } from './components/Layout';
@@ -52,6 +57,15 @@ function App() {
                 <Register />
               </PublicRoute>
             } />
+            <Route path="/auth/callback" element={<AuthCallback />} />
+            <Route path="/forgot-password" element={
+              <PublicRoute>
+                <ForgotPassword />
+              </PublicRoute>
+            } />
+            <Route path="/reset-password" element={<ResetPassword />} />
+            <Route path="/verify-email" element={<VerifyEmail />} />
+            <Route path="/invites/accept" element={<AcceptInvite />} />
             <Route path="/dashboard" element={
               <ProtectedRoute>
                 <Layout>
@@ -0,0 +1,90 @@
+import { useState } from 'react';
+import type { TwoFactorChallenge } from '../types';
+import { useAuth } from '../hooks/useAuth';
+
+interface TwoFactorFormProps {
+  challenge: TwoFactorChallenge;
+  onSuccess: () => void;
+  onCancel: () => void;
+}
+
+// Second login step: asks for a code from the authenticator app or a
+// recovery code.
+export const TwoFactorForm: React.FC<TwoFactorFormProps> = ({ challenge, onSuccess, onCancel }) => {
+  const [code, setCode] = useState('');
+  const [isLoading, setIsLoading] = useState(false);
+  const [error, setError] = useState<string | null>(null);
+
+  const { completeTwoFactor } = useAuth();
+
+  const handleSubmit = async (e: React.FormEvent) => {
+    e.preventDefault();
+    setIsLoading(true);
+    setError(null);
+
+    try {
+      await completeTwoFactor(challenge.challenge_token, code.trim());
+      onSuccess();
+    } catch {
+      setError('Invalid or expired code. Please try again.');
+    } finally {
+      setIsLoading(false);
+    }
+  };
+
+  return (
+    <form className="mt-8 space-y-6" onSubmit={handleSubmit}>
+      <div>
+        <label htmlFor="code" className="block text-sm font-medium text-gray-700">
+          Authentication code
+        </label>
+        <input
+          id="code"
+          name="code"
+          type="text"
+          inputMode="numeric"
+          autoComplete="one-time-code"
+          autoFocus
+          required
+          value={code}
+          onChange={(e) => setCode(e.target.value)}
+          className="input-field mt-1 block w-full px-3 py-2 border border-gray-300 rounded-md placeholder-gray-500 text-gray-900 focus:outline-none focus:ring-blue-500 focus:border-blue-500 sm:text-sm"
+          placeholder="123456"
+        />
+        <p className="mt-2 text-sm text-gray-600">
+          Enter the 6-digit code from your authenticator app, or one of your recovery codes.
+        </p>
+      </div>
+
+      {error && (
+        <div className="bg-red-100 border border-red-400 text-red-700 px-4 py-3 rounded">
+          {error}
+        </div>
+      )}
+
+      <div className="space-y-3">
+        <button
+          type="submit"
+          disabled={isLoading}
+          className="w-full flex justify-center py-2 px-4 border border-transparent text-sm font-medium rounded-md text-white bg-blue-600 hover:bg-blue-700 focus:outline-none focus:ring-2 focus:ring-offset-2 focus:ring-blue-500 disabled:opacity-50 disabled:cursor-not-allowed"
+        >
+          {isLoading ? (
+            <>
+              <span className="loading-spinner mr-2"></span>
+              Verifying...
+            </>
+          ) : (
+            'Verify'
+          )}
+        </button>
+        <button
+          type="button"
+          onClick={onCancel}
+          className="w-full text-sm font-medium text-blue-600 hover:text-blue-500"
+        >
+          Back to sign in
+        </button>
+      </div>
+    </form>
+  );
+};
@@ -1,12 +1,16 @@
 import { createContext } from 'react';
-import type { User, LoginRequest, RegisterRequest } from '../types';
+import type { User, LoginRequest, RegisterRequest, TwoFactorChallenge } from '../types';
 
 export interface AuthContextType {
   user: User | null;
   token: string | null;
   loading: boolean;
-  login: (credentials: LoginRequest) => Promise<void>;
+  // login and loginWithSSO resolve with a challenge when a second factor is
+  // needed; pass it to completeTwoFactor with the user's code
+  login: (credentials: LoginRequest) => Promise<TwoFactorChallenge | null>;
   register: (userData: RegisterRequest) => Promise<void>;
+  loginWithSSO: (code: string) => Promise<TwoFactorChallenge | null>;
+  completeTwoFactor: (challengeToken: string, code: string) => Promise<void>;
   logout: () => void;
   isAuthenticated: boolean;
 }
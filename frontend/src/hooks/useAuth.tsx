@@ -1,6 +1,6 @@
 import { useState, useEffect } from 'react';
-import type { User, AuthResponse } from '../types';
-import { apiService } from '../services/api';
+import type { User, AuthResponse, LoginRequest, TwoFactorChallenge } from '../types';
+import { apiService, isTwoFactorChallenge } from '../services/api';
 import { AuthContext, type AuthContextType } from '../contexts/AuthContext';
 
 interface AuthProviderProps {
@@ -25,21 +25,40 @@ export const AuthProvider: React.FC<AuthProviderProps> = ({ children }) => {
     setLoading(false);
   }, []);
 
-  const login = async (credentials: AuthContextType['login'] extends (c: infer P) => Promise<void> ? P : never) => {
+  const login = async (credentials: LoginRequest): Promise<TwoFactorChallenge | null> => {
     try {
-      const response: AuthResponse = await apiService.login(credentials);
+      const response = await apiService.login(credentials);
+      if (isTwoFactorChallenge(response)) {
+        return response;
+      }
       
       setToken(response.token);
       setUser(response.user);
       
       localStorage.setItem('token', response.token);
       localStorage.setItem('user', JSON.stringify(response.user));
+      return null;
     } catch (error) {
       console.error('Login error:', error);
       throw error;
     }
   };
 
+  const completeTwoFactor = async (challengeToken: string, code: string) => {
+    try {
+      const response: AuthResponse = await apiService.loginTwoFactor(challengeToken, code);
+
+      setToken(response.token);
+      setUser(response.user);
+
+      localStorage.setItem('token', response.token);
+      localStorage.setItem('user', JSON.stringify(response.user));
+    } catch (error) {
+      console.error('Two-factor login error:', error);
+      throw error;
+    }
+  };
+
   const register = async (userData: AuthContextType['register'] extends (u: infer P) => Promise<void> ? P : never) => {
     try {
       const response: AuthResponse = await apiService.register(userData);
@@ -55,11 +74,29 @@ export const AuthProvider: React.FC<AuthProviderProps> = ({ children }) => {
     }
   };
 
+  const loginWithSSO = async (code: string): Promise<TwoFactorChallenge | null> => {
+    try {
+      const response = await apiService.exchangeSSOCode(code);
+      if (isTwoFactorChallenge(response)) {
+        return response;
+      }
+
+      setToken(response.token);
+      setUser(response.user);
+
+      localStorage.setItem('token', response.token);
+      localStorage.setItem('user', JSON.stringify(response.user));
+      return null;
+    } catch (error) {
+      console.error('SSO login error:', error);
+      throw error;
+    }
+  };
+
   const logout = () => {
+    apiService.logout();
     setToken(null);
     setUser(null);
-    localStorage.removeItem('token');
-    localStorage.removeItem('user');
   };
 
   const value: AuthContextType = {
@@ -68,6 +105,8 @@ export const AuthProvider: React.FC<AuthProviderProps> = ({ children }) => {
     loading,
     login,
     register,
+    loginWithSSO,
+    completeTwoFactor,
     logout,
     isAuthenticated: !!token && !!user,
   };
@@ -0,0 +1,76 @@
+import { useEffect, useRef, useState } from 'react';
+import { Link, useSearchParams } from 'react-router-dom';
+import { apiService } from '../services/api';
+import { useAuth } from '../hooks/useAuth';
+
+export const AcceptInvite = () => {
+  const [searchParams] = useSearchParams();
+  const { isAuthenticated, loading } = useAuth();
+  const [status, setStatus] = useState<'pending' | 'accepted' | 'failed'>('pending');
+  const [error, setError] = useState('This invitation is invalid or has expired.');
+  const handled = useRef(false);
+
+  useEffect(() => {
+    // Each invitation can only be accepted once
+    if (loading || !isAuthenticated || handled.current) {
+      return;
+    }
+    handled.current = true;
+
+    const token = searchParams.get('token');
+    if (!token) {
+      setStatus('failed');
+      return;
+    }
+
+    apiService
+      .acceptInvite(token)
+      .then(() => setStatus('accepted'))
+      .catch((err) => {
+        if (err.response?.data?.error) {
+          setError(err.response.data.error);
+        }
+        setStatus('failed');
+      });
+  }, [searchParams, isAuthenticated, loading]);
+
+  if (loading) {
+    return (
+      <div className="min-h-screen flex items-center justify-center bg-gray-50">
+        <div className="loading-spinner"></div>
+      </div>
+    );
+  }
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-gray-50 py-12 px-4 sm:px-6 lg:px-8">
+      <div className="max-w-md w-full space-y-8 text-center">
+        {!isAuthenticated && (
+          <div className="bg-blue-100 border border-blue-400 text-blue-700 px-4 py-3 rounded">
+            Sign in or create an account with the invited email address, then open the invitation link again.
+          </div>
+        )}
+        {isAuthenticated && status === 'pending' && <div className="loading-spinner"></div>}
+        {status === 'accepted' && (
+          <div className="bg-green-100 border border-green-400 text-green-700 px-4 py-3 rounded">
+            You have joined the organization. Its workspaces are now available to you.
+          </div>
+        )}
+        {status === 'failed' && (
+          <div className="bg-red-100 border border-red-400 text-red-700 px-4 py-3 rounded">
+            {error}
+          </div>
+        )}
+        {isAuthenticated ? (
+          <Link to="/dashboard" className="font-medium text-blue-600 hover:text-blue-500">
+            Go to dashboard
+          </Link>
+        ) : (
+          <Link to="/login" className="font-medium text-blue-600 hover:text-blue-500">
+            Sign in
+          </Link>
+        )}
+      </div>
+    </div>
+  );
+};
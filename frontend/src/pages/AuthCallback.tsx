@@ -0,0 +1,67 @@
+import { useEffect, useRef, useState } from 'react';
+import { Link, useNavigate } from 'react-router-dom';
+import { useAuth } from '../hooks/useAuth';
+import { TwoFactorForm } from '../components/TwoFactorForm';
+import type { TwoFactorChallenge } from '../types';
+
+// Landing page for single sign-on. The backend redirects here with a one-time
+// code (or an error) in the URL fragment.
+export const AuthCallback = () => {
+  const [error, setError] = useState<string | null>(null);
+  const [challenge, setChallenge] = useState<TwoFactorChallenge | null>(null);
+  const { loginWithSSO } = useAuth();
+  const navigate = useNavigate();
+  const handled = useRef(false);
+
+  useEffect(() => {
+    // The code can only be exchanged once
+    if (handled.current) {
+      return;
+    }
+    handled.current = true;
+
+    const params = new URLSearchParams(window.location.hash.slice(1));
+    window.history.replaceState(null, '', window.location.pathname);
+
+    const code = params.get('code');
+    if (!code) {
+      setError(params.get('error') || 'Missing login code');
+      return;
+    }
+
+    loginWithSSO(code)
+      .then((pending) => {
+        if (pending) {
+          setChallenge(pending);
+          return;
+        }
+        navigate('/dashboard', { replace: true });
+      })
+      .catch(() => setError('Single sign-on failed. Please try again.'));
+  }, [loginWithSSO, navigate]);
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-gray-50 py-12 px-4 sm:px-6 lg:px-8">
+      <div className="max-w-md w-full space-y-8 text-center">
+        {error ? (
+          <>
+            <div className="bg-red-100 border border-red-400 text-red-700 px-4 py-3 rounded">
+              Sign-in failed: {error}
+            </div>
+            <Link to="/login" className="font-medium text-blue-600 hover:text-blue-500">
+              Back to sign in
+            </Link>
+          </>
+        ) : challenge ? (
+          <TwoFactorForm
+            challenge={challenge}
+            onSuccess={() => navigate('/dashboard', { replace: true })}
+            onCancel={() => navigate('/login', { replace: true })}
+          />
+        ) : (
+          <div className="loading-spinner"></div>
+        )}
+      </div>
+    </div>
+  );
+};
@@ -33,8 +33,8 @@ export const Register = () => {
       return;
     }
 
-    if (formData.password.length < 6) {
-      setError('Password must be at least 6 characters long');
+    if (formData.password.length < 10) {
+      setError('Password must be at least 10 characters long');
       setIsLoading(false);
       return;
     }
@@ -46,8 +46,10 @@ export const Register = () => {
         password: formData.password,
       });
       navigate('/dashboard');
-    } catch {
-      setError('Registration failed. Please try again.');
+    } catch (err) {
+      // Show why the server rejected the password, e.g. a breached password
+      const message = (err as { response?: { data?: { error?: string } } }).response?.data?.error;
+      setError(message || 'Registration failed. Please try again.');
     } finally {
       setIsLoading(false);
     }
@@ -0,0 +1,49 @@
+import { useEffect, useRef, useState } from 'react';
+import { Link, useSearchParams } from 'react-router-dom';
+import { apiService } from '../services/api';
+
+export const VerifyEmail = () => {
+  const [searchParams] = useSearchParams();
+  const [status, setStatus] = useState<'pending' | 'verified' | 'failed'>('pending');
+  const handled = useRef(false);
+
+  useEffect(() => {
+    // Each link can only be used once
+    if (handled.current) {
+      return;
+    }
+    handled.current = true;
+
+    const token = searchParams.get('token');
+    if (!token) {
+      setStatus('failed');
+      return;
+    }
+
+    apiService
+      .verifyEmail(token)
+      .then(() => setStatus('verified'))
+      .catch(() => setStatus('failed'));
+  }, [searchParams]);
+
+  return (
+    <div className="min-h-screen flex items-center justify-center bg-gray-50 py-12 px-4 sm:px-6 lg:px-8">
+      <div className="max-w-md w-full space-y-8 text-center">
+        {status === 'pending' && <div className="loading-spinner"></div>}
+        {status === 'verified' && (
+          <div className="bg-green-100 border border-green-400 text-green-700 px-4 py-3 rounded">
+            Your email address has been verified. You can now start crawls.
+          </div>
+        )}
+        {status === 'failed' && (
+          <div className="bg-red-100 border border-red-400 text-red-700 px-4 py-3 rounded">
+            This verification link is invalid or has expired.
+          </div>
+        )}
+        <Link to="/dashboard" className="font-medium text-blue-600 hover:text-blue-500">
+          Go to dashboard
+        </Link>
+      </div>
+    </div>
+  );
+};
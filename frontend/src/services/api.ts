@@ -9,8 +9,27 @@ import type {
   CrawlResult,
   PaginatedResponse,
   SuccessResponse,
+  SSOConfig,
+  TwoFactorChallenge,
+  TwoFactorStatus,
+  TwoFactorEnrollment,
+  RecoveryCodesResponse,
+  Profile,
+  Quota,
+  UpdateProfileRequest,
+  DeleteAccountRequest,
+  Organization,
+  OrganizationRole,
+  Workspace,
+  Member,
+  Invite,
+  AuditEvent,
 } from '../types';
 
+export const isTwoFactorChallenge = (
+  response: AuthResponse | TwoFactorChallenge
+): response is TwoFactorChallenge => 'two_factor_required' in response && response.two_factor_required;
+
 class ApiService {
   private api: AxiosInstance;
 
@@ -35,13 +54,26 @@ class ApiService {
       (error) => Promise.reject(error)
     );
 
-    // Add response interceptor to handle auth errors
+    // Add response interceptor to refresh expired tokens and handle auth errors
     this.api.interceptors.response.use(
       (response) => response,
-      (error) => {
+      async (error) => {
+        const original = error.config;
+        if (
+          error.response?.status === 401 &&
+          original &&
+          !original._retried &&
+          !original.url?.startsWith('/auth/')
+        ) {
+          original._retried = true;
+          const token = await this.refreshToken();
+          if (token) {
+            original.headers.Authorization = `Bearer ${token}`;
+            return this.api(original);
+          }
+        }
         if (error.response?.status === 401) {
-          localStorage.removeItem('token');
-          localStorage.removeItem('user');
+          this.clearSession();
           window.location.href = '/login';
         }
         return Promise.reject(error);
@@ -49,28 +81,273 @@ class ApiService {
     );
   }
 
+  private refreshing: Promise<string | null> | null = null;
+
+  // Exchange the stored refresh token for new tokens. Concurrent callers share
+  // one request since each refresh token can only be used once.
+  private refreshToken(): Promise<string | null> {
+    const refreshToken = localStorage.getItem('refresh_token');
+    if (!refreshToken) {
+      return Promise.resolve(null);
+    }
+
+    if (!this.refreshing) {
+      this.refreshing = this.api
+        .post<AuthResponse>('/auth/refresh', { refresh_token: refreshToken })
+        .then((response) => {
+          this.storeTokens(response.data);
+          return response.data.token;
+        })
+        .catch(() => null)
+        .finally(() => {
+          this.refreshing = null;
+        });
+    }
+    return this.refreshing;
+  }
+
+  private storeTokens(data: AuthResponse): void {
+    if (data.token) {
+      localStorage.setItem('token', data.token);
+    }
+    if (data.refresh_token) {
+      localStorage.setItem('refresh_token', data.refresh_token);
+    }
+  }
+
+  private clearSession(): void {
+    localStorage.removeItem('token');
+    localStorage.removeItem('refresh_token');
+    localStorage.removeItem('user');
+  }
+
   // Auth endpoints
-  async login(credentials: LoginRequest): Promise<AuthResponse> {
-    const response: AxiosResponse<AuthResponse> = await this.api.post('/auth/login', credentials);
-    // Store token after successful login
-    if (response.data.token) {
-      localStorage.setItem('token', response.data.token);
+  async login(credentials: LoginRequest): Promise<AuthResponse | TwoFactorChallenge> {
+    const response: AxiosResponse<AuthResponse | TwoFactorChallenge> = await this.api.post('/auth/login', credentials);
+    // Store tokens after successful login; 2FA users get a challenge first
+    if (!isTwoFactorChallenge(response.data)) {
+      this.storeTokens(response.data);
     }
     return response.data;
   }
 
+  async loginTwoFactor(challengeToken: string, code: string): Promise<AuthResponse> {
+    const response: AxiosResponse<AuthResponse> = await this.api.post('/auth/2fa/login', {
+      challenge_token: challengeToken,
+      code,
+    });
+    this.storeTokens(response.data);
+    return response.data;
+  }
+
   async register(userData: RegisterRequest): Promise<AuthResponse> {
     const response: AxiosResponse<AuthResponse> = await this.api.post('/auth/register', userData);
-    // Store token after successful registration
-    if (response.data.token) {
-      localStorage.setItem('token', response.data.token);
+    // Store tokens after successful registration
+    this.storeTokens(response.data);
+    return response.data;
+  }
+
+  // Account recovery and email verification
+  async forgotPassword(email: string): Promise<SuccessResponse> {
+    const response: AxiosResponse<SuccessResponse> = await this.api.post('/auth/forgot-password', { email });
+    return response.data;
+  }
+
+  async resetPassword(token: string, password: string): Promise<SuccessResponse> {
+    const response: AxiosResponse<SuccessResponse> = await this.api.post('/auth/reset-password', { token, password });
+    return response.data;
+  }
+
+  async verifyEmail(token: string): Promise<SuccessResponse> {
+    const response: AxiosResponse<SuccessResponse> = await this.api.post('/auth/verify-email', { token });
+    return response.data;
+  }
+
+  async resendVerification(): Promise<SuccessResponse> {
+    const response: AxiosResponse<SuccessResponse> = await this.api.post('/auth/resend-verification');
+    return response.data;
+  }
+
+  // Single sign-on
+  async getSSOConfig(): Promise<SSOConfig> {
+    const response: AxiosResponse<SSOConfig> = await this.api.get('/auth/oidc');
+    return response.data;
+  }
+
+  ssoLoginURL(): string {
+    return `${this.api.defaults.baseURL}/auth/oidc/login`;
+  }
+
+  async exchangeSSOCode(code: string): Promise<AuthResponse | TwoFactorChallenge> {
+    const response: AxiosResponse<AuthResponse | TwoFactorChallenge> = await this.api.post('/auth/oidc/exchange', { code });
+    if (!isTwoFactorChallenge(response.data)) {
+      this.storeTokens(response.data);
     }
     return response.data;
   }
 
+  // Two-factor authentication
+  async getTwoFactorStatus(): Promise<TwoFactorStatus> {
+    const response: AxiosResponse<TwoFactorStatus> = await this.api.get('/auth/2fa');
+    return response.data;
+  }
+
+  async enrollTwoFactor(): Promise<TwoFactorEnrollment> {
+    const response: AxiosResponse<TwoFactorEnrollment> = await this.api.post('/auth/2fa/enroll');
+    return response.data;
+  }
+
+  async verifyTwoFactor(code: string): Promise<RecoveryCodesResponse> {
+    const response: AxiosResponse<RecoveryCodesResponse> = await this.api.post('/auth/2fa/verify', { code });
+    return response.data;
+  }
+
+  async disableTwoFactor(code: string): Promise<SuccessResponse> {
+    const response: AxiosResponse<SuccessResponse> = await this.api.post('/auth/2fa/disable', { code });
+    return response.data;
+  }
+
+  async regenerateRecoveryCodes(code: string): Promise<RecoveryCodesResponse> {
+    const response: AxiosResponse<RecoveryCodesResponse> = await this.api.post('/auth/2fa/recovery-codes', { code });
+    return response.data;
+  }
+
+  // Account
+  async getMe(): Promise<Profile> {
+    const response: AxiosResponse<Profile> = await this.api.get('/me');
+    return response.data;
+  }
+
+  async updateMe(data: UpdateProfileRequest): Promise<SuccessResponse> {
+    const response: AxiosResponse<SuccessResponse> = await this.api.put('/me', data);
+    return response.data;
+  }
+
+  async changePassword(currentPassword: string, newPassword: string): Promise<AuthResponse> {
+    const response: AxiosResponse<AuthResponse> = await this.api.put('/me/password', {
+      current_password: currentPassword,
+      new_password: newPassword,
+    });
+    // Other sessions are logged out; this one continues with new tokens
+    this.storeTokens(response.data);
+    return response.data;
+  }
+
+  async deleteMe(confirmation: DeleteAccountRequest): Promise<SuccessResponse> {
+    const response: AxiosResponse<SuccessResponse> = await this.api.delete('/me', { data: confirmation });
+    this.clearSession();
+    return response.data;
+  }
+
+  async exportMe(): Promise<Blob> {
+    const response: AxiosResponse<Blob> = await this.api.get('/me/export', { responseType: 'blob' });
+    return response.data;
+  }
+
+  async getQuota(): Promise<Quota> {
+    const response: AxiosResponse<Quota> = await this.api.get('/me/quota');
+    return response.data;
+  }
+
+  // Organizations and workspaces
+  async getWorkspaces(): Promise<Workspace[]> {
+    const response: AxiosResponse<Workspace[]> = await this.api.get('/workspaces');
+    return response.data;
+  }
+
+  async getOrganizations(): Promise<Organization[]> {
+    const response: AxiosResponse<Organization[]> = await this.api.get('/orgs');
+    return response.data;
+  }
+
+  async createOrganization(name: string): Promise<SuccessResponse> {
+    const response: AxiosResponse<SuccessResponse> = await this.api.post('/orgs', { name });
+    return response.data;
+  }
+
+  async deleteOrganization(id: number): Promise<SuccessResponse> {
+    const response: AxiosResponse<SuccessResponse> = await this.api.delete(`/orgs/${id}`);
+    return response.data;
+  }
+
+  async leaveOrganization(id: number): Promise<SuccessResponse> {
+    const response: AxiosResponse<SuccessResponse> = await this.api.post(`/orgs/${id}/leave`);
+    return response.data;
+  }
+
+  async getMembers(orgId: number): Promise<Member[]> {
+    const response: AxiosResponse<Member[]> = await this.api.get(`/orgs/${orgId}/members`);
+    return response.data;
+  }
+
+  async updateMember(orgId: number, userId: number, role: OrganizationRole): Promise<SuccessResponse> {
+    const response: AxiosResponse<SuccessResponse> = await this.api.put(`/orgs/${orgId}/members/${userId}`, { role });
+    return response.data;
+  }
+
+  async removeMember(orgId: number, userId: number): Promise<SuccessResponse> {
+    const response: AxiosResponse<SuccessResponse> = await this.api.delete(`/orgs/${orgId}/members/${userId}`);
+    return response.data;
+  }
+
+  async getInvites(orgId: number): Promise<Invite[]> {
+    const response: AxiosResponse<Invite[]> = await this.api.get(`/orgs/${orgId}/invites`);
+    return response.data;
+  }
+
+  async createInvite(orgId: number, email: string, role?: OrganizationRole): Promise<SuccessResponse> {
+    const response: AxiosResponse<SuccessResponse> = await this.api.post(`/orgs/${orgId}/invites`, { email, role });
+    return response.data;
+  }
+
+  async revokeInvite(orgId: number, inviteId: number): Promise<SuccessResponse> {
+    const response: AxiosResponse<SuccessResponse> = await this.api.delete(`/orgs/${orgId}/invites/${inviteId}`);
+    return response.data;
+  }
+
+  async acceptInvite(token: string): Promise<SuccessResponse> {
+    const response: AxiosResponse<SuccessResponse> = await this.api.post('/invites/accept', { token });
+    return response.data;
+  }
+
+  async getAuditEvents(params?: {
+    page?: number;
+    page_size?: number;
+    action?: string;
+    actor_id?: number;
+    workspace_id?: number;
+    target_type?: string;
+    target_id?: number;
+  }): Promise<PaginatedResponse<AuditEvent>> {
+    const response: AxiosResponse<PaginatedResponse<AuditEvent>> = await this.api.get('/audit', { params });
+    return response.data;
+  }
+
+  async createWorkspace(orgId: number, name: string): Promise<SuccessResponse> {
+    const response: AxiosResponse<SuccessResponse> = await this.api.post(`/orgs/${orgId}/workspaces`, { name });
+    return response.data;
+  }
+
+  async deleteWorkspace(orgId: number, workspaceId: number): Promise<SuccessResponse> {
+    const response: AxiosResponse<SuccessResponse> = await this.api.delete(`/orgs/${orgId}/workspaces/${workspaceId}`);
+    return response.data;
+  }
+
   logout(): void {
-    localStorage.removeItem('token');
-    localStorage.removeItem('user');
+    // Revoke the session server-side; local tokens are dropped either way
+    const token = localStorage.getItem('token');
+    if (token) {
+      this.api
+        .post('/auth/logout', null, { headers: { Authorization: `Bearer ${token}` } })
+        .catch(() => undefined);
+    }
+    this.clearSession();
+  }
+
+  async logoutAll(): Promise<SuccessResponse> {
+    const response: AxiosResponse<SuccessResponse> = await this.api.post('/auth/logout-all');
+    this.clearSession();
+    return response.data;
   }
 
   isAuthenticated(): boolean {
@@ -85,6 +362,7 @@ class ApiService {
     status?: string;
     sort_by?: string;
     sort_order?: 'asc' | 'desc';
+    workspace_id?: number;
   }): Promise<PaginatedResponse<URLItem>> {
     const response: AxiosResponse<PaginatedResponse<URLItem>> = await this.api.get('/urls', { params });
     return response.data;
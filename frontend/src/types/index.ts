@@ -6,6 +6,96 @@ export interface User {
   updated_at: string;
 }
 
+export interface Profile extends User {
+  email_verified: boolean;
+  two_factor_enabled: boolean;
+  has_password: boolean;
+  sso_linked: boolean;
+}
+
+// A limit of 0 means unlimited; crawls count over the last 24 hours
+export interface Quota {
+  plan: string;
+  max_urls: number;
+  max_crawls_per_day: number;
+  max_concurrent_crawls: number;
+  urls: number;
+  crawls_today: number;
+  running_crawls: number;
+}
+
+export interface QuotaExceededError {
+  error: string;
+  quota: 'urls' | 'crawls_per_day' | 'concurrent_crawls';
+  limit: number;
+  used: number;
+}
+
+export interface UpdateProfileRequest {
+  username?: string;
+  email?: string;
+  current_password?: string;
+}
+
+export interface DeleteAccountRequest {
+  password?: string;
+  username?: string;
+  code?: string;
+}
+
+export type OrganizationRole = 'viewer' | 'editor' | 'admin';
+
+export interface Organization {
+  id: number;
+  name: string;
+  personal: boolean;
+  role: OrganizationRole;
+  created_at: string;
+}
+
+export interface Workspace {
+  id: number;
+  organization_id: number;
+  organization_name: string;
+  name: string;
+  personal: boolean;
+  role: OrganizationRole;
+  created_at: string;
+}
+
+export interface Member {
+  user_id: number;
+  username: string;
+  email: string;
+  role: OrganizationRole;
+  created_at: string;
+}
+
+export interface Invite {
+  id: number;
+  email: string;
+  role: OrganizationRole;
+  invited_by?: string;
+  expires_at: string;
+  created_at: string;
+}
+
+export interface AuditEvent {
+  id: number;
+  actor_id?: number;
+  actor: string;
+  api_key_id?: number;
+  action: string;
+  target_type?: string;
+  target_ids?: number[];
+  workspace_id?: number;
+  details?: Record<string, unknown>;
+  ip: string;
+  user_agent: string;
+  request_id: string;
+  created_at: string;
+}
+
 export interface CrawlResult {
   id: number;
   url_id: number;
@@ -21,9 +111,53 @@ export interface CrawlResult {
   external_links: number;
   inaccessible_links: number;
   has_login_form: boolean;
+  outcome?: 'html' | 'non_html';
+  content_type?: string;
+  content_length?: number;
+  truncated?: boolean;
+  encoding?: string;
+  ttfb_ms?: number;
+  download_ms?: number;
+  html_bytes?: number;
+  html_transfer_bytes?: number;
+  compression?: string;
+  subresource_count?: number;
+  subresource_bytes?: number;
+  over_budget?: boolean;
+  budget_violations?: string[];
   created_at: string;
   updated_at: string;
   broken_links?: BrokenLink[];
+  forms?: PageForm[];
+  timings?: RequestTiming[];
+}
+
+export interface RequestTiming {
+  id: number;
+  result_id: number;
+  url: string;
+  method: string;
+  status_code: number;
+  dns_ms: number;
+  connect_ms: number;
+  tls_ms: number;
+  ttfb_ms: number;
+  total_ms: number;
+  reused: boolean;
+  created_at: string;
+}
+
+export interface PageForm {
+  id: number;
+  result_id: number;
+  action: string;
+  method: 'GET' | 'POST';
+  kind: 'login' | 'signup' | 'search' | 'newsletter' | 'payment' | 'other';
+  confidence: number;
+  fields: { name: string; type: string; autocomplete?: string; required: boolean }[];
+  has_csrf_token: boolean;
+  insecure_submit: boolean;
+  created_at: string;
 }
 
 export interface BrokenLink {
@@ -32,14 +166,44 @@ export interface BrokenLink {
   url: string;
   status_code: number;
   error_message: string;
+  kind?: 'broken' | 'soft_404' | 'blocked' | 'missing_anchor';
+  attempts?: number;
+  error_class?: string;
   created_at: string;
 }
 
+export interface CrawlProfile {
+  user_agent?: string;
+  headers?: Record<string, string>;
+  cookies?: { name: string; value: string }[];
+  basic_auth?: { username: string; password?: string };
+  login?: {
+    login_url: string;
+    username: string;
+    password?: string;
+    username_field?: string;
+    password_field?: string;
+    success_text?: string;
+  };
+  proxy?: {
+    urls?: string[];
+    username?: string;
+    password?: string;
+    no_proxy?: string[];
+    direct?: boolean;
+  };
+  page_timeout?: number;
+  link_timeout?: number;
+  max_redirects?: number;
+}
+
 export interface URLItem {
   id: number;
   user_id: number;
+  workspace_id?: number;
   url: string;
   status: 'queued' | 'running' | 'completed' | 'failed';
+  profile?: CrawlProfile;
   created_at: string;
   updated_at: string;
   result?: CrawlResult;
@@ -55,9 +219,53 @@ export interface PaginatedResponse<T> {
 
 export interface AuthResponse {
   token: string;
+  refresh_token?: string;
+  expires_in?: number;
   user: User;
 }
 
+// Returned by login instead of tokens when the user has two-factor
+// authentication enabled
+export interface TwoFactorChallenge {
+  two_factor_required: true;
+  challenge_token: string;
+  expires_in: number;
+}
+
+export interface TwoFactorStatus {
+  enabled: boolean;
+  recovery_codes_remaining: number;
+}
+
+export interface TwoFactorEnrollment {
+  secret: string;
+  otpauth_uri: string;
+}
+
+export interface RecoveryCodesResponse {
+  recovery_codes: string[];
+}
+
+export interface SSOConfig {
+  enabled: boolean;
+}
+
+export type APIKeyScope = 'urls:read' | 'urls:write' | 'settings:read' | 'settings:write';
+
+export interface APIKey {
+  id: number;
+  name: string;
+  prefix: string;
+  scopes: APIKeyScope[];
+  expires_at: string | null;
+  last_used_at: string | null;
+  created_at: string;
+}
+
+export interface CreatedAPIKey extends APIKey {
+  key: string;
+}
+
 export interface ErrorResponse {
   error: string;
 }
@@ -80,6 +288,8 @@ export interface RegisterRequest {
 
 export interface URLRequest {
   url: string;
+  workspace_id?: number;
+  profile?: CrawlProfile;
 }
 
 export interface BulkRequest {